@@ -0,0 +1,178 @@
+package config
+
+// 账号注销：冷静期结束后彻底删除用户及其全部数据
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"project/global"
+	"project/log"
+	"project/models"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDeletionGraceDays    = 14
+	defaultPurgeIntervalMinutes = 60
+)
+
+// DeletionGracePeriod 用户自助注销后到彻底删除之间的冷静期
+func DeletionGracePeriod() time.Duration {
+	days := defaultDeletionGraceDays
+	if AppConfig != nil && AppConfig.Account.DeletionGraceDays > 0 {
+		days = AppConfig.Account.DeletionGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func startAccountPurger() {
+	interval := defaultPurgeIntervalMinutes
+	if AppConfig.Account.PurgeIntervalMinutes > 0 {
+		interval = AppConfig.Account.PurgeIntervalMinutes
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			purgeExpiredAccounts()
+			<-ticker.C
+		}
+	}()
+}
+
+// 找出冷静期已结束的账号并逐个彻底删除
+func purgeExpiredAccounts() {
+	var users []models.Users
+	if err := global.DB.Unscoped().Select("id", "username").
+		Where("deleted_at IS NOT NULL AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Find(&users).Error; err != nil {
+		log.L().Error("query expired accounts failed", zap.Error(err))
+		return
+	}
+	for _, u := range users {
+		if err := PurgeUser(u.ID); err != nil {
+			log.L().Error("purge account failed", zap.Uint("user_id", u.ID), zap.Error(err))
+			continue
+		}
+		ClearUserCache(u.Username)
+		global.DB.Create(&models.AuditLog{Action: models.AuditAccountPurge, TargetType: models.AuditTargetUser, TargetID: &u.ID, Detail: "username=" + u.Username})
+		log.L().Info("account purged", zap.Uint("user_id", u.ID), zap.String("username", u.Username))
+	}
+}
+
+// PurgeUser 彻底删除用户：文章及其评论、评论、收藏、文件（含存储中的内容）、翻译历史、游戏成绩和认证数据
+func PurgeUser(userID uint) error {
+	var held []struct {
+		Hash string
+		N    int64
+	}
+	// 去重上线前上传、尚未迁移的旧文件直接存放在 user_<id>/ 下，事务提交后通过存储后端删除
+	var legacy []string
+	if err := global.DB.Model(&models.Files{}).Distinct().
+		Where("user_id = ? AND (hash = '' OR hash IS NULL)", userID).Pluck("file_path", &legacy).Error; err != nil {
+		return err
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 先释放该用户文件引用的内容（已删除的文件在删除时已经释放过）
+		if err := tx.Model(&models.Files{}).Select("hash, COUNT(*) AS n").
+			Where("user_id = ? AND hash <> ''", userID).Group("hash").Scan(&held).Error; err != nil {
+			return err
+		}
+		for _, h := range held {
+			if err := ReleaseBlob(tx, h.Hash, h.N); err != nil {
+				return err
+			}
+		}
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		articleIDs := tx.Model(&models.Article{}).Select("id").Where("user_id = ?", userID)
+		// 该用户评论过的他人文章，删除后需要重新统计评论数
+		var commented []uint
+		if err := tx.Model(&models.Comment{}).Distinct().
+			Where("user_id = ? AND article_id NOT IN (?)", userID, articleIDs).
+			Pluck("article_id", &commented).Error; err != nil {
+			return err
+		}
+		// 他人对该用户评论的回复保留为顶层评论（MySQL 不允许更新语句的子查询引用同一张表，先查出ID）
+		var ownComments []uint
+		if err := tx.Model(&models.Comment{}).Where("user_id = ?", userID).Pluck("id", &ownComments).Error; err != nil {
+			return err
+		}
+		if len(ownComments) > 0 {
+			if err := tx.Model(&models.Comment{}).
+				Where("parent_id IN ? AND user_id <> ?", ownComments, userID).
+				Update("parent_id", nil).Error; err != nil {
+				return err
+			}
+		}
+		steps := []struct {
+			model any
+			query string
+			args  []any
+		}{
+			{&models.Comment{}, "article_id IN (?) OR user_id = ?", []any{articleIDs, userID}},
+			{&models.CollectionItem{}, "article_id IN (?) OR collection_id IN (?)", []any{articleIDs, tx.Model(&models.Collection{}).Select("id").Where("user_id = ?", userID)}},
+			{&models.UserLikeArticle{}, "article_id IN (?) OR user_id = ?", []any{articleIDs, userID}},
+			{&models.UserArticleRepost{}, "article_id IN (?) OR user_id = ?", []any{articleIDs, userID}},
+			{&models.UserCollectionItem{}, "article_id IN (?) OR user_id = ?", []any{articleIDs, userID}},
+			{&models.Collection{}, "user_id = ?", []any{userID}},
+			{&models.Article{}, "user_id = ?", []any{userID}},
+			{&models.FileShare{}, "user_id = ? OR file_id IN (?)", []any{userID, tx.Model(&models.Files{}).Select("id").Where("user_id = ?", userID)}},
+			{&models.FileTag{}, "file_id IN (?) OR tag_id IN (?)", []any{tx.Model(&models.Files{}).Select("id").Where("user_id = ?", userID), tx.Model(&models.Tag{}).Select("id").Where("user_id = ?", userID)}},
+			{&models.Tag{}, "user_id = ?", []any{userID}},
+			{&models.Files{}, "user_id = ?", []any{userID}},
+			{&models.Folder{}, "user_id = ?", []any{userID}},
+			{&models.TranslationHistory{}, "user_id = ?", []any{userID}},
+			{&models.Game_Guess_Score{}, "user_id = ?", []any{userID}},
+			{&models.Game_Map_Time{}, "user_id = ?", []any{userID}},
+			{&models.Game_2048_Score{}, "user_id = ?", []any{userID}},
+			{&models.RefreshToken{}, "user_id = ?", []any{userID}},
+			{&models.RecoveryCode{}, "user_id = ?", []any{userID}},
+			{&models.PasswordResetToken{}, "user_id = ?", []any{userID}},
+			{&models.ExportJob{}, "user_id = ?", []any{userID}},
+			{&models.UserIdentity{}, "user_id = ?", []any{userID}},
+			{&models.PersonalAccessToken{}, "user_id = ?", []any{userID}},
+			{&models.UploadSession{}, "user_id = ?", []any{userID}},
+		}
+		for _, s := range steps {
+			if err := tx.Where(s.query, s.args...).Delete(s.model).Error; err != nil {
+				return fmt.Errorf("delete %T failed: %w", s.model, err)
+			}
+		}
+		if len(commented) > 0 {
+			if err := tx.Model(&models.Article{}).Where("id IN ?", commented).
+				UpdateColumn("comment_count", gorm.Expr("(SELECT COUNT(*) FROM comments WHERE comments.article_id = articles.id AND comments.deleted_at IS NULL)")).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Users{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 数据库删除成功后再删除存储中的文件，失败只记录日志，由存储一致性检查处理（内容回收失败的由定时任务重试）
+	for _, h := range held {
+		if err := CollectBlob(h.Hash); err != nil {
+			log.L().Warn("collect blob failed", zap.String("hash", h.Hash), zap.Error(err))
+		}
+	}
+	for _, key := range legacy {
+		var others int64 // 旧版上传同名文件会覆盖，多条记录可能指向同一路径
+		if global.DB.Model(&models.Files{}).Where("file_path = ?", key).Count(&others); others > 0 {
+			continue
+		}
+		if err := global.Storage.Delete(context.Background(), key); err != nil {
+			log.L().Warn("remove legacy file failed", zap.String("path", key), zap.Error(err))
+		}
+	}
+	// 导出的压缩包总是保存在本地磁盘
+	archives, _ := filepath.Glob(filepath.Join(AppConfig.Upload.Storagepath, ExportDir, fmt.Sprintf("user_%d-*", userID)))
+	for _, a := range archives {
+		os.Remove(a)
+	}
+	global.RedisDB.Del(RedisHomePage) // 主页可能缓存了该用户的文章
+	return nil
+}
@@ -0,0 +1,228 @@
+package config
+
+// 文件内容去重存储：内容按 SHA-256 以 blobs/ 开头的 key 存入存储后端，Files 记录通过哈希引用，
+// 引用数降为 0 时回收。内容的写入与删除都在持有 blobs 行锁的事务中进行，上传与回收不会互相踩踏；
+// 回收时先提交“回收中”的标记再删除内容，数据库不会在内容删除后仍把它当作可用
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/storage"
+	"project/utils"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlobKey 内容文件相对上传目录的路径，按哈希前两位分目录
+func BlobKey(hash string) string {
+	return path.Join(BlobDir, hash[:2], hash)
+}
+
+// AttachBlob 在事务中为一条 Files 记录引用内容：内容不存在时把本地临时文件存入存储后端，已存在则删除临时文件；
+// 返回内容的 key。必须与 Files 记录的写入处于同一事务
+func AttachBlob(tx *gorm.DB, tmpPath, hash string, size int64) (string, error) {
+	return attachBlob(context.Background(), tx, global.Storage, tmpPath, hash, size)
+}
+
+func attachBlob(ctx context.Context, tx *gorm.DB, st storage.Storage, tmpPath, hash string, size int64) (string, error) {
+	// 先插入（已存在则忽略）再加锁读取，保证并发上传同一内容时只有一方写入存储
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Blob{Hash: hash, Size: size, Path: BlobKey(hash)}).Error; err != nil {
+		return "", err
+	}
+	var b models.Blob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", hash).Take(&b).Error
+	if err != nil {
+		return "", err
+	}
+	exists := false
+	if b.RefCount != models.BlobCollecting { // 回收中的内容可能已被删除，重新写入
+		if exists, err = storage.Exists(ctx, st, b.Path); err != nil {
+			return "", err
+		}
+	}
+	if exists {
+		_ = os.Remove(tmpPath)
+	} else if err := storage.PutFile(ctx, st, tmpPath, b.Path); err != nil {
+		return "", err
+	}
+	if err := tx.Model(&models.Blob{}).Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("GREATEST(ref_count, 0) + 1")).Error; err != nil {
+		return "", err
+	}
+	return b.Path, nil
+}
+
+// ReleaseBlob 在事务中减少内容的引用数，事务提交后调用 CollectBlob 回收
+func ReleaseBlob(tx *gorm.DB, hash string, n int64) error {
+	if hash == "" || n <= 0 {
+		return nil
+	}
+	return tx.Model(&models.Blob{}).Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("GREATEST(ref_count - ?, 0)", n)).Error
+}
+
+// CollectBlob 引用数为 0 时删除内容文件与记录；删除前再核对一次实际引用，计数有偏差时修正而不删除。
+// 分两步：先提交“回收中”标记，再在持有行锁时删除内容与记录。删除内容后事务失败时记录停留在回收中，
+// 上传同一内容会重新写入，定时任务会再次回收
+func CollectBlob(hash string) error {
+	if hash == "" {
+		return nil
+	}
+	marked := false
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var b models.Blob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ? AND ref_count <= 0", hash).Take(&b).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var refs int64
+		if err := tx.Model(&models.Files{}).Where("hash = ?", hash).Count(&refs).Error; err != nil {
+			return err
+		}
+		if refs > 0 {
+			log.L().Warn("blob ref count drifted, fixed", zap.String("hash", hash), zap.Int64("refs", refs))
+			return tx.Model(&b).UpdateColumn("ref_count", refs).Error
+		}
+		marked = true
+		return tx.Model(&b).UpdateColumn("ref_count", models.BlobCollecting).Error
+	})
+	if err != nil || !marked {
+		return err
+	}
+
+	var thumbs string
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		var b models.Blob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ? AND ref_count = ?", hash, models.BlobCollecting).Take(&b).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // 期间又有上传引用了该内容
+		}
+		if err != nil {
+			return err
+		}
+		if err := global.Storage.Delete(context.Background(), b.Path); err != nil {
+			return err
+		}
+		thumbs = b.Thumbs
+		return tx.Delete(&b).Error
+	})
+	if err != nil {
+		return err
+	}
+	if thumbs != "" {
+		deleteThumbnails(hash, ParseThumbs(thumbs))
+	}
+	return nil
+}
+
+func startBlobGC() {
+	go func() {
+		ticker := time.NewTicker(BlobGCInterval)
+		defer ticker.Stop()
+		for {
+			collectOrphanBlobs()
+			migrateLegacyFiles()
+			<-ticker.C
+		}
+	}()
+}
+
+// 回收引用数为 0 的内容（删除文件后即时回收失败的会在这里重试）
+func collectOrphanBlobs() {
+	var hashes []string
+	if err := global.DB.Model(&models.Blob{}).Where("ref_count <= 0").
+		Limit(BlobGCBatchSize).Pluck("hash", &hashes).Error; err != nil {
+		log.L().Error("query orphan blobs failed", zap.Error(err))
+		return
+	}
+	for _, h := range hashes {
+		if err := CollectBlob(h); err != nil {
+			log.L().Warn("collect blob failed", zap.String("hash", h), zap.Error(err))
+		}
+	}
+}
+
+// 去重上线前上传的文件没有哈希，逐批计算后移入 blobs；原文件在没有其他记录引用时删除
+func migrateLegacyFiles() {
+	var files []models.Files
+	if err := global.DB.Where("hash = '' OR hash IS NULL").Order("id").
+		Limit(BlobGCBatchSize).Find(&files).Error; err != nil {
+		log.L().Error("query legacy files failed", zap.Error(err))
+		return
+	}
+	for i := range files {
+		if err := migrateLegacyFile(context.Background(), global.Storage, global.Storage, &files[i], true); err != nil {
+			log.L().Warn("migrate legacy file failed", zap.Uint("file_id", files[i].ID), zap.Error(err))
+		}
+	}
+}
+
+// 从 from 读取旧文件，计算哈希后作为内容存入 to 并改写记录的 FilePath；removeSource 时在没有其他记录引用时删除原文件
+func migrateLegacyFile(ctx context.Context, from, to storage.Storage, f *models.Files, removeSource bool) error {
+	obj, err := from.Get(ctx, f.FilePath)
+	if err != nil {
+		return err // 缺失的文件由存储一致性检查报告和处理
+	}
+	tmpPath, hash, written, err := CopyToTemp(obj, 0, 0)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		key, err := attachBlob(ctx, tx, to, tmpPath, hash, written)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Files{}).Where("id = ?", f.ID).
+			Updates(map[string]any{"hash": hash, "file_path": key, "file_size": written}).Error
+	})
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("attach blob: %w", err)
+	}
+	if !removeSource {
+		return nil
+	}
+	// 旧版上传同名文件会覆盖磁盘文件，多条记录可能指向同一路径
+	var others int64
+	global.DB.Model(&models.Files{}).Where("file_path = ?", f.FilePath).Count(&others)
+	if others == 0 {
+		return from.Delete(ctx, f.FilePath)
+	}
+	return nil
+}
+
+// CopyToTemp 把内容写入上传目录下 blobs 子目录中的本地临时文件并计算 SHA-256，之后交给 AttachBlob
+func CopyToTemp(src io.Reader, maxSize, expectedSize int64) (tmpPath, hash string, written int64, err error) {
+	blobRoot := filepath.Join(AppConfig.Upload.Storagepath, BlobDir)
+	if err = os.MkdirAll(blobRoot, 0755); err != nil {
+		return "", "", 0, err
+	}
+	tmp, err := os.CreateTemp(blobRoot, ".upload-*.part")
+	if err != nil {
+		return "", "", 0, err
+	}
+	hash, written, err = utils.CopyWithHash(tmp, src, maxSize, expectedSize)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", written, err
+	}
+	return tmp.Name(), hash, written, nil
+}
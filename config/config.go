@@ -53,14 +53,140 @@ type Config struct { //标明这个配置文件是可以全局使用的
 		TotalSize int
 		FileSize  int
 		Storagepath string
+		ChunkSize          int        // 分片上传的分片大小（MB）
+		ResumableFileSize  int        // 分片上传的单个文件上限（MB），为 0 时与 FileSize 相同
+		Driver             string     // 存储后端：local（默认）或 s3
+		PresignDownloads   bool       // 后端支持时下载接口重定向到预签名链接，由对象存储直接输出文件
+		S3                 S3Config   // driver 为 s3 时的连接参数
+		ThumbnailSizes     []int      // 图片缩略图的边长（像素），依次对应 size=sm/md/lg
+		StripGPS           bool       // 下载 JPEG 时抹去 EXIF 中的 GPS 定位信息，存储的原件不变
+		TrashRetentionDays int        // 回收站中的文件保留天数，到期后彻底删除
+		CheckIntervalHours int        // 定时检查存储一致性的间隔（小时），0 为不定时检查
+		CheckRepair        bool       // 定时检查时直接修复，否则只生成报告
+		Scan               ScanConfig // 上传内容扫描
+	}
+	Jwt struct {
+		CurrentKid       string         // 当前用于签发的密钥 kid
+		Keys             []JWTKeyConfig // 当前密钥 + 仍需校验的历史密钥
+		MaxPrevious      int            // 轮换后最多保留的历史密钥数量
+		AccessTTLMinutes int            // 访问令牌有效期（分钟）
+		RefreshTTLHours  int            // 刷新令牌有效期（小时）
+		EncryptionKey    string         // 加密数据库中轮换出的签名密钥，至少 32 字节的随机字符串
+	}
+	Account struct {
+		DeletionGraceDays    int // 注销后的冷静期（天），期间登录即可撤销注销
+		PurgeIntervalMinutes int // 清理到期账号的间隔（分钟）
+	}
+	Oidc struct {
+		Providers []OIDCProviderConfig // 可用的第三方身份提供方
+	}
+	Cookie struct {
+		Secure bool // 只通过 HTTPS 发送 cookie，生产环境使用 HTTPS 时开启
+	}
+	Registration struct {
+		Mode     string         // open / invite / approval / closed
+		Password PasswordPolicy // 注册、修改和重置密码时的密码规则
+	}
+	RateLimit struct {
+		Enabled  bool
+		Policies map[string]RateLimitPolicy // 策略名 -> 限流规则，路由中通过 middlewares.RateLimit("策略名") 引用
 	}
 }
+
+type JWTKeyConfig struct {
+	Kid    string
+	Secret string
+}
+
+// 密码强度规则，长度按字符计算
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int  // bcrypt 只使用前72字节，超过的部分不参与校验
+	RequireUpper   bool // 至少一个大写字母
+	RequireLower   bool // 至少一个小写字母
+	RequireDigit   bool // 至少一个数字
+	RequireSymbol  bool // 至少一个非字母数字的字符
+	RejectUsername bool // 不能包含用户名
+}
+
+// S3Config 兼容 S3 协议的对象存储（AWS S3、MinIO 等）
+type S3Config struct {
+	Endpoint  string // 如 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // MinIO 需要开启
+	Prefix    string // 对象 key 的公共前缀
+}
+
+// ScanConfig 上传内容扫描，扫描在文件写入数据库之前进行
+type ScanConfig struct {
+	Magic   bool   // 检查文件头与扩展名是否一致
+	Clamd   string // ClamAV clamd 地址：tcp://host:port 或 unix:///path，为空不启用
+	Timeout int    // 单个文件的扫描超时（秒）
+}
+
+// 滑动窗口限流规则：Window 秒内最多 Limit 次请求；设置 Concurrent 时改为限制本进程同时处理的请求数
+type RateLimitPolicy struct {
+	Limit      int
+	Window     int    // 窗口长度（秒）
+	Key        string // 计数维度：user（未登录时按IP）、ip、route（所有人共享）
+	PerRoute   bool   // 同一策略下每个接口单独计数
+	Concurrent int    // 同时处理的请求数上限，用于保护耗时随上游变化的接口；Limit、Window、Key 不再使用
+}
+
+type OIDCProviderConfig struct {
+	Name         string   // 路由中的名字：/api/auth/oidc/:provider
+	DisplayName  string   // 登录页按钮上的名字
+	Issuer       string   // 例如 https://idp.example.com/realms/team
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // 必须与身份提供方登记的一致：.../api/auth/oidc/:provider/callback
+	Scopes       []string // 默认 openid profile email
+	AllowSignup  bool     // 首次登录时自动创建普通用户
+}
 var AppConfig *Config //创建配置文件-指针全局可以修改并且避免拷贝-配置句柄
 
 var ConfigChoice = "config_docker"
 
 // 使用viper读取配置文件
 func InitConfig() {
+	readConfig()
+	// LocalAPIKey = AppConfig.Api.LocalKey //设置定位的api密钥
+	initPath()
+	initStorage()
+	initScanners()
+	initDB()
+	initRedis()
+	initUserCache(lru_size)
+	runMigrations()
+	superadmin_init()
+	initJWTKeys()
+	utils.CookieSecure = AppConfig.Cookie.Secure
+	initRegistration()
+	initOIDCProviders()
+	startAccountPurger()
+	startExportCleaner()
+	startUploadCleaner()
+	startBlobGC()
+	startMediaWorker()
+	startTrashPurger()
+	startStorageChecker()
+	startScanRetry()
+	printURL()
+}
+
+// InitForCommand 供命令行工具使用：只读取配置、初始化存储并连接数据库，不启动后台任务
+func InitForCommand() {
+	readConfig()
+	initPath()
+	initStorage()
+	initDB()
+	runMigrations()
+}
+
+func readConfig() {
 	viper.SetConfigName(ConfigChoice) //无extension
 	viper.SetConfigType("yml")
 	viper.AddConfigPath("./config")
@@ -73,15 +199,6 @@ func InitConfig() {
 	if err := viper.Unmarshal(AppConfig); err != nil { //将配置文件中的内容解析到结构体中
 		log.Fatalf("Error unmarshalling config file: %v", err)
 	}
-	// LocalAPIKey = AppConfig.Api.LocalKey //设置定位的api密钥
-	initPath()
-	initDB()
-	initRedis()
-	initUserCache(lru_size)
-	// ensureCleanupRunning() //定时清理限流器
-	runMigrations()
-	superadmin_init()
-	printURL()
 }
 func GetPort() string {
 	if AppConfig == nil || AppConfig.App.Port == "" { //要么配置为空要么端口无
@@ -134,7 +251,7 @@ func superadmin_init() {
 	default:
 		// 3) 已存在：若软删除则恢复
 		if u.DeletedAt.Valid {
-			if err := global.DB.Unscoped().Model(&u).Update("deleted_at", nil).Error; err != nil {
+			if err := global.DB.Unscoped().Model(&u).Updates(map[string]any{"deleted_at": nil, "deletion_scheduled_at": nil}).Error; err != nil {
 				log.Fatalf("undelete superadmin failed: %v", err)
 			}
 		}
@@ -150,6 +267,7 @@ func superadmin_init() {
 			if err := global.DB.Model(&u).Updates(updates).Error; err != nil {
 				log.Fatalf("update superadmin failed: %v", err)
 			}
+			ClearUserCache(username) // Redis 中可能残留重启前的角色
 		}
 	}
 
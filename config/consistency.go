@@ -0,0 +1,546 @@
+package config
+
+// 存储一致性检查：对账 files/blobs 表与上传目录、存储后端，找出孤儿文件、残留的 .part 临时文件、
+// 缺失的内容以及大小或哈希不符的内容。试运行只生成报告；修复时孤儿文件与损坏的内容移入 quarantine 目录，
+// 残留的临时文件直接删除，内容缺失或损坏的文件记录删除并释放引用。缺失的内容过多时多半是存储路径或 bucket 配置错误，
+// 这时不删除任何记录，检查标记为失败
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/storage"
+	"project/utils"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrStorageCheckRunning = errors.New("storage check is already running")
+
+// StorageCheckOptions 检查选项
+type StorageCheckOptions struct {
+	DryRun     bool   // 只报告，不修复
+	VerifyHash bool   // 读取全部内容重新计算 SHA-256，耗时与存储量成正比
+	Trigger    string // models.StorageCheckManual / StorageCheckSchedule
+	ActorID    *uint
+}
+
+// StorageIssue 检查发现的一个问题
+type StorageIssue struct {
+	Kind   string `json:"kind"` // models.IssueOrphan 等
+	Key    string `json:"key"`  // 相对上传目录的路径或存储 key
+	Size   int64  `json:"size"`
+	Detail string `json:"detail,omitempty"`
+	Action string `json:"action,omitempty"` // 修复时的处理：quarantined / deleted / removed_records / fixed_size / failed
+}
+
+type storageChecker struct {
+	ctx        context.Context
+	rec        *models.StorageCheck
+	opt        StorageCheckOptions
+	issues     []StorageIssue
+	quarantine string // 本次检查的隔离目录，相对上传目录
+	missing    []missingItem
+}
+
+// 内容缺失的问题先记下，全部检查完、确认缺失数量正常后才删除记录
+type missingItem struct {
+	issue  StorageIssue
+	remove func(issue *StorageIssue)
+}
+
+// StartStorageCheck 创建检查记录并在后台执行；已有检查在运行时返回 ErrStorageCheckRunning
+func StartStorageCheck(opt StorageCheckOptions) (*models.StorageCheck, error) {
+	ok, err := global.RedisDB.SetNX(RedisStorageCheckLock, "1", StorageCheckLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrStorageCheckRunning
+	}
+	rec := &models.StorageCheck{
+		Trigger:    opt.Trigger,
+		ActorID:    opt.ActorID,
+		DryRun:     opt.DryRun,
+		VerifyHash: opt.VerifyHash,
+		Status:     models.StorageCheckRunning,
+		StartedAt:  time.Now(),
+	}
+	if err := global.DB.Create(rec).Error; err != nil {
+		global.RedisDB.Del(RedisStorageCheckLock)
+		return nil, err
+	}
+	snapshot := *rec
+	go func() {
+		stop := make(chan struct{})
+		go keepStorageCheckLock(stop)
+		defer global.RedisDB.Del(RedisStorageCheckLock)
+		defer close(stop)
+		runStorageCheck(&snapshot, opt)
+	}()
+	return rec, nil
+}
+
+// 检查期间定时续期锁，校验哈希等耗时较长的检查不会因锁过期而与下一次检查同时运行
+func keepStorageCheckLock(stop <-chan struct{}) {
+	ticker := time.NewTicker(StorageCheckLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := global.RedisDB.Expire(RedisStorageCheckLock, StorageCheckLockTTL).Err(); err != nil {
+				log.L().Warn("refresh storage check lock failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 启动时把中断的检查标记为失败；配置了 upload.checkIntervalHours 时定时检查
+func startStorageChecker() {
+	global.DB.Model(&models.StorageCheck{}).Where("status = ?", models.StorageCheckRunning).
+		Updates(map[string]any{"status": models.StorageCheckFailed, "error": "interrupted by server restart"})
+	hours := AppConfig.Upload.CheckIntervalHours
+	if hours <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			_, err := StartStorageCheck(StorageCheckOptions{DryRun: !AppConfig.Upload.CheckRepair, Trigger: models.StorageCheckSchedule})
+			if err != nil && !errors.Is(err, ErrStorageCheckRunning) {
+				log.L().Warn("start scheduled storage check failed", zap.Error(err))
+			}
+		}
+	}()
+}
+
+func runStorageCheck(rec *models.StorageCheck, opt StorageCheckOptions) {
+	sc := &storageChecker{
+		ctx:        context.Background(),
+		rec:        rec,
+		opt:        opt,
+		quarantine: path.Join(QuarantineDir, fmt.Sprintf("%s-%d", rec.StartedAt.Format("20060102-150405"), rec.ID)),
+	}
+	err := sc.run()
+	now := time.Now()
+	rec.FinishedAt = &now
+	rec.Status = models.StorageCheckDone
+	if err != nil {
+		rec.Status = models.StorageCheckFailed
+		rec.Error = truncateError(err)
+	}
+	if b, jerr := json.Marshal(sc.issues); jerr == nil {
+		rec.Issues = string(b)
+	}
+	if err := global.DB.Save(rec).Error; err != nil {
+		log.L().Error("save storage check failed", zap.Uint("id", rec.ID), zap.Error(err))
+	}
+	log.L().Info("storage check finished",
+		zap.Uint("id", rec.ID), zap.Bool("dry_run", rec.DryRun), zap.String("status", rec.Status),
+		zap.Int("orphans", rec.Orphans), zap.Int("stale_parts", rec.StaleParts),
+		zap.Int("missing", rec.Missing), zap.Int("mismatches", rec.Mismatches),
+		zap.Int("repaired", rec.Repaired), zap.Int("failed", rec.Failed))
+}
+
+func truncateError(err error) string {
+	return utils.TruncateUTF8(err.Error(), 255)
+}
+
+func (sc *storageChecker) run() error {
+	refs, err := loadStorageRefs()
+	if err != nil {
+		return fmt.Errorf("load references: %w", err)
+	}
+	if err := sc.walkDisk(refs); err != nil {
+		return fmt.Errorf("walk upload dir: %w", err)
+	}
+	if err := sc.checkBlobs(); err != nil {
+		return fmt.Errorf("check blobs: %w", err)
+	}
+	if err := sc.checkLegacyFiles(); err != nil {
+		return fmt.Errorf("check legacy files: %w", err)
+	}
+	if err := sc.checkDanglingFiles(); err != nil {
+		return fmt.Errorf("check dangling files: %w", err)
+	}
+	return sc.removeMissing()
+}
+
+// 记录内容缺失的问题；修复时先记下处理方式，由 removeMissing 统一执行
+func (sc *storageChecker) reportMissing(issue StorageIssue, remove func(issue *StorageIssue)) {
+	if sc.opt.DryRun {
+		sc.report(issue)
+		return
+	}
+	sc.missing = append(sc.missing, missingItem{issue: issue, remove: remove})
+}
+
+// 缺失数量超过上限时只报告不删除：存储路径或 bucket 配置错误会让全部内容看起来都缺失
+func (sc *storageChecker) removeMissing() error {
+	n := len(sc.missing)
+	if n == 0 {
+		return nil
+	}
+	if n > StorageCheckMaxMissing || n*100 > sc.rec.Checked*StorageCheckMaxMissingPct {
+		for _, m := range sc.missing {
+			sc.report(m.issue)
+		}
+		log.L().Error("storage check found too many missing items, records kept",
+			zap.Uint("id", sc.rec.ID), zap.Int("missing", n), zap.Int("checked", sc.rec.Checked))
+		return fmt.Errorf("%d of %d checked items are missing, refusing to remove records; check the storage configuration", n, sc.rec.Checked)
+	}
+	for _, m := range sc.missing {
+		issue := m.issue
+		m.remove(&issue)
+		sc.report(issue)
+	}
+	return nil
+}
+
+// 记录问题并计数；明细条数有上限，计数不受影响
+func (sc *storageChecker) report(issue StorageIssue) {
+	switch issue.Kind {
+	case models.IssueOrphan:
+		sc.rec.Orphans++
+	case models.IssueStalePart:
+		sc.rec.StaleParts++
+	case models.IssueMissing:
+		sc.rec.Missing++
+	case models.IssueMismatch:
+		sc.rec.Mismatches++
+	}
+	switch {
+	case issue.Action == "failed":
+		sc.rec.Failed++
+	case issue.Action != "":
+		sc.rec.Repaired++
+	}
+	if len(sc.issues) < StorageCheckMaxIssues {
+		sc.issues = append(sc.issues, issue)
+	}
+}
+
+// 上传目录中被记录引用的全部路径：内容、缩略图、旧文件、分片上传与数据导出的临时文件
+func loadStorageRefs() (map[string]bool, error) {
+	refs := map[string]bool{}
+	last := ""
+	for {
+		var blobs []models.Blob
+		if err := global.DB.Select("hash", "path", "thumbs").Where("hash > ?", last).
+			Order("hash").Limit(BlobGCBatchSize).Find(&blobs).Error; err != nil {
+			return nil, err
+		}
+		for _, b := range blobs {
+			last = b.Hash
+			refs[path.Clean(b.Path)] = true
+			for _, size := range ParseThumbs(b.Thumbs) {
+				refs[ThumbnailKey(b.Hash, size)] = true
+			}
+		}
+		if len(blobs) < BlobGCBatchSize {
+			break
+		}
+	}
+	var keys []string
+	if err := global.DB.Model(&models.Files{}).Where("hash = '' OR hash IS NULL").Pluck("file_path", &keys).Error; err != nil {
+		return nil, err
+	}
+	var more []string
+	if err := global.DB.Model(&models.UploadSession{}).Pluck("temp_path", &more).Error; err != nil {
+		return nil, err
+	}
+	keys = append(keys, more...)
+	more = nil
+	if err := global.DB.Model(&models.ExportJob{}).Where("file_path <> ''").Pluck("file_path", &more).Error; err != nil {
+		return nil, err
+	}
+	for _, k := range append(keys, more...) {
+		refs[path.Clean(filepath.ToSlash(k))] = true
+	}
+	return refs, nil
+}
+
+// 遍历上传目录，找出没有记录引用的文件与残留的 .part 临时文件；存储后端为 s3 时这里只会发现本地的临时文件与旧文件
+func (sc *storageChecker) walkDisk(refs map[string]bool) error {
+	root := AppConfig.Upload.Storagepath
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	now := time.Now()
+	return filepath.WalkDir(root, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.L().Warn("walk upload dir failed", zap.String("path", full), zap.Error(err))
+			return nil
+		}
+		rel, rerr := filepath.Rel(root, full)
+		if rerr != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == QuarantineDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sc.rec.Scanned++
+		if refs[rel] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		age := now.Sub(info.ModTime())
+		if strings.HasSuffix(rel, ".part") {
+			if age < StalePartAge {
+				return nil // 可能仍在写入
+			}
+			issue := StorageIssue{Kind: models.IssueStalePart, Key: rel, Size: info.Size()}
+			if !sc.opt.DryRun {
+				issue.Action = "deleted"
+				if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+					issue.Action, issue.Detail = "failed", err.Error()
+				}
+			}
+			sc.report(issue)
+			return nil
+		}
+		if age < OrphanGracePeriod {
+			return nil
+		}
+		issue := StorageIssue{Kind: models.IssueOrphan, Key: rel, Size: info.Size()}
+		if !sc.opt.DryRun {
+			issue.Action = "quarantined"
+			if err := sc.quarantineLocal(full, rel); err != nil {
+				issue.Action, issue.Detail = "failed", err.Error()
+			}
+		}
+		sc.report(issue)
+		return nil
+	})
+}
+
+// 把上传目录中的文件移入隔离目录，保留原来的相对路径
+func (sc *storageChecker) quarantineLocal(full, rel string) error {
+	dst, err := utils.SafeJoinRel(AppConfig.Upload.Storagepath, path.Join(sc.quarantine, rel))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(full, dst)
+}
+
+// 把存储后端中的对象复制到本地隔离目录后删除，用于大小或哈希不符的内容
+func (sc *storageChecker) quarantineObject(key string) error {
+	dst, err := utils.SafeJoinRel(AppConfig.Upload.Storagepath, path.Join(sc.quarantine, key))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	obj, err := global.Storage.Get(sc.ctx, key)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		obj.Close()
+		return err
+	}
+	_, err = io.Copy(out, obj)
+	obj.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return global.Storage.Delete(sc.ctx, key)
+}
+
+// 核对 blobs 表中仍被引用的内容；引用数为 0 的内容由回收任务处理
+func (sc *storageChecker) checkBlobs() error {
+	last := ""
+	for {
+		var blobs []models.Blob
+		if err := global.DB.Where("hash > ? AND ref_count > 0", last).
+			Order("hash").Limit(BlobGCBatchSize).Find(&blobs).Error; err != nil {
+			return err
+		}
+		for _, b := range blobs {
+			last = b.Hash
+			sc.rec.Checked++
+			sc.checkBlob(b)
+		}
+		if len(blobs) < BlobGCBatchSize {
+			return nil
+		}
+	}
+}
+
+func (sc *storageChecker) checkBlob(b models.Blob) {
+	info, err := global.Storage.Stat(sc.ctx, b.Path)
+	if errors.Is(err, storage.ErrNotExist) {
+		sc.reportMissing(StorageIssue{Kind: models.IssueMissing, Key: b.Path, Size: b.Size, Detail: "blob " + b.Hash},
+			func(issue *StorageIssue) { sc.removeBlobRecords(issue, b.Hash) })
+		return
+	}
+	if err != nil {
+		log.L().Warn("stat blob failed", zap.String("hash", b.Hash), zap.Error(err))
+		sc.rec.Failed++
+		return
+	}
+	detail := ""
+	if info.Size != b.Size {
+		detail = fmt.Sprintf("size %d, expected %d", info.Size, b.Size)
+	} else if sc.opt.VerifyHash {
+		sum, err := sc.hashObject(b.Path)
+		if err != nil {
+			log.L().Warn("hash blob failed", zap.String("hash", b.Hash), zap.Error(err))
+			sc.rec.Failed++
+			return
+		}
+		if sum != b.Hash {
+			detail = "sha256 " + sum
+		}
+	}
+	if detail == "" {
+		return
+	}
+	issue := StorageIssue{Kind: models.IssueMismatch, Key: b.Path, Size: info.Size, Detail: detail}
+	if !sc.opt.DryRun {
+		// 损坏的内容不能再提供下载：移入隔离目录后按缺失处理
+		if err := sc.quarantineObject(b.Path); err != nil {
+			issue.Action, issue.Detail = "failed", detail+"; "+err.Error()
+		} else {
+			sc.removeBlobRecords(&issue, b.Hash)
+		}
+	}
+	sc.report(issue)
+}
+
+func (sc *storageChecker) hashObject(key string) (string, error) {
+	obj, err := global.Storage.Get(sc.ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	sum, _, err := utils.CopyWithHash(io.Discard, obj, 0, 0)
+	return sum, err
+}
+
+// 删除引用该内容的全部文件记录（含回收站中的），之后回收内容记录
+func (sc *storageChecker) removeBlobRecords(issue *StorageIssue, hash string) {
+	var files []models.Files
+	if err := global.DB.Where("hash = ?", hash).Find(&files).Error; err != nil {
+		issue.Action, issue.Detail = "failed", err.Error()
+		return
+	}
+	ids := make([]string, 0, len(files))
+	for i := range files {
+		if err := DeleteFileRecord(&files[i]); err != nil {
+			issue.Action, issue.Detail = "failed", err.Error()
+			return
+		}
+		ids = append(ids, fmt.Sprint(files[i].ID))
+	}
+	// 引用数有偏差时 CollectBlob 会拒绝回收，这里已确认没有记录引用
+	if err := global.DB.Model(&models.Blob{}).Where("hash = ?", hash).UpdateColumn("ref_count", 0).Error; err != nil {
+		issue.Action, issue.Detail = "failed", err.Error()
+		return
+	}
+	if err := CollectBlob(hash); err != nil {
+		issue.Action, issue.Detail = "failed", err.Error()
+		return
+	}
+	issue.Action = "removed_records"
+	if len(ids) > 0 {
+		issue.Detail += "; files " + strings.Join(ids, ",")
+	}
+}
+
+// 核对没有哈希的旧文件（去重上线前上传，尚未被回收任务迁移）
+func (sc *storageChecker) checkLegacyFiles() error {
+	lastID := uint(0)
+	for {
+		var files []models.Files
+		if err := global.DB.Where("(hash = '' OR hash IS NULL) AND id > ?", lastID).
+			Order("id").Limit(BlobGCBatchSize).Find(&files).Error; err != nil {
+			return err
+		}
+		for i := range files {
+			f := &files[i]
+			lastID = f.ID
+			sc.rec.Checked++
+			info, err := global.Storage.Stat(sc.ctx, f.FilePath)
+			switch {
+			case errors.Is(err, storage.ErrNotExist):
+				sc.reportMissing(StorageIssue{Kind: models.IssueMissing, Key: f.FilePath, Size: f.FileSize, Detail: fmt.Sprintf("file %d", f.ID)},
+					removeFileRecord(*f))
+			case err != nil:
+				log.L().Warn("stat legacy file failed", zap.Uint("file_id", f.ID), zap.Error(err))
+				sc.rec.Failed++
+			case info.Size != f.FileSize:
+				// 旧文件没有哈希可以校验，以磁盘上的实际大小为准
+				issue := StorageIssue{Kind: models.IssueMismatch, Key: f.FilePath, Size: info.Size,
+					Detail: fmt.Sprintf("file %d size %d, recorded %d", f.ID, info.Size, f.FileSize)}
+				if !sc.opt.DryRun {
+					issue.Action = "fixed_size"
+					if err := global.DB.Model(f).UpdateColumn("file_size", info.Size).Error; err != nil {
+						issue.Action, issue.Detail = "failed", err.Error()
+					}
+				}
+				sc.report(issue)
+			}
+		}
+		if len(files) < BlobGCBatchSize {
+			return nil
+		}
+	}
+}
+
+// 引用了不存在的内容记录的文件
+func (sc *storageChecker) checkDanglingFiles() error {
+	var files []models.Files
+	if err := global.DB.Where("hash <> '' AND hash NOT IN (?)", global.DB.Model(&models.Blob{}).Select("hash")).
+		Limit(StorageCheckMaxIssues).Find(&files).Error; err != nil {
+		return err
+	}
+	for i := range files {
+		f := &files[i]
+		sc.rec.Checked++
+		sc.reportMissing(StorageIssue{Kind: models.IssueMissing, Key: f.FilePath, Size: f.FileSize, Detail: fmt.Sprintf("file %d references unknown blob %s", f.ID, f.Hash)},
+			removeFileRecord(*f))
+	}
+	return nil
+}
+
+func removeFileRecord(f models.Files) func(issue *StorageIssue) {
+	return func(issue *StorageIssue) {
+		issue.Action = "removed_records"
+		if err := DeleteFileRecord(&f); err != nil {
+			issue.Action, issue.Detail = "failed", err.Error()
+		}
+	}
+}
@@ -49,7 +49,25 @@ func runMigrations() {
 		&models.UserArticleRepost{}, //转发关联表
 		&models.Collection{},
 		&models.CollectionItem{},
-		&models.UserCollectionItem{}, //收藏关联表
+		&models.UserCollectionItem{},  //收藏关联表
+		&models.JWTKey{},              // JWT 轮换密钥表
+		&models.RefreshToken{},        // 刷新令牌表
+		&models.RecoveryCode{},        // 两步验证恢复码表
+		&models.PasswordResetToken{},  // 密码重置令牌表
+		&models.AuditLog{},            // 审计日志表
+		&models.ExportJob{},           // 个人数据导出任务表
+		&models.UserIdentity{},        // 第三方登录身份绑定表
+		&models.PersonalAccessToken{}, // 个人访问令牌表
+		&models.Role{},                // 角色表
+		&models.RolePermission{},      // 角色权限表
+		&models.InviteCode{},          // 注册邀请码表
+		&models.UploadSession{},       // 分片上传会话表
+		&models.Blob{},                // 文件内容表（按哈希去重）
+		&models.FileShare{},           // 文件分享链接表
+		&models.Folder{},              // 文件夹表
+		&models.Tag{},                 // 文件标签表
+		&models.FileTag{},             // 文件标签关联表
+		&models.StorageCheck{},        // 存储一致性检查记录表
 	); err != nil {
 		log.L().Error("DataBase connection failed ,got error:", zap.Error(err))
 	}
@@ -61,4 +79,7 @@ func runMigrations() {
 	if err := global.DB.Migrator().AlterColumn(&models.TranslationHistory{}, "TranslatedText"); err != nil {
 		log.L().Warn("alter translation_histories.translated_text failed", zap.Error(err))
 	}
+	// 对象类型字段上线前的审计记录都是针对用户的
+	global.DB.Exec("UPDATE audit_logs SET target_type = ? WHERE target_id IS NOT NULL AND (target_type IS NULL OR target_type = '')", models.AuditTargetUser)
+	seedRoles()
 }
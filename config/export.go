@@ -0,0 +1,45 @@
+package config
+
+// 个人数据导出的清理：生成与下载在 controllers 中处理
+import (
+	"os"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 启动时把中断的任务标记为失败，并定时删除过期的压缩包
+func startExportCleaner() {
+	global.DB.Model(&models.ExportJob{}).
+		Where("status IN ?", []string{models.ExportPending, models.ExportRunning}).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": "interrupted by server restart"})
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			cleanupExpiredExports()
+			<-ticker.C
+		}
+	}()
+}
+
+func cleanupExpiredExports() {
+	var jobs []models.ExportJob
+	if err := global.DB.Where("status = ? AND expires_at <= ?", models.ExportDone, time.Now()).Find(&jobs).Error; err != nil {
+		log.L().Error("query expired exports failed", zap.Error(err))
+		return
+	}
+	for _, j := range jobs {
+		if full, err := utils.SafeJoinRel(AppConfig.Upload.Storagepath, j.FilePath); err == nil {
+			if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+				log.L().Warn("remove export archive failed", zap.String("path", full), zap.Error(err))
+				continue
+			}
+		}
+		global.DB.Model(&j).Updates(map[string]interface{}{"status": models.ExportExpired, "file_path": ""})
+	}
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxPreviousKeys = 3
+	minJWTSecretLen        = 32 // HS256 的密钥不应短于哈希输出的长度
+	placeholderJWTSecret   = "change-me-in-production"
+	sealedJWTSecretPrefix  = "enc:" // 数据库中加密保存的密钥；没有前缀的是早期以明文十六进制保存的
+)
+
+// ErrJWTEncryptionKeyMissing 没有配置 jwt.encryptionKey 时不能把轮换出的密钥写入数据库
+var ErrJWTEncryptionKeyMissing = errors.New("jwt.encryptionKey is not configured")
+
+// 加载密钥环：配置文件中的密钥为基础，数据库里轮换生成的密钥优先
+func initJWTKeys() {
+	if AppConfig.Jwt.AccessTTLMinutes > 0 {
+		utils.AccessTokenTTL = time.Duration(AppConfig.Jwt.AccessTTLMinutes) * time.Minute
+	}
+	if AppConfig.Jwt.RefreshTTLHours > 0 {
+		utils.RefreshTokenTTL = time.Duration(AppConfig.Jwt.RefreshTTLHours) * time.Hour
+	}
+	var current utils.JWTKey
+	var previous []utils.JWTKey
+	for _, k := range AppConfig.Jwt.Keys {
+		if k.Kid == "" || k.Secret == "" {
+			continue
+		}
+		// 弱密钥或示例密钥可以被任何人用来伪造令牌，宁可不启动
+		if k.Secret == placeholderJWTSecret || len(k.Secret) < minJWTSecretLen {
+			log.L().Fatal("jwt secret is a placeholder or too short, use a random string of at least 32 bytes",
+				zap.String("kid", k.Kid), zap.Int("min_length", minJWTSecretLen))
+		}
+		key := utils.JWTKey{Kid: k.Kid, Secret: []byte(k.Secret)}
+		if k.Kid == AppConfig.Jwt.CurrentKid {
+			current = key
+		} else {
+			previous = append(previous, key)
+		}
+	}
+
+	if k := AppConfig.Jwt.EncryptionKey; k != "" && (k == placeholderJWTSecret || len(k) < minJWTSecretLen) {
+		log.L().Fatal("jwt encryption key is a placeholder or too short, use a random string of at least 32 bytes",
+			zap.Int("min_length", minJWTSecretLen))
+	}
+	var rotated []models.JWTKey
+	if err := global.DB.Order("id DESC").Find(&rotated).Error; err != nil {
+		log.L().Error("load rotated jwt keys failed", zap.Error(err))
+	}
+	sealLegacyJWTKeys(rotated)
+	for _, row := range rotated {
+		if row.RetiredAt != nil && time.Since(*row.RetiredAt) > utils.AccessTokenTTL {
+			continue // 已超过校验期的历史密钥不再加载
+		}
+		key, err := jwtKeyFromModel(row)
+		if err != nil {
+			log.L().Warn("skip broken jwt key", zap.String("kid", row.Kid), zap.Error(err))
+			continue
+		}
+		if row.RetiredAt == nil && key.Kid != current.Kid {
+			// 数据库中未退役的密钥是最近一次轮换的结果，覆盖配置里的当前密钥
+			if current.Kid != "" {
+				current.RetiredAt = row.CreatedAt
+				previous = append([]utils.JWTKey{current}, previous...)
+			}
+			current = key
+			continue
+		}
+		previous = append(previous, key)
+	}
+
+	if current.Kid == "" {
+		// 没有配置密钥时生成临时密钥，重启后旧令牌全部失效
+		key, err := utils.NewJWTKey()
+		if err != nil {
+			log.L().Fatal("generate jwt key failed", zap.Error(err))
+		}
+		current = key
+		log.L().Warn("jwt keys are not configured, using an ephemeral key", zap.String("kid", key.Kid))
+	}
+	utils.SetJWTKeys(maxPreviousKeys(), current, previous...)
+	utils.JWTKeyResolver = resolveJWTKey
+	fmt.Println("4. JWT signing keys have been loaded!")
+}
+
+// RotateJWTKey 生成新密钥并加密持久化，旧密钥保留到其签发的令牌过期；没有配置 jwt.encryptionKey 时返回 ErrJWTEncryptionKeyMissing
+func RotateJWTKey() (string, error) {
+	key, err := utils.NewJWTKey()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealJWTSecret(key.Kid, key.Secret)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JWTKey{}).
+			Where("retired_at IS NULL").
+			Update("retired_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.JWTKey{
+			Kid:    key.Kid,
+			Secret: sealed,
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("persist jwt key failed: %w", err)
+	}
+	utils.RotateJWTKey(key, maxPreviousKeys())
+	return key.Kid, nil
+}
+
+func maxPreviousKeys() int {
+	if AppConfig.Jwt.MaxPrevious > 0 {
+		return AppConfig.Jwt.MaxPrevious
+	}
+	return defaultMaxPreviousKeys
+}
+
+// 其他实例轮换后，本实例在本地找不到 kid 时回源数据库
+func resolveJWTKey(kid string) (utils.JWTKey, bool) {
+	var row models.JWTKey
+	if err := global.DB.Where("kid = ?", kid).First(&row).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.L().Warn("resolve jwt key failed", zap.String("kid", kid), zap.Error(err))
+		}
+		return utils.JWTKey{}, false
+	}
+	key, err := jwtKeyFromModel(row)
+	if err != nil {
+		return utils.JWTKey{}, false
+	}
+	if row.RetiredAt != nil && time.Since(*row.RetiredAt) > utils.AccessTokenTTL {
+		return utils.JWTKey{}, false // 已超过校验期
+	}
+	return key, true
+}
+
+func jwtKeyFromModel(row models.JWTKey) (utils.JWTKey, error) {
+	secret, err := openJWTSecret(row.Kid, row.Secret)
+	if err != nil {
+		return utils.JWTKey{}, err
+	}
+	key := utils.JWTKey{Kid: row.Kid, Secret: secret}
+	if row.RetiredAt != nil {
+		key.RetiredAt = *row.RetiredAt
+	}
+	return key, nil
+}
+
+// 由 jwt.encryptionKey 派生 AES-256-GCM 的密钥；数据库泄露时拿不到签名密钥，无法伪造令牌
+func jwtSecretAEAD() (cipher.AEAD, error) {
+	if AppConfig.Jwt.EncryptionKey == "" {
+		return nil, ErrJWTEncryptionKeyMissing
+	}
+	sum := sha256.Sum256([]byte(AppConfig.Jwt.EncryptionKey))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 加密后的格式为 enc: + base64(nonce + 密文)，kid 作为附加数据，密文不能被挪给其他 kid 使用
+func sealJWTSecret(kid string, secret []byte) (string, error) {
+	aead, err := jwtSecretAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealedJWTSecretPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, secret, []byte(kid))), nil
+}
+
+func openJWTSecret(kid, stored string) ([]byte, error) {
+	enc, ok := strings.CutPrefix(stored, sealedJWTSecretPrefix)
+	if !ok {
+		return hex.DecodeString(stored)
+	}
+	aead, err := jwtSecretAEAD()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed jwt secret is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(kid))
+}
+
+// 早期明文保存的密钥：配置了 jwt.encryptionKey 后启动时改为加密保存，否则提示配置
+func sealLegacyJWTKeys(rows []models.JWTKey) {
+	for i := range rows {
+		row := &rows[i]
+		if strings.HasPrefix(row.Secret, sealedJWTSecretPrefix) {
+			continue
+		}
+		secret, err := hex.DecodeString(row.Secret)
+		if err != nil {
+			continue
+		}
+		sealed, err := sealJWTSecret(row.Kid, secret)
+		if err != nil {
+			log.L().Warn("jwt key is stored in plaintext, configure jwt.encryptionKey to encrypt it", zap.String("kid", row.Kid), zap.Error(err))
+			continue
+		}
+		if err := global.DB.Model(&models.JWTKey{}).Where("id = ?", row.ID).Update("secret", sealed).Error; err != nil {
+			log.L().Warn("encrypt jwt key failed", zap.String("kid", row.Kid), zap.Error(err))
+			continue
+		}
+		row.Secret = sealed
+	}
+}
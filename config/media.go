@@ -0,0 +1,204 @@
+package config
+
+// 图片的后台处理：上传后读取尺寸与 EXIF、生成缩略图，缩略图以 thumbs/ 开头的 key 与内容存放在同一存储后端。
+// 处理结果记在 blobs 表上，相同内容只处理一次
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"project/global"
+	"project/log"
+	"project/media"
+	"project/models"
+	"project/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 未配置 upload.thumbnailSizes 时的缩略图边长，依次对应 size=sm/md/lg
+var defaultThumbnailSizes = []int{128, 320, 800}
+
+// 生成缩略图的类型（http.DetectContentType 的结果）
+var thumbnailTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+var mediaQueue = make(chan string, MediaQueueSize)
+
+// ThumbnailSizes 配置的缩略图边长，从小到大
+func ThumbnailSizes() []int {
+	var sizes []int
+	for _, s := range AppConfig.Upload.ThumbnailSizes {
+		if s > 0 && s <= MediaMaxThumbnail && !slices.Contains(sizes, s) {
+			sizes = append(sizes, s)
+		}
+	}
+	if len(sizes) == 0 {
+		return defaultThumbnailSizes
+	}
+	slices.Sort(sizes)
+	return sizes
+}
+
+// ThumbnailKey 缩略图在存储后端中的 key
+func ThumbnailKey(hash string, size int) string {
+	return path.Join(ThumbDir, hash[:2], hash, strconv.Itoa(size)+".jpg")
+}
+
+// ParseThumbs 解析 blobs.thumbs 中记录的已生成边长
+func ParseThumbs(s string) []int {
+	var out []int
+	for _, v := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// EnqueueMedia 上传完成后提交处理；队列已满时忽略，由定时扫描补上
+func EnqueueMedia(hash string) {
+	if hash == "" {
+		return
+	}
+	select {
+	case mediaQueue <- hash:
+	default:
+	}
+}
+
+// 单个 goroutine 依次处理，避免同时解码多张大图占用过多内存
+func startMediaWorker() {
+	go func() {
+		ticker := time.NewTicker(MediaScanInterval)
+		defer ticker.Stop()
+		scanPendingMedia()
+		for {
+			select {
+			case h := <-mediaQueue:
+				processMedia(h)
+			case <-ticker.C:
+				scanPendingMedia()
+			}
+		}
+	}()
+}
+
+// 处理尚未处理的内容（服务重启前还在队列中的、队列满时被丢弃的）
+func scanPendingMedia() {
+	var hashes []string
+	if err := global.DB.Model(&models.Blob{}).Where("media_status = ? AND ref_count > 0", models.MediaPending).
+		Order("created_at").Limit(BlobGCBatchSize).Pluck("hash", &hashes).Error; err != nil {
+		log.L().Error("query pending media failed", zap.Error(err))
+		return
+	}
+	for _, h := range hashes {
+		processMedia(h)
+	}
+}
+
+func processMedia(hash string) {
+	var b models.Blob
+	if err := global.DB.Where("hash = ? AND media_status = ?", hash, models.MediaPending).Take(&b).Error; err != nil {
+		return // 已处理或已回收
+	}
+	var fileType string
+	global.DB.Model(&models.Files{}).Where("hash = ?", hash).Limit(1).Pluck("file_type", &fileType)
+
+	updates := map[string]any{"media_status": models.MediaNone}
+	if thumbnailTypes[fileType] {
+		var err error
+		if updates, err = generateMedia(context.Background(), &b); err != nil {
+			log.L().Warn("generate thumbnails failed", zap.String("hash", hash), zap.Error(err))
+			return // 读取存储失败等临时错误，留待下次扫描重试
+		}
+	}
+	res := global.DB.Model(&models.Blob{}).Where("hash = ? AND media_status = ?", hash, models.MediaPending).Updates(updates)
+	if res.Error != nil {
+		log.L().Warn("save media info failed", zap.String("hash", hash), zap.Error(res.Error))
+	}
+	if res.Error != nil || res.RowsAffected == 0 {
+		// 处理期间内容已被回收（或保存失败），删除刚写入的缩略图
+		thumbs, _ := updates["thumbs"].(string)
+		deleteThumbnails(hash, ParseThumbs(thumbs))
+	}
+}
+
+// 读取尺寸与 EXIF 并生成各尺寸缩略图；图片本身有问题时返回 failed 状态而不是错误，避免反复重试
+func generateMedia(ctx context.Context, b *models.Blob) (map[string]any, error) {
+	obj, err := global.Storage.Get(ctx, b.Path)
+	if errors.Is(err, storage.ErrNotExist) {
+		return map[string]any{"media_status": models.MediaFailed}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	format, w, h, err := media.Probe(obj)
+	if err != nil {
+		return map[string]any{"media_status": models.MediaFailed}, nil
+	}
+	ex := &media.Exif{}
+	if format == "jpeg" {
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if parsed, err := media.ReadExif(obj); err == nil && parsed != nil {
+			ex = parsed
+		}
+	}
+	if ex.Orientation >= 5 {
+		w, h = h, w
+	}
+	updates := map[string]any{"width": w, "height": h, "has_gps": ex.HasGPS, "media_status": models.MediaFailed}
+	if len(ex.Fields) > 0 {
+		if AppConfig.Upload.StripGPS { // 下载时会抹去定位信息，这里也不保存
+			for k := range ex.Fields {
+				if strings.HasPrefix(k, "GPS") {
+					delete(ex.Fields, k)
+				}
+			}
+		}
+		if raw, err := json.Marshal(ex.Fields); err == nil {
+			updates["exif"] = string(raw)
+		}
+	}
+
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, err := media.Decode(obj, MediaMaxPixels)
+	if err != nil {
+		log.L().Info("image not decodable, skip thumbnails", zap.String("hash", b.Hash), zap.Error(err))
+		return updates, nil
+	}
+	var done []string
+	for _, size := range ThumbnailSizes() {
+		var buf bytes.Buffer
+		if err := media.EncodeJPEG(&buf, media.Orient(media.Resize(img, size), ex.Orientation)); err != nil {
+			return nil, err
+		}
+		if err := global.Storage.Put(ctx, ThumbnailKey(b.Hash, size), &buf, int64(buf.Len())); err != nil {
+			deleteThumbnails(b.Hash, ParseThumbs(strings.Join(done, ",")))
+			return nil, err
+		}
+		done = append(done, strconv.Itoa(size))
+	}
+	updates["thumbs"] = strings.Join(done, ",")
+	updates["media_status"] = models.MediaReady
+	return updates, nil
+}
+
+func deleteThumbnails(hash string, sizes []int) {
+	for _, size := range sizes {
+		if err := global.Storage.Delete(context.Background(), ThumbnailKey(hash, size)); err != nil {
+			log.L().Warn("delete thumbnail failed", zap.String("hash", hash), zap.Int("size", size), zap.Error(err))
+		}
+	}
+}
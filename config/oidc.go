@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"project/log"
+	"project/utils"
+
+	"go.uber.org/zap"
+)
+
+var oidcProviders = map[string]*OIDCProvider{}
+
+// OIDCProvider 身份提供方及其登录策略
+type OIDCProvider struct {
+	*utils.OIDCProvider
+	DisplayName string
+	AllowSignup bool
+}
+
+func initOIDCProviders() {
+	for _, pc := range AppConfig.Oidc.Providers {
+		if pc.Name == "" || pc.Issuer == "" || pc.ClientID == "" || pc.RedirectURL == "" {
+			log.L().Warn("skip incomplete oidc provider", zap.String("name", pc.Name))
+			continue
+		}
+		display := pc.DisplayName
+		if display == "" {
+			display = pc.Name
+		}
+		oidcProviders[pc.Name] = &OIDCProvider{
+			OIDCProvider: utils.NewOIDCProvider(pc.Name, pc.Issuer, pc.ClientID, pc.ClientSecret, pc.RedirectURL, pc.Scopes),
+			DisplayName:  display,
+			AllowSignup:  pc.AllowSignup,
+		}
+	}
+	if len(oidcProviders) > 0 {
+		fmt.Printf("5. %d OIDC provider(s) have been configured!\n", len(oidcProviders))
+	}
+}
+
+// GetOIDCProvider 按名字查找身份提供方
+func GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	p, ok := oidcProviders[name]
+	return p, ok
+}
+
+// OIDCProviders 返回全部身份提供方
+func OIDCProviders() []*OIDCProvider {
+	out := make([]*OIDCProvider, 0, len(oidcProviders))
+	for _, pc := range AppConfig.Oidc.Providers { // 保持配置文件中的顺序
+		if p, ok := oidcProviders[pc.Name]; ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
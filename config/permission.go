@@ -0,0 +1,125 @@
+package config
+
+// 角色与权限：角色保存在数据库中，权限按角色缓存在进程内
+import (
+	"project/global"
+	"project/log"
+	"project/models"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 角色权限缓存有效期：本实例修改角色后立即清空，其他实例最迟在这段时间后生效
+const rolePermsTTL = 30 * time.Second
+
+var rolePerms struct {
+	sync.RWMutex
+	m        map[string]map[string]bool
+	loadedAt time.Time
+}
+
+// seedRoles 把原来写死的三个角色迁移为数据库中的内置角色；超级管理员每次启动都补齐新增的权限
+func seedRoles() {
+	// 角色不再局限于 user/admin/superadmin，去掉旧的 check 约束
+	if global.DB.Migrator().HasConstraint(&models.Users{}, "chk_users_role") {
+		if err := global.DB.Migrator().DropConstraint(&models.Users{}, "chk_users_role"); err != nil {
+			log.L().Warn("drop users role check constraint failed", zap.Error(err))
+		}
+	}
+	defaults := map[string][]string{models.RoleSuperAdmin: nil}
+	for _, p := range models.Permissions {
+		defaults[models.RoleSuperAdmin] = append(defaults[models.RoleSuperAdmin], p.Name)
+	}
+	for name, perms := range models.DefaultRolePermissions {
+		defaults[name] = perms
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		for name, perms := range defaults {
+			role := models.Role{Name: name, Builtin: true}
+			res := tx.Where("name = ?", name).FirstOrCreate(&role)
+			if res.Error != nil {
+				return res.Error
+			}
+			// 已存在的 admin/user 角色保留管理员修改过的权限
+			if res.RowsAffected == 0 && name != models.RoleSuperAdmin {
+				continue
+			}
+			for _, p := range perms {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+					Create(&models.RolePermission{RoleID: role.ID, Permission: p}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.L().Error("seed roles failed", zap.Error(err))
+	}
+}
+
+// 从数据库加载全部角色的权限
+func loadRolePerms() map[string]map[string]bool {
+	var roles []models.Role
+	if err := global.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		log.L().Error("load role permissions failed", zap.Error(err))
+		return nil
+	}
+	m := make(map[string]map[string]bool, len(roles))
+	for _, r := range roles {
+		set := make(map[string]bool, len(r.Permissions))
+		for _, p := range r.Permissions {
+			set[p.Permission] = true
+		}
+		m[r.Name] = set
+	}
+	return m
+}
+
+// RolePermissions 角色拥有的权限集合；角色不存在时返回 nil
+func RolePermissions(role string) map[string]bool {
+	rolePerms.RLock()
+	m, fresh := rolePerms.m, time.Since(rolePerms.loadedAt) < rolePermsTTL
+	rolePerms.RUnlock()
+	if m == nil || !fresh {
+		if loaded := loadRolePerms(); loaded != nil {
+			rolePerms.Lock()
+			rolePerms.m, rolePerms.loadedAt = loaded, time.Now()
+			rolePerms.Unlock()
+			m = loaded
+		}
+	}
+	return m[role]
+}
+
+// HasPermission 角色是否拥有全部指定权限
+func HasPermission(role string, perms ...string) bool {
+	set := RolePermissions(role)
+	for _, p := range perms {
+		if !set[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleExists 角色是否存在
+func RoleExists(role string) bool {
+	return RolePermissions(role) != nil
+}
+
+// RoleRequiresMFA 拥有任意权限的角色（管理类角色）必须绑定两步验证
+func RoleRequiresMFA(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleSuperAdmin || len(RolePermissions(role)) > 0
+}
+
+// InvalidateRolePermissions 角色或权限变更后清空缓存
+func InvalidateRolePermissions() {
+	rolePerms.Lock()
+	rolePerms.m = nil
+	rolePerms.Unlock()
+}
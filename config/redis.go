@@ -29,14 +29,31 @@ const (
 	RedisArticleKey    = "articles:%d"                //判断文章是否存在-bool
 	RedisRepostKey     = "articles:%d:reposts"        //该文章的转发数
 	RedisUserRepostKey = "articles:%d:user:%d:repost" //关联性转发
-	// 时限
-	RedisCommentRate          = "comment:rate:user:%d"
-	RedisRepostRate           = "repost:rate:user:%d"
-	RedisCreateCollectionRate = "collection:rate:user:%d"
-	// 注册登录限流
-	RedisLoginRate        = "login:rate:%s"         // 登录限流 key
-	RedisRegisterRateIP   = "register:rate:ip:%s"   // IP注册限流 key
-	RedisRegisterRateUser = "register:rate:user:%s" // 用户名注册限流 key
+	// 分片上传：同一会话同时只处理一个分片
+	RedisUploadLock = "upload:lock:%d"
+	// 接口限流
+	RedisRateLimit = "ratelimit:%s:%s:%d" // 策略名 + 计数对象 + 窗口序号
+	// 令牌注销黑名单
+	RedisRevokedJTI = "auth:revoked:jti:%s" // 单个访问令牌，保留到令牌过期
+	RedisRevokedSID = "auth:revoked:sid:%s" // 整个会话（刷新令牌家族），保留一个访问令牌有效期
+	// 连续密码错误锁定
+	RedisLoginFail = "login:fail:%s" // 窗口内密码错误次数
+	RedisLoginLock = "login:lock:%s" // 账号临时锁定标记
+	// 两步验证
+	RedisMFAPending = "auth:mfa:%s"     // 密码已通过、等待第二步验证的登录凭据 -> 用户ID
+	RedisTOTPUsed   = "auth:totp:%d:%d" // 用户ID + 时间步，防止验证码在有效期内被重放
+	// 刷新令牌轮换后的宽限期：旧令牌的哈希 -> 轮换出的新令牌
+	RedisRefreshGrace = "auth:refresh:grace:%s"
+	// 个人数据导出
+	RedisExportDownload = "export:download:%s" // 下载令牌 -> 导出任务ID
+	// 文件分享：输入访问密码后的凭据 -> 分享ID
+	RedisShareUnlock = "share:unlock:%s"
+	// 文件分享：已计数的下载下发的续传凭据 -> 分享ID
+	RedisShareResume = "share:resume:%s"
+	// 第三方登录
+	RedisOIDCState = "auth:oidc:state:%s" // 授权请求的 state -> PKCE verifier、nonce 等
+	// 存储一致性检查：同一时间只运行一次
+	RedisStorageCheckLock = "storage:check:lock"
 )
 const (
 	CacheTTL      = 120 * time.Minute // 基本的缓存时间
@@ -47,10 +64,78 @@ const (
 	Article_TTL   = 24 * time.Hour
 	RoleCacheTTL  = 3 * 24 * time.Hour
 	TerminalTTL   = 30 * time.Second //终端限流时间
-	//登录-注册时间限流
-	RedisRegisterRateTTL = time.Minute * 10 //注册登录限流时间
-	RedisRateMaxAttempts = 5                //注册登录限流最大尝试次数
-	RedisWindow          = 60
+	// Redis 不可用时进程内限流最多记录的计数对象数
+	RateLimitLocalSize = 10000
+	// 连续密码错误后的临时锁定
+	LoginFailThreshold = 5                // 窗口内密码错误达到该次数即锁定
+	LoginFailWindow    = 15 * time.Minute // 错误次数的统计窗口
+	LoginLockTTL       = 15 * time.Minute // 锁定时长
+	// 两步验证
+	MFAPendingTTL    = 5 * time.Minute // 第二步验证的时限
+	MFAMaxAttempts   = 5               // 同一登录凭据允许输错验证码的次数
+	RecoveryCodeSize = 10              // 每次生成的恢复码数量
+	// 多个标签页共享 cookie 几乎同时刷新时，刚轮换的旧令牌在这段时间内再次使用会拿到同一个新令牌，而不是判定为重放
+	RefreshReuseGrace = 20 * time.Second
+	// 管理员签发的密码重置令牌有效期
+	PasswordResetTTL = 24 * time.Hour
+	// 个人数据导出
+	ExportLinkTTL       = 15 * time.Minute // 下载链接有效期
+	ExportRetention     = 24 * time.Hour   // 压缩包保留时间
+	ExportMaxConcurrent = 2                // 同时执行的导出任务数
+	ExportDir           = "exports"        // 上传目录下存放压缩包的子目录
+	// 第三方登录授权请求的有效期
+	OIDCStateTTL = 10 * time.Minute
+	// 个人访问令牌
+	PATMaxPerUser    = 20          // 每个用户同时有效的令牌数
+	PATMaxDays       = 365         // 最长有效天数
+	PATTouchInterval = time.Minute // 最近使用时间的最小更新间隔，避免每个请求都写库
+	// 分片上传
+	UploadSessionTTL     = 24 * time.Hour   // 会话闲置超过该时间即清理
+	UploadMaxSessions    = 10               // 每个用户同时进行的上传会话数
+	UploadCleanInterval  = 30 * time.Minute // 清理过期会话的间隔
+	UploadChunkLockTTL   = 5 * time.Minute  // 单个分片的处理时限
+	DefaultUploadChunkMB = 8
+	// 文件内容去重存储
+	BlobDir         = "blobs"   // 上传目录下按哈希存放文件内容的子目录
+	BlobGCInterval  = time.Hour // 回收无引用内容、迁移旧文件的间隔
+	BlobGCBatchSize = 200
+	// 对象存储预签名下载链接的有效期
+	StoragePresignTTL = 5 * time.Minute
+	// 文件分享链接
+	ShareSlugBytes     = 12        // 链接中随机部分的字节数
+	ShareMaxPerUser    = 100       // 每个用户同时有效的分享数
+	ShareUnlockTTL     = time.Hour // 输入密码后免密下载的时长
+	ShareResumeTTL     = time.Hour // 计数后断点续传、拖动进度条不再计数的时长
+	ShareMaxValidHours = 24 * 365  // 有效期上限（小时）
+	// 图片缩略图
+	ThumbDir          = "thumbs"         // 存储后端中缩略图 key 的前缀
+	MediaQueueSize    = 256              // 等待处理的上传数，超出的由定时扫描补上
+	MediaScanInterval = 10 * time.Minute // 扫描未处理内容的间隔
+	MediaMaxPixels    = 40_000_000       // 超过该像素数的图片不解码，只记录尺寸
+	MediaMaxThumbnail = 2048             // 缩略图边长上限
+	ThumbnailCacheAge = 24 * time.Hour
+	// 文件夹、标签与回收站
+	FolderMaxDepth     = 10        // 文件夹最大嵌套层数
+	FolderMaxPerUser   = 1000      // 每个用户的文件夹数
+	TagMaxPerUser      = 200       // 每个用户的标签数
+	FileMaxTags        = 20        // 每个文件的标签数
+	DefaultTrashDays   = 30        // 未配置 upload.trashRetentionDays 时回收站的保留天数
+	TrashPurgeInterval = time.Hour // 清理到期文件的间隔
+	// 打包下载与解压
+	ArchiveMaxEntries = 1000 // 一次打包或解压的文件数上限
+	// 存储一致性检查
+	QuarantineDir         = "quarantine"   // 上传目录下存放隔离文件的子目录，检查时跳过
+	StalePartAge          = 24 * time.Hour // 超过该时间未修改的 .part 临时文件视为残留
+	OrphanGracePeriod     = time.Hour      // 刚写入的文件可能属于尚未提交的上传，不算孤儿
+	StorageCheckLockTTL   = 6 * time.Hour  // 检查进程意外退出时锁的自动释放时间
+	StorageCheckMaxIssues = 1000           // 每次检查保存的问题明细条数
+	// 修复时内容缺失的条数超过该数量或已检查条数的该百分比，视为存储配置错误，不删除任何记录
+	StorageCheckMaxMissing    = 100
+	StorageCheckMaxMissingPct = 10
+	// 上传内容扫描
+	DefaultScanTimeout = time.Minute     // 未配置 upload.scan.timeout 时单个文件的扫描超时
+	ScanRetryInterval  = 5 * time.Minute // 重新扫描待扫描文件的间隔
+	ScanMaxTries       = 12              // 单个文件重新扫描失败的次数上限，超过后隔离
 )
 
 func initRedis() {
@@ -0,0 +1,107 @@
+package config
+
+// 注册方式与密码强度规则
+import (
+	"errors"
+	"fmt"
+	"project/log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// 注册方式
+const (
+	RegistrationOpen     = "open"     // 任何人都可以注册
+	RegistrationInvite   = "invite"   // 需要管理员生成的邀请码
+	RegistrationApproval = "approval" // 注册后等待管理员审核，持有邀请码可免审核
+	RegistrationClosed   = "closed"   // 关闭注册，只能由管理员添加用户
+)
+
+const (
+	defaultPasswordMinLength = 6
+	defaultPasswordMaxLength = 64
+	passwordHashMaxBytes     = 72 // bcrypt 的输入上限
+)
+
+// 校正配置中的注册方式与密码规则，未知的注册方式按关闭处理
+func initRegistration() {
+	r := &AppConfig.Registration
+	r.Mode = strings.ToLower(strings.TrimSpace(r.Mode))
+	switch r.Mode {
+	case "":
+		r.Mode = RegistrationOpen
+	case RegistrationOpen, RegistrationInvite, RegistrationApproval, RegistrationClosed:
+	default:
+		log.L().Warn("unknown registration mode, registration closed", zap.String("mode", r.Mode))
+		r.Mode = RegistrationClosed
+	}
+	p := &r.Password
+	if p.MinLength <= 0 {
+		p.MinLength = defaultPasswordMinLength
+	}
+	if p.MaxLength <= 0 {
+		p.MaxLength = defaultPasswordMaxLength
+	}
+	if p.MaxLength < p.MinLength {
+		p.MaxLength = p.MinLength
+	}
+}
+
+// RegistrationMode 当前的注册方式
+func RegistrationMode() string {
+	if AppConfig == nil || AppConfig.Registration.Mode == "" {
+		return RegistrationOpen
+	}
+	return AppConfig.Registration.Mode
+}
+
+// CurrentPasswordPolicy 当前生效的密码规则
+func CurrentPasswordPolicy() PasswordPolicy {
+	if AppConfig == nil {
+		return PasswordPolicy{MinLength: defaultPasswordMinLength, MaxLength: defaultPasswordMaxLength}
+	}
+	return AppConfig.Registration.Password
+}
+
+// ValidatePassword 按密码规则校验新密码，返回的错误信息可以直接展示给用户
+func ValidatePassword(username, password string) error {
+	p := CurrentPasswordPolicy()
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if n > p.MaxLength || len(password) > passwordHashMaxBytes {
+		return fmt.Errorf("password must be at most %d characters", p.MaxLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsLetter(r), unicode.IsSpace(r): // 中文等无大小写的文字不计入任何一类
+		default:
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return errors.New("password must contain an uppercase letter")
+	case p.RequireLower && !lower:
+		return errors.New("password must contain a lowercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+	if p.RejectUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
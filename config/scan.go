@@ -0,0 +1,149 @@
+package config
+
+// 上传内容扫描：上传的内容写入数据库之前交给 upload.scan 中启用的扫描器检查。
+// 恶意或不符合内容策略的内容拒绝上传；扫描器不可用时文件以待扫描状态保存（不能下载），由后台任务重新扫描
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/scanner"
+	"project/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrUploadRejected 上传内容未通过扫描
+var ErrUploadRejected = errors.New("upload rejected")
+
+var scanners []scanner.Scanner
+
+func initScanners() {
+	scanners = nil
+	c := AppConfig.Upload.Scan
+	if c.Magic {
+		scanners = append(scanners, scanner.NewMagic())
+	}
+	if c.Clamd != "" {
+		clamd, err := scanner.NewClamd(c.Clamd, scanTimeout())
+		if err != nil {
+			log.L().Fatal("init clamd scanner failed", zap.String("address", c.Clamd), zap.Error(err))
+		}
+		if err := clamd.Ping(context.Background()); err != nil {
+			log.L().Warn("clamd is not reachable, uploads will wait for a rescan", zap.String("address", c.Clamd), zap.Error(err))
+		}
+		scanners = append(scanners, clamd)
+	}
+}
+
+func scanTimeout() time.Duration {
+	if AppConfig.Upload.Scan.Timeout > 0 {
+		return time.Duration(AppConfig.Upload.Scan.Timeout) * time.Second
+	}
+	return DefaultScanTimeout
+}
+
+// 依次交给各个扫描器，每个扫描器重新打开内容；第一个非 clean 的结果即为结论
+func scanContent(ctx context.Context, filename string, open func() (io.ReadCloser, error)) (scanner.Result, error) {
+	for _, s := range scanners {
+		r, err := open()
+		if err != nil {
+			return scanner.Result{}, err
+		}
+		sctx, cancel := context.WithTimeout(ctx, scanTimeout())
+		res, err := s.Scan(sctx, filename, r)
+		cancel()
+		r.Close()
+		if err != nil {
+			return scanner.Result{}, fmt.Errorf("%s: %w", s.Name(), err)
+		}
+		if res.Verdict != scanner.Clean {
+			if res.Reason == "" {
+				res.Reason = res.Verdict
+			}
+			res.Reason = s.Name() + ": " + res.Reason
+			return res, nil
+		}
+	}
+	return scanner.Result{Verdict: scanner.Clean}, nil
+}
+
+// ScanUpload 扫描写入本地临时文件的上传内容，返回记录在 Files 上的扫描状态与说明；
+// 内容被拒绝时返回包装了 ErrUploadRejected 的错误，调用方应删除临时文件
+func ScanUpload(ctx context.Context, tmpPath, filename string) (status, detail string, err error) {
+	res, err := scanContent(ctx, filename, func() (io.ReadCloser, error) { return os.Open(tmpPath) })
+	if err != nil {
+		log.L().Warn("scan upload failed, saved as pending", zap.String("filename", filename), zap.Error(err))
+		return models.ScanPending, truncate255("scan failed: " + err.Error()), nil
+	}
+	if res.Verdict != scanner.Clean {
+		log.L().Warn("upload rejected by scanner", zap.String("filename", filename), zap.String("verdict", res.Verdict), zap.String("reason", res.Reason))
+		return "", "", fmt.Errorf("%w: %s", ErrUploadRejected, res.Reason)
+	}
+	return models.ScanClean, "", nil
+}
+
+func truncate255(s string) string {
+	return utils.TruncateUTF8(s, 255)
+}
+
+func startScanRetry() {
+	if len(scanners) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(ScanRetryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rescanPendingFiles()
+		}
+	}()
+}
+
+// 重新扫描上传时扫描器不可用的文件；扫描器仍连接不上时留到下次，单个文件扫描失败的跳过并记录，
+// 多次失败（如超过 clamd 的 StreamMaxLength）或发现问题的转为隔离
+func rescanPendingFiles() {
+	lastID := uint(0)
+	for {
+		var files []models.Files
+		if err := global.DB.Where("scan_status = ? AND id > ?", models.ScanPending, lastID).
+			Order("id").Limit(BlobGCBatchSize).Find(&files).Error; err != nil {
+			log.L().Error("query pending scans failed", zap.Error(err))
+			return
+		}
+		for _, f := range files {
+			lastID = f.ID
+			res, err := scanContent(context.Background(), f.Filename, func() (io.ReadCloser, error) {
+				return global.Storage.Get(context.Background(), f.FilePath)
+			})
+			if errors.Is(err, scanner.ErrUnavailable) {
+				log.L().Warn("scanner unavailable, rescan later", zap.Error(err))
+				return
+			}
+			var update map[string]any
+			switch {
+			case err != nil:
+				log.L().Warn("rescan file failed", zap.Uint("file_id", f.ID), zap.Int("tries", f.ScanTries+1), zap.Error(err))
+				update = map[string]any{"scan_tries": f.ScanTries + 1, "scan_detail": truncate255("scan failed: " + err.Error())}
+				if f.ScanTries+1 >= ScanMaxTries {
+					update["scan_status"] = models.ScanQuarantined
+					update["scan_detail"] = truncate255(fmt.Sprintf("scan failed %d times: %s", f.ScanTries+1, err.Error()))
+				}
+			case res.Verdict != scanner.Clean:
+				update = map[string]any{"scan_status": models.ScanQuarantined, "scan_detail": truncate255(res.Reason)}
+				log.L().Warn("file quarantined by rescan", zap.Uint("file_id", f.ID), zap.String("reason", res.Reason))
+			default:
+				update = map[string]any{"scan_status": models.ScanClean, "scan_detail": "", "scan_tries": 0}
+			}
+			global.DB.Model(&models.Files{}).Where("id = ?", f.ID).Updates(update)
+		}
+		if len(files) < BlobGCBatchSize {
+			return
+		}
+	}
+}
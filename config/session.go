@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"project/global"
+	"project/log"
+	"project/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RevokeAccessToken 把单个访问令牌加入黑名单，直到它自然过期
+func RevokeAccessToken(jti string, expireAt int64) {
+	if jti == "" {
+		return
+	}
+	ttl := time.Until(time.Unix(expireAt, 0))
+	if ttl <= 0 {
+		return // 已经过期，无需记录
+	}
+	if err := global.RedisDB.Set(fmt.Sprintf(RedisRevokedJTI, jti), "1", ttl).Err(); err != nil {
+		log.L().Error("revoke access token failed", zap.Error(err))
+	}
+}
+
+// RevokeSession 注销整个会话：该会话已签发的访问令牌在有效期内全部失效
+func RevokeSession(sid string) {
+	if sid == "" {
+		return
+	}
+	if err := global.RedisDB.Set(fmt.Sprintf(RedisRevokedSID, sid), "1", utils.AccessTokenTTL).Err(); err != nil {
+		log.L().Error("revoke session failed", zap.Error(err))
+	}
+}
+
+// IsAccessTokenRevoked 检查令牌或其会话是否已被注销；Redis 不可用时放行，与限流器的降级策略一致
+func IsAccessTokenRevoked(jti, sid string) bool {
+	keys := make([]string, 0, 2)
+	if jti != "" {
+		keys = append(keys, fmt.Sprintf(RedisRevokedJTI, jti))
+	}
+	if sid != "" {
+		keys = append(keys, fmt.Sprintf(RedisRevokedSID, sid))
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	n, err := global.RedisDB.Exists(keys...).Result()
+	if err != nil {
+		log.L().Warn("check revoked token failed", zap.Error(err))
+		return false
+	}
+	return n > 0
+}
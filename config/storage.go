@@ -0,0 +1,184 @@
+package config
+
+// 文件存储后端的选择，以及在两个后端之间迁移已上传的文件
+import (
+	"context"
+	"fmt"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/storage"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 存储后端
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+func initStorage() {
+	s, err := NewStorage(AppConfig.Upload.Driver)
+	if err != nil {
+		log.L().Fatal("init storage failed", zap.String("driver", AppConfig.Upload.Driver), zap.Error(err))
+	}
+	global.Storage = s
+	log.L().Info("storage ready", zap.String("driver", s.Name()))
+}
+
+// NewStorage 按名字创建存储后端，参数取自 upload 配置；名字为空时使用本地磁盘
+func NewStorage(driver string) (storage.Storage, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", StorageLocal:
+		return storage.NewLocal(AppConfig.Upload.Storagepath), nil
+	case StorageS3:
+		c := AppConfig.Upload.S3
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  c.Endpoint,
+			Region:    c.Region,
+			Bucket:    c.Bucket,
+			AccessKey: c.AccessKey,
+			SecretKey: c.SecretKey,
+			PathStyle: c.PathStyle,
+			Prefix:    c.Prefix,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// MigrateOptions 迁移选项
+type MigrateOptions struct {
+	DryRun       bool // 只统计需要迁移的对象，不写入
+	DeleteSource bool // 复制并校验成功后删除源后端中的对象
+}
+
+// MigrateStats 迁移结果
+type MigrateStats struct {
+	Copied  int // 已复制的内容
+	Skipped int // 目标后端已存在，无需复制
+	Legacy  int // 迁移时计算哈希并改写 FilePath 的旧文件
+	Thumbs  int // 复制的缩略图
+	Failed  int
+}
+
+// MigrateStorage 把 blobs 表中的全部内容及其缩略图从 from 复制到 to（目标已存在且大小一致则跳过），
+// 没有哈希的旧文件顺带计算哈希、存为内容并改写 FilePath。可重复执行；
+// 迁移期间仍在运行的服务会继续写入原后端，切换 upload.driver 前应停止服务再执行一次
+func MigrateStorage(ctx context.Context, from, to storage.Storage, opt MigrateOptions) (MigrateStats, error) {
+	var st MigrateStats
+	last := ""
+	for {
+		var blobs []models.Blob
+		if err := global.DB.Where("hash > ?", last).Order("hash").Limit(BlobGCBatchSize).Find(&blobs).Error; err != nil {
+			return st, err
+		}
+		if len(blobs) == 0 {
+			break
+		}
+		for _, b := range blobs {
+			last = b.Hash
+			copied, err := copyObject(ctx, from, to, b.Path, b.Size, opt)
+			switch {
+			case err != nil:
+				st.Failed++
+				log.L().Warn("migrate blob failed", zap.String("hash", b.Hash), zap.Error(err))
+			case copied:
+				st.Copied++
+			default:
+				st.Skipped++
+			}
+			if err == nil {
+				st.Thumbs += copyThumbnails(ctx, from, to, &b, opt)
+			}
+		}
+	}
+
+	lastID := uint(0)
+	for {
+		var files []models.Files
+		if err := global.DB.Where("(hash = '' OR hash IS NULL) AND id > ?", lastID).Order("id").
+			Limit(BlobGCBatchSize).Find(&files).Error; err != nil {
+			return st, err
+		}
+		if len(files) == 0 {
+			break
+		}
+		for i := range files {
+			lastID = files[i].ID
+			if opt.DryRun {
+				st.Legacy++
+				continue
+			}
+			if err := migrateLegacyFile(ctx, from, to, &files[i], opt.DeleteSource); err != nil {
+				st.Failed++
+				log.L().Warn("migrate legacy file failed", zap.Uint("file_id", files[i].ID), zap.Error(err))
+				continue
+			}
+			st.Legacy++
+		}
+	}
+	return st, nil
+}
+
+// 复制内容的各尺寸缩略图，返回复制的数量；源后端缺少缩略图时重置媒体状态，由后台任务在新后端重新生成
+func copyThumbnails(ctx context.Context, from, to storage.Storage, b *models.Blob, opt MigrateOptions) int {
+	n := 0
+	for _, size := range ParseThumbs(b.Thumbs) {
+		key := ThumbnailKey(b.Hash, size)
+		info, err := from.Stat(ctx, key)
+		if err == nil {
+			var copied bool
+			if copied, err = copyObject(ctx, from, to, key, info.Size, opt); copied {
+				n++
+			}
+		}
+		if err == nil {
+			continue
+		}
+		log.L().Warn("migrate thumbnail failed, will regenerate", zap.String("hash", b.Hash), zap.Int("size", size), zap.Error(err))
+		if !opt.DryRun {
+			global.DB.Model(&models.Blob{}).Where("hash = ?", b.Hash).
+				Updates(map[string]any{"media_status": models.MediaPending, "thumbs": ""})
+		}
+		break
+	}
+	return n
+}
+
+// 复制单个对象并校验大小；返回是否实际复制
+func copyObject(ctx context.Context, from, to storage.Storage, key string, size int64, opt MigrateOptions) (bool, error) {
+	if info, err := to.Stat(ctx, key); err == nil && info.Size == size {
+		if opt.DeleteSource && !opt.DryRun {
+			return false, from.Delete(ctx, key)
+		}
+		return false, nil
+	}
+	if opt.DryRun {
+		return true, nil
+	}
+	obj, err := from.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	err = to.Put(ctx, key, obj, obj.Info().Size)
+	obj.Close()
+	if err != nil {
+		return false, err
+	}
+	info, err := to.Stat(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if info.Size != size {
+		return false, fmt.Errorf("size mismatch after copy: %d != %d", info.Size, size)
+	}
+	if opt.DeleteSource {
+		if err := from.Delete(ctx, key); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
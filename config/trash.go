@@ -0,0 +1,89 @@
+package config
+
+// 文件回收站：删除的文件先移入回收站，保留期满后由定时任务彻底删除并释放内容
+import (
+	"context"
+	"project/global"
+	"project/log"
+	"project/models"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TrashRetention 回收站中文件的保留时长
+func TrashRetention() time.Duration {
+	days := AppConfig.Upload.TrashRetentionDays
+	if days <= 0 {
+		days = DefaultTrashDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DeleteFileRecord 彻底删除文件记录并释放其引用的内容；旧文件（没有哈希）在没有其他记录引用时直接删除
+func DeleteFileRecord(f *models.Files) error {
+	removeLegacy := false
+	if err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", f.ID).Delete(&models.FileTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Files{}, f.ID).Error; err != nil {
+			return err
+		}
+		if f.Hash != "" {
+			return ReleaseBlob(tx, f.Hash, 1)
+		}
+		var others int64
+		if err := tx.Model(&models.Files{}).Where("file_path = ?", f.FilePath).Count(&others).Error; err != nil {
+			return err
+		}
+		removeLegacy = others == 0
+		return nil
+	}); err != nil {
+		return err
+	}
+	// 事务提交后再删除存储中的内容，事务回滚时记录仍然可用；删除失败留下的文件由存储一致性检查处理
+	if removeLegacy {
+		if err := global.Storage.Delete(context.Background(), f.FilePath); err != nil {
+			log.L().Warn("remove legacy file failed", zap.String("path", f.FilePath), zap.Error(err))
+		}
+	}
+	// 回收失败时由定时任务重试
+	if err := CollectBlob(f.Hash); err != nil {
+		log.L().Warn("collect blob failed", zap.String("hash", f.Hash), zap.Error(err))
+	}
+	return nil
+}
+
+func startTrashPurger() {
+	go func() {
+		ticker := time.NewTicker(TrashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			purgeExpiredTrash()
+			<-ticker.C
+		}
+	}()
+}
+
+// 彻底删除保留期已满的文件
+func purgeExpiredTrash() {
+	for {
+		var files []models.Files
+		if err := global.DB.Where("trashed_at IS NOT NULL AND trashed_at < ?", time.Now().Add(-TrashRetention())).
+			Order("id").Limit(BlobGCBatchSize).Find(&files).Error; err != nil {
+			log.L().Error("query expired trash failed", zap.Error(err))
+			return
+		}
+		for i := range files {
+			if err := DeleteFileRecord(&files[i]); err != nil {
+				log.L().Warn("purge trashed file failed", zap.Uint("file_id", files[i].ID), zap.Error(err))
+				return // 下次再试，避免同一批文件反复失败时死循环
+			}
+		}
+		if len(files) < BlobGCBatchSize {
+			return
+		}
+	}
+}
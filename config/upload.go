@@ -0,0 +1,48 @@
+package config
+
+// 分片上传会话的清理：上传本身在 controllers 中处理
+import (
+	"os"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RemoveUploadSession 删除会话及其临时文件
+func RemoveUploadSession(s *models.UploadSession) error {
+	if full, err := utils.SafeJoinRel(AppConfig.Upload.Storagepath, s.TempPath); err == nil {
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return global.DB.Unscoped().Delete(&models.UploadSession{}, s.ID).Error
+}
+
+// 定时清理闲置超时的分片上传会话及其临时文件
+func startUploadCleaner() {
+	go func() {
+		ticker := time.NewTicker(UploadCleanInterval)
+		defer ticker.Stop()
+		for {
+			cleanupExpiredUploads()
+			<-ticker.C
+		}
+	}()
+}
+
+func cleanupExpiredUploads() {
+	var rows []models.UploadSession
+	if err := global.DB.Where("expires_at <= ?", time.Now()).Find(&rows).Error; err != nil {
+		log.L().Error("query expired uploads failed", zap.Error(err))
+		return
+	}
+	for i := range rows {
+		if err := RemoveUploadSession(&rows[i]); err != nil {
+			log.L().Warn("remove expired upload failed", zap.Uint("id", rows[i].ID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package controllers
+
+// 个人访问令牌：用户自行创建，供脚本/CI 通过 Authorization: Bearer 调用 /api
+import (
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"project/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const patTokenBytes = 32
+
+// createTokenDTO 创建个人访问令牌；ExpiresInDays 为 0 表示永不过期
+type createTokenDTO struct {
+	Name          string   `json:"name" binding:"required,max=64"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// accessTokenItem 令牌列表项，不包含令牌本身
+type accessTokenItem struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	Expired    bool       `json:"expired"`
+}
+
+// createTokenResponse 令牌明文只在创建时返回一次
+type createTokenResponse struct {
+	accessTokenItem
+	Token string `json:"token"`
+}
+
+func toAccessTokenItem(t *models.PersonalAccessToken) accessTokenItem {
+	return accessTokenItem{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.ScopeList(),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		Expired:    !t.Active(time.Now()),
+	}
+}
+
+// ListMyTokens godoc
+// @Summary      列出我的个人访问令牌
+// @Description  返回未撤销的令牌（含已过期的），不包含令牌明文
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   accessTokenItem
+// @Failure      401  {object}  ErrorResponse
+// @Router       /me/tokens [get]
+func ListMyTokens(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var rows []models.PersonalAccessToken
+	if err := global.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]accessTokenItem, 0, len(rows))
+	for i := range rows {
+		items = append(items, toAccessTokenItem(&rows[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": items, "available_scopes": models.PATScopes})
+}
+
+// CreateMyToken godoc
+// @Summary      创建个人访问令牌
+// @Description  令牌以 gwp_ 开头，使用 Authorization: Bearer 调用 /api；只能访问所选权限范围对应的接口，write 包含 read
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.createTokenDTO  true  "名称、权限范围、有效天数"
+// @Success      201   {object}  createTokenResponse
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Router       /me/tokens [post]
+func CreateMyToken(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var in createTokenDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopes := make([]string, 0, len(in.Scopes))
+	seen := map[string]bool{}
+	for _, s := range in.Scopes {
+		s = strings.TrimSpace(s)
+		if !models.ValidPATScope(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope: " + s, "available_scopes": models.PATScopes})
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+	var cnt int64
+	global.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&cnt)
+	if cnt >= config.PATMaxPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many access tokens, revoke unused ones first"})
+		return
+	}
+	secret, err := utils.NewOpaqueToken(patTokenBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
+		return
+	}
+	raw := models.PATPrefix + secret
+	row := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(in.Name),
+		TokenHash: utils.HashToken(raw),
+		Prefix:    raw[:len(models.PATPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if in.ExpiresInDays > 0 {
+		exp := time.Now().AddDate(0, 0, min(in.ExpiresInDays, config.PATMaxDays))
+		row.ExpiresAt = &exp
+	}
+	if err := global.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create token failed"})
+		return
+	}
+	writeAudit(c, models.AuditTokenCreate, userID, "id="+strconv.FormatUint(uint64(row.ID), 10)+" scopes="+row.Scopes)
+	c.JSON(http.StatusCreated, &createTokenResponse{accessTokenItem: toAccessTokenItem(&row), Token: raw})
+}
+
+// revokeAllUserPATs 撤销用户全部个人访问令牌：管理员强制下线、使用管理员签发的重置令牌改密码时调用，
+// 账号可能已被盗用，攻击者创建的令牌不能继续使用。用户自己修改密码、退出所有设备时保留令牌，由用户在令牌列表中自行撤销
+func revokeAllUserPATs(userID uint) error {
+	return global.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeMyToken godoc
+// @Summary      撤销个人访问令牌
+// @Description  撤销后立即失效
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "令牌ID"
+// @Success      200  {object}  map[string]bool
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /me/tokens/{id} [delete]
+func RevokeMyToken(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res := global.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke token failed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	writeAudit(c, models.AuditTokenRevoke, userID, "id="+c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,407 @@
+package controllers
+
+// 个人数据导出：异步生成 ZIP（每类数据一个 JSON、文章的 Markdown 副本、上传的原始文件），通过限时链接下载
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// exportProfile 导出的账号信息（不含密码哈希、两步验证密钥等敏感字段）
+type exportProfile struct {
+	ID          uint      `json:"id"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	Status      string    `json:"status"`
+	TOTPEnabled bool      `json:"totp_enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// exportJobResponse 导出任务状态；完成后附带限时下载链接
+type exportJobResponse struct {
+	ID                uint       `json:"id"`
+	Status            string     `json:"status"` // pending/running/done/failed/expired
+	FileSize          int64      `json:"file_size"`
+	Error             string     `json:"error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"` // 压缩包保留截止时间
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// 导出内容：文件名 -> 查询
+type exportSection struct {
+	name  string
+	query func(userID uint) (any, error)
+}
+
+func findByUser[T any](userID uint) (any, error) {
+	var rows []T
+	err := global.DB.Where("user_id = ?", userID).Order("id").Find(&rows).Error
+	return rows, err
+}
+
+var userExportSections = []exportSection{
+	{"profile.json", func(userID uint) (any, error) {
+		var u models.Users
+		if err := global.DB.Unscoped().First(&u, userID).Error; err != nil {
+			return nil, err
+		}
+		return exportProfile{ID: u.ID, Username: u.Username, Role: u.Role, Status: u.Status, TOTPEnabled: u.TOTPEnabled, CreatedAt: u.CreatedAt}, nil
+	}},
+	{"articles.json", findByUser[models.Article]},
+	{"comments.json", findByUser[models.Comment]},
+	{"collections.json", func(userID uint) (any, error) {
+		var rows []models.Collection
+		if err := global.DB.Where("user_id = ?", userID).Order("id").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		type collection struct {
+			models.Collection
+			Articles []uint `json:"article_ids"`
+		}
+		out := make([]collection, 0, len(rows))
+		for _, col := range rows {
+			var ids []uint
+			global.DB.Model(&models.CollectionItem{}).Where("collection_id = ?", col.ID).Pluck("article_id", &ids)
+			out = append(out, collection{Collection: col, Articles: ids})
+		}
+		return out, nil
+	}},
+	{"files.json", findByUser[models.Files]},
+	{"translation_history.json", findByUser[models.TranslationHistory]},
+	{"game_guess_scores.json", findByUser[models.Game_Guess_Score]},
+	{"game_map_times.json", findByUser[models.Game_Map_Time]},
+	{"game_2048_scores.json", findByUser[models.Game_2048_Score]},
+}
+
+// writeUserExport 写入压缩包：JSON 数据、articles/*.md、files/ 下的原始文件
+func writeUserExport(zw *zip.Writer, userID uint) error {
+	for _, s := range userExportSections {
+		data, err := s.query(userID)
+		if err != nil {
+			return fmt.Errorf("export %s failed: %w", s.name, err)
+		}
+		w, err := zw.Create(s.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+	}
+	if err := writeArticleMarkdown(zw, userID); err != nil {
+		return err
+	}
+	return writeUploadedFiles(zw, userID)
+}
+
+func writeArticleMarkdown(zw *zip.Writer, userID uint) error {
+	var articles []models.Article
+	if err := global.DB.Where("user_id = ?", userID).Order("id").Find(&articles).Error; err != nil {
+		return fmt.Errorf("export articles failed: %w", err)
+	}
+	for _, a := range articles {
+		w, err := zw.Create(fmt.Sprintf("articles/%d-%s.md", a.ID, exportSafeName(a.Title)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\ntitle: %q\ncreated_at: %s\nupdated_at: %s\nlikes: %d\n---\n\n# %s\n\n%s\n",
+			a.Title, a.CreatedAt.Format(time.RFC3339), a.UpdatedAt.Format(time.RFC3339), a.Likes, a.Title, a.Content)
+	}
+	return nil
+}
+
+// 原始文件按数据库中的 key 从存储后端读取；缺失的文件跳过。
+// 待扫描或已隔离的文件与其他下载方式一样不输出内容，只在 files.json 中列出（含 scan_status）
+func writeUploadedFiles(zw *zip.Writer, userID uint) error {
+	var files []models.Files
+	if err := global.DB.Where("user_id = ? AND scan_status NOT IN ?", userID, []string{models.ScanPending, models.ScanQuarantined}).
+		Order("id").Find(&files).Error; err != nil {
+		return fmt.Errorf("export files failed: %w", err)
+	}
+	for _, f := range files {
+		fp, err := global.Storage.Get(context.Background(), f.FilePath)
+		if err != nil {
+			log.L().Warn("export skip missing file", zap.Uint("file_id", f.ID), zap.Error(err))
+			continue
+		}
+		w, err := zw.Create(fmt.Sprintf("files/%d-%s", f.ID, exportSafeName(f.Filename)))
+		if err == nil {
+			_, err = io.Copy(w, fp)
+		}
+		fp.Close()
+		if err != nil {
+			return fmt.Errorf("export file %d failed: %w", f.ID, err)
+		}
+	}
+	return nil
+}
+
+// 压缩包内的文件名只保留安全字符
+func exportSafeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|':
+			return '_'
+		case r < 0x20:
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ". ")
+	if r := []rune(name); len(r) > 80 {
+		name = string(r[:80])
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+var exportSlots = make(chan struct{}, config.ExportMaxConcurrent) // 限制同时执行的导出任务
+
+// 后台执行导出任务：先写临时文件，完成后再改名，避免下载到不完整的压缩包
+func runExportJob(jobID, userID uint) {
+	exportSlots <- struct{}{}
+	defer func() { <-exportSlots }()
+
+	fail := func(err error) {
+		log.L().Error("export job failed", zap.Uint("job_id", jobID), zap.Error(err))
+		global.DB.Model(&models.ExportJob{}).Where("id = ?", jobID).
+			Updates(map[string]interface{}{"status": models.ExportFailed, "error": truncate(err.Error(), 255)})
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fail(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	global.DB.Model(&models.ExportJob{}).Where("id = ?", jobID).Update("status", models.ExportRunning)
+
+	suffix, err := utils.NewOpaqueToken(6)
+	if err != nil {
+		fail(err)
+		return
+	}
+	rel := filepath.Join(config.ExportDir, fmt.Sprintf("user_%d-%d-%s.zip", userID, jobID, suffix))
+	full, err := utils.SafeJoinRel(config.AppConfig.Upload.Storagepath, rel)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		fail(err)
+		return
+	}
+	tmp := full + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		fail(err)
+		return
+	}
+	zw := zip.NewWriter(out)
+	err = writeUserExport(zw, userID)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, full)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fail(err)
+		return
+	}
+	var size int64
+	if st, err := os.Stat(full); err == nil {
+		size = st.Size()
+	}
+	now := time.Now()
+	expires := now.Add(config.ExportRetention)
+	global.DB.Model(&models.ExportJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"status":       models.ExportDone,
+		"file_path":    filepath.ToSlash(rel),
+		"file_size":    size,
+		"completed_at": now,
+		"expires_at":   expires,
+	})
+}
+
+// 组装任务状态；已完成的任务每次查询都签发新的限时下载令牌
+func exportJobStatus(job *models.ExportJob) *exportJobResponse {
+	resp := &exportJobResponse{
+		ID:          job.ID,
+		Status:      job.Status,
+		FileSize:    job.FileSize,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+		ExpiresAt:   job.ExpiresAt,
+	}
+	if job.Status != models.ExportDone || job.ExpiresAt == nil || time.Now().After(*job.ExpiresAt) {
+		return resp
+	}
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return resp
+	}
+	if err := global.RedisDB.Set(fmt.Sprintf(config.RedisExportDownload, utils.HashToken(token)), job.ID, config.ExportLinkTTL).Err(); err != nil {
+		log.L().Warn("issue export download token failed", zap.Uint("job_id", job.ID), zap.Error(err))
+		return resp
+	}
+	until := time.Now().Add(config.ExportLinkTTL)
+	resp.DownloadURL = "/exports/download/" + token
+	resp.DownloadExpiresAt = &until
+	return resp
+}
+
+// CreateMyExport godoc
+// @Summary      申请导出我的数据
+// @Description  创建后台导出任务，压缩包包含每类数据的 JSON、文章的 Markdown 副本和上传的原始文件；同一时间只能有一个进行中的任务
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      202  {object}  exportJobResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      409  {object}  exportJobResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /me/exports [post]
+func CreateMyExport(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var running models.ExportJob
+	err := global.DB.Where("user_id = ? AND status IN ?", userID, []string{models.ExportPending, models.ExportRunning}).
+		First(&running).Error
+	if err == nil {
+		c.JSON(http.StatusConflict, exportJobStatus(&running))
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	job := models.ExportJob{UserID: userID, Status: models.ExportPending}
+	if err := global.DB.Create(&job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create export job failed"})
+		return
+	}
+	go runExportJob(job.ID, userID)
+	c.JSON(http.StatusAccepted, exportJobStatus(&job))
+}
+
+// ListMyExports godoc
+// @Summary      我的导出任务
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   exportJobResponse
+// @Failure      401  {object}  ErrorResponse
+// @Router       /me/exports [get]
+func ListMyExports(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var jobs []models.ExportJob
+	if err := global.DB.Where("user_id = ?", userID).Order("id DESC").Limit(20).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]*exportJobResponse, 0, len(jobs))
+	for i := range jobs {
+		items = append(items, exportJobStatus(&jobs[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GetMyExport godoc
+// @Summary      查询导出任务状态
+// @Description  任务完成后返回限时下载链接（每次查询都会生成新的链接）
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "任务ID"
+// @Success      200  {object}  exportJobResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /me/exports/{id} [get]
+func GetMyExport(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var job models.ExportJob
+	if err := global.DB.Where("id = ? AND user_id = ?", id, userID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, exportJobStatus(&job))
+}
+
+// DownloadExport godoc
+// @Summary      下载导出的压缩包
+// @Description  使用任务状态中返回的限时链接下载，无需登录
+// @Tags         User
+// @Produce      application/zip
+// @Param        token  path  string  true  "下载令牌"
+// @Success      200  {file}    file
+// @Failure      404  {object}  ErrorResponse
+// @Router       /exports/download/{token} [get]
+func DownloadExport(c *gin.Context) {
+	key := fmt.Sprintf(config.RedisExportDownload, utils.HashToken(c.Param("token")))
+	jobID, err := global.RedisDB.Get(key).Uint64()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "download link is invalid or expired"})
+		return
+	}
+	var job models.ExportJob
+	if err := global.DB.First(&job, jobID).Error; err != nil || job.Status != models.ExportDone {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	full, err := utils.SafeJoinRel(config.AppConfig.Upload.Storagepath, job.FilePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	if _, err := os.Stat(full); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(full, fmt.Sprintf("export-%d-%s.zip", job.UserID, job.CreatedAt.Format("20060102150405")))
+}
@@ -369,7 +369,7 @@ func GetMyArticles(c *gin.Context) {
 
 // DeleteArticle godoc
 // @Summary      永久删除当前用户的文章
-// @Description  根据文章ID永久删除当前用户拥有的文章。该操作不可恢复。
+// @Description  根据文章ID永久删除当前用户拥有的文章；拥有 articles.moderate 权限时可删除任意文章。该操作不可恢复。
 // @Tags         Articles
 // @Security     BearerAuth
 // @Accept       json
@@ -396,7 +396,11 @@ func DeleteArticle(c *gin.Context) {
 	}
 
 	var article models.Article
-	if err := global.DB.Where("id = ? AND user_id = ?", id, userID).First(&article).Error; err != nil {
+	query := global.DB.Where("id = ?", id)
+	if !canActOnOthers(c, models.PermArticlesModerate) { // 拥有审核权限可以删除任意文章
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&article).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "article not found or access denied"})
 			return
@@ -423,6 +427,13 @@ func DeleteArticle(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, auditEntry{
+		Action:     models.AuditArticleDelete,
+		TargetType: models.AuditTargetArticle,
+		TargetID:   article.ID,
+		Before:     gin.H{"title": article.Title, "user_id": article.UserID},
+	})
+
 	// 3. 清理 Redis 缓存
 	articleID := uint(id)
 	global.RedisDB.Del(
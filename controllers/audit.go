@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"encoding/json"
+	"project/global"
+	"project/log"
+	"project/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// auditEntry 一条审计记录；Before/After 会序列化为 JSON
+type auditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	Before     any
+	After      any
+	Detail     string
+}
+
+// writeAudit 记录针对用户的审计日志
+func writeAudit(c *gin.Context, action string, targetID uint, detail string) {
+	e := auditEntry{Action: action, TargetID: targetID, Detail: detail}
+	if targetID != 0 {
+		e.TargetType = models.AuditTargetUser
+	}
+	recordAudit(c, e)
+}
+
+// recordAudit 记录审计日志；写入失败只记录错误，不影响业务
+func recordAudit(c *gin.Context, e auditEntry) {
+	entry := models.AuditLog{
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		Before:     auditJSON(e.Before),
+		After:      auditJSON(e.After),
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+		RequestID:  c.GetString("request_id"),
+		Detail:     e.Detail,
+	}
+	if actor := c.GetUint("user_id"); actor != 0 {
+		entry.ActorID = &actor
+	}
+	if e.TargetID != 0 {
+		entry.TargetID = &e.TargetID
+	}
+	if err := global.DB.Create(&entry).Error; err != nil {
+		log.L().Error("write audit log failed", zap.String("action", e.Action), zap.Error(err))
+	}
+}
+
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// auditUser 审计日志中记录的用户快照，不包含密码等敏感字段
+func auditUser(u *models.Users) gin.H {
+	return gin.H{"id": u.ID, "username": u.Username, "role": u.Role, "status": u.Status}
+}
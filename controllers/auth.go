@@ -9,20 +9,19 @@ import (
 	"project/global"
 	"project/models"
 	"project/utils"
+	"strings"
 	"time"
 
-	"golang.org/x/time/rate"
-
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // DTO数据
 type RegisterDTO struct {
-	Username string `json:"username" binding:"required,alphanum,min=3,max=32"`
-	Password string `json:"password" binding:"required,min=6,max=64"`
+	Username   string `json:"username" binding:"required,alphanum,min=3,max=32"`
+	Password   string `json:"password" binding:"required"`            // 规则见 config.yaml 的 registration.password
+	InviteCode string `json:"invite_code" binding:"omitempty,max=64"` // 邀请码注册方式下必填
 }
 
 type LoginDTO struct {
@@ -32,12 +31,16 @@ type LoginDTO struct {
 
 // Register godoc
 // @Summary     用户注册
+// @Description 按 registration.mode 处理：open 直接注册；invite 需要邀请码；approval 注册后等待管理员审核（返回 202，持有邀请码可免审核）；closed 不允许注册
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
 // @Param       body  body      controllers.RegisterDTO  true  "注册参数"
-// @Success     200   {object}  map[string]string
+// @Success     201   {object}  map[string]string
+// @Success     202   {object}  map[string]interface{}  "等待审核"
 // @Failure     400   {object}  map[string]string
+// @Failure     403   {object}  map[string]string
+// @Failure     409   {object}  map[string]string
 // @Router      /auth/register [post]
 func Register(c *gin.Context) {
 	var in RegisterDTO //注册的DTO
@@ -45,11 +48,24 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if !registerLimiter(c, in.Username) {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, please try again later"})
+	mode := config.RegistrationMode()
+	if mode == config.RegistrationClosed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "registration is closed", "code": "registration_closed"})
 		return
 	}
 	uname := in.Username
+	if err := config.ValidatePassword(uname, in.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "weak_password"})
+		return
+	}
+	inviteCode := strings.TrimSpace(in.InviteCode)
+	if mode == config.RegistrationInvite && inviteCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invite code is required", "code": "invite_required"})
+		return
+	}
+	if mode == config.RegistrationOpen {
+		inviteCode = "" // 开放注册时不消耗邀请码
+	}
 
 	hash, err := utils.HashPassword(in.Password) // 对其加密
 	if err != nil {
@@ -57,9 +73,25 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	u := models.Users{Username: uname, Password: hash} //赋值,默认注册的用户都是普通用户
-
-	if err := global.DB.Create(&u).Error; err != nil {
+	u := models.Users{Username: uname, Password: hash, Status: models.StatusActive} //赋值,默认注册的用户都是普通用户
+	if mode == config.RegistrationApproval && inviteCode == "" {
+		u.Status = models.StatusPending
+	}
+	var invite *models.InviteCode
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if inviteCode != "" {
+			if invite, err = redeemInviteCode(tx, inviteCode); err != nil {
+				return err
+			}
+			u.InviteCodeID = &invite.ID
+		}
+		return tx.Create(&u).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInviteCodeInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invite_invalid"})
+			return
+		}
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			c.JSON(http.StatusConflict, gin.H{"error": "username has already existed"})
 			return
@@ -67,15 +99,23 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	detail := "mode=" + mode
+	if invite != nil {
+		detail += " invite=" + invite.Prefix
+	}
+	writeAudit(c, models.AuditUserRegister, u.ID, detail)
+	if u.Status == models.StatusPending { // 等待管理员审核，审核通过前不签发令牌
+		c.JSON(http.StatusAccepted, gin.H{"pending": true, "message": "registration submitted, please wait for administrator approval"})
+		return
+	}
 
 	// 建议：写库成功后再签发JWT
-	token, err := utils.GenerateJWT(u.Username, u.Role)
+	pair, err := issueTokenPair(c, &u, "") //签发访问令牌和刷新令牌并写入cookie
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
 		return
 	}
-	utils.SetAuthCookie(c, token, utils.Expire_hours*time.Hour) //给上下文签发token和过i时间
-	c.JSON(http.StatusCreated, gin.H{"token": token})
+	c.JSON(http.StatusCreated, gin.H{"token": pair.Token, "refresh_token": pair.RefreshToken, "expires_in": pair.ExpiresIn})
 }
 func CheckPassword(hash string, pwd string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd)) //第一个是hash加密过的密码，第二个是原装的密码-并不是字符串的比较
@@ -88,7 +128,8 @@ func CheckPassword(hash string, pwd string) bool {
 // @Accept      json
 // @Produce     json
 // @Param       body  body      controllers.LoginDTO  true  "登录参数"
-// @Success     200   {object}  map[string]string  "token,result_url"
+// @Description 密码正确后：未开启两步验证直接返回令牌；否则返回 mfa_token 与 mfa_required / mfa_enroll_required，需完成第二步才签发令牌
+// @Success     200   {object}  map[string]string  "token,refresh_token,expires_in,result_url 或 mfa_token"
 // @Failure     400   {object}  map[string]string
 // @Router      /auth/login [post]   // 注意：不要写 /api，已由 @BasePath /api 补齐
 func Login(c *gin.Context) {
@@ -102,37 +143,93 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
 		return
 	}
-	// 添加请求频率限制（使用 Redis 限流，支持分布式）
-	if !loginLimiterRedis(in.Username) {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, please try again later"})
+	// 连续输错密码后账号被临时锁定
+	if ttl, locked := loginLocked(uname); locked {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(ttl.Seconds())))
+		c.JSON(http.StatusLocked, gin.H{"error": "too many failed login attempts, account locked temporarily", "retry_after": int(ttl.Seconds())})
 		return
 	}
 
 	var user models.Users
-	if err := global.DB.Where("username = ?", uname).First(&user).Error; err != nil {
+	// 包含冷静期内已注销的账号，登录即撤销注销；其他已删除账号视为不存在
+	if err := global.DB.Unscoped().Where("username = ?", uname).First(&user).Error; err != nil ||
+		(user.DeletedAt.Valid && !user.PendingDeletion(time.Now())) {
 		// 不区分“用户不存在/密码错误”，统一提示，避免枚举用户名
+		recordLoginFailure(uname)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
 	if !CheckPassword(user.Password, in.Password) {
+		recordLoginFailure(uname)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
+	clearLoginFailures(uname)
+	// 密码正确后再告知暂停/封禁状态，避免向他人泄露账号状态
+	if user.IsBlocked(time.Now()) {
+		c.JSON(http.StatusForbidden, blockedUserResponse(&user))
+		return
+	}
 
-	token, err := utils.GenerateJWT(user.Username, user.Role)
+	// 已绑定两步验证，或管理员尚未绑定：密码通过后只签发一次性的第二步凭据，不签发JWT
+	if user.TOTPEnabled || config.RoleRequiresMFA(user.Role) {
+		mfaToken, err := startMFAChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "start two-factor login failed"})
+			return
+		}
+		resp := gin.H{"mfa_token": mfaToken, "expires_in": int64(config.MFAPendingTTL.Seconds())}
+		if user.TOTPEnabled {
+			resp["mfa_required"] = true // 调用 /auth/login/2fa 提交验证码
+		} else {
+			resp["mfa_enroll_required"] = true // 调用 /auth/2fa/enroll 完成绑定
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	finishLogin(c, &user, nil)
+}
+
+// 签发令牌并返回登录结果；extra 用于附带额外字段（例如首次绑定两步验证时的恢复码）
+func finishLogin(c *gin.Context, user *models.Users, extra gin.H) {
+	resp, err := completeLogin(c, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// 所有验证通过后的公共步骤：撤销待注销状态、签发令牌并写入cookie
+func completeLogin(c *gin.Context, user *models.Users) (gin.H, error) {
+	restored := false
+	if user.PendingDeletion(time.Now()) { // 完成全部验证后才撤销注销
+		if err := restorePendingDeletion(c, user); err != nil {
+			return nil, errors.New("restore account failed")
+		}
+		restored = true
+	}
+	pair, err := issueTokenPair(c, user, "") //短期访问令牌+长期刷新令牌
+	if err != nil {
+		return nil, errors.New("generate token failed")
+	}
 	Result_Url := "/page/shell" // 登录成功后跳转的页面
-	if user.Role != "user" {
+	if config.HasPermission(user.Role, models.PermDashboardView) {
 		Result_Url = "/admin/dashboard"
 	}
-	utils.SetAuthCookie(c, token, utils.Expire_hours*time.Hour) //设定cookie
-	c.JSON(http.StatusOK, gin.H{
-		"token":      token,
-		"result_url": Result_Url,
-	})
+	resp := gin.H{
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
+		"result_url":    Result_Url,
+	}
+	if restored {
+		resp["account_restored"] = true
+	}
+	return resp, nil
 }
 
 // Logout godoc
@@ -144,27 +241,51 @@ func Login(c *gin.Context) {
 // @Router      /auth/logout [post]
 // controllers/auth.go
 func Logout(c *gin.Context) {
+	// 当前访问令牌加入黑名单，并作废整个会话的刷新令牌，避免退出后仍能使用或续期
+	token := c.GetHeader("Authorization")
+	if token == "" {
+		token, _ = c.Cookie(utils.CookieName)
+	}
+	if claims, err := utils.ParseJWTClaims(token); err == nil {
+		config.RevokeAccessToken(claims.ID, claims.ExpiresAt)
+		revokeSession(claims.SessionID)
+	}
+	if raw, err := c.Cookie(utils.RefreshCookieName); err == nil && raw != "" {
+		var rt models.RefreshToken
+		if err := global.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&rt).Error; err == nil {
+			revokeSession(rt.FamilyID)
+		}
+	}
 	utils.ClearAuthCookie(c)
+	utils.ClearRefreshCookie(c)
 	c.JSON(200, gin.H{"ok": true})
 }
 
 type deleteInput struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"` // 已开启两步验证时必填
+}
+
+// deleteAccountResponse 注销结果：冷静期结束前重新登录即可撤销
+type deleteAccountResponse struct {
+	OK      bool      `json:"ok"`
+	PurgeAt time.Time `json:"purge_at"` // 计划彻底删除的时间
 }
 
 // @Summary      Delete user account
-// @Description  Delete the current user's account after password verification
+// @Description  Delete the current user's account after password verification. The account is disabled immediately and purged with all its data after the grace period; logging in before then cancels the deletion. Download /me/export first to keep a copy.
 // @Tags         User
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        data  body      deleteInput  true  "User credentials"
-// @Success      200   {object}  map[string]interface{}  "退出成功"
+// @Success      200   {object}  deleteAccountResponse  "注销成功"
 // @Failure      400   {object}  map[string]interface{}  "请求参数错误"
 // @Failure      401   {object}  map[string]interface{}  "未认证"
+// @Failure      403   {object}  map[string]interface{}  "超级管理员不能注销"
 // @Failure      500   {object}  map[string]interface{}  "服务器错误"
-// @Router       /user/delete [delete]
+// @Router       /me [delete]
 // 这个是在登录之后的注销页面
 func DeleteUser(c *gin.Context) {
 	userID := c.GetUint("user_id")
@@ -187,78 +308,90 @@ func DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
 		return
 	}
-	if err := global.DB.Delete(&deleteInput).Error; err != nil {
+	if user.TOTPEnabled && !verifySecondFactor(&user, deleteInput.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errMFACodeInvalid.Error()})
+		return
+	}
+	if user.Role == models.RoleSuperAdmin { // 超级管理员由配置文件维护，启动时会被重新创建
+		c.JSON(http.StatusForbidden, gin.H{"error": "superadmin account cannot be deleted"})
+		return
+	}
+	purgeAt := time.Now().Add(config.DeletionGracePeriod())
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("deletion_scheduled_at", purgeAt).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error // 软删除：冷静期内数据保留
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	if err := revokeAllUserSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+	writeAudit(c, models.AuditAccountDelete, user.ID, "purge_at="+purgeAt.Format(time.RFC3339))
 
 	utils.ClearAuthCookie(c)
-	c.JSON(http.StatusOK, gin.H{
-		"ok": true,
-	})
+	utils.ClearRefreshCookie(c)
+	c.JSON(http.StatusOK, &deleteAccountResponse{OK: true, PurgeAt: purgeAt})
 }
 
-// 本地限流版本（如果是当前的单实例场景，性能更好）-注意如果使用这个函数main里要开启限流清楚器
-func loginLimiterLocal(username string) *rate.Limiter {
-	limiter, _ := config.LoginAttempts.LoadOrStore(username, rate.NewLimiter(5, 5)) // 每秒5次，突发5次
-	return limiter.(*rate.Limiter)                                                  //类型断言
+// 冷静期内重新登录：撤销注销
+func restorePendingDeletion(c *gin.Context, user *models.Users) error {
+	if err := global.DB.Unscoped().Model(&models.Users{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"deleted_at": nil, "deletion_scheduled_at": nil}).Error; err != nil {
+		return err
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	user.DeletionScheduledAt = nil
+	config.ClearUserCache(user.Username)
+	writeAudit(c, models.AuditAccountRestore, user.ID, "")
+	return nil
 }
 
-// Redis 限流版本（分布式场景，与项目中其他限流保持一致）
-// 使用滑动窗口算法：60秒内最多5次登录尝试
-func loginLimiterRedis(username string) bool {
-	rateKey := fmt.Sprintf(config.RedisLoginRate, username) //缓存的key-表名
-	now := time.Now().Unix()
-	window := int64(config.RedisWindow)
-	maxAttempts := int64(config.RedisRateMaxAttempts) // 最多5次
-
-	pipe := global.RedisDB.Pipeline()
-	// 清理过期记录（60秒前的）
-	pipe.ZRemRangeByScore(rateKey, "0", fmt.Sprintf("%d", now-window)) //删除
-	// 统计当前窗口内的请求数
-	pipe.ZCard(rateKey)
-	// 添加当前请求的时间戳
-	pipe.ZAdd(rateKey, redis.Z{Score: float64(now), Member: fmt.Sprintf("%d", now)}) //ZSet是排序集合-Score为排序的元素，Member为对应存储的值
-	// 设置过期时间
-	pipe.Expire(rateKey, time.Duration(window)*time.Second)
-	results, err := pipe.Exec() //一次性执行所有命令
-
+// 连续密码错误计数：窗口内达到阈值后锁定账号一段时间
+func recordLoginFailure(username string) {
+	failKey := fmt.Sprintf(config.RedisLoginFail, username)
+	count, err := global.RedisDB.Incr(failKey).Result()
 	if err != nil {
-		return true
+		return
+	}
+	if count == 1 {
+		global.RedisDB.Expire(failKey, config.LoginFailWindow)
 	}
+	if count >= config.LoginFailThreshold {
+		global.RedisDB.Set(fmt.Sprintf(config.RedisLoginLock, username), "1", config.LoginLockTTL)
+		global.RedisDB.Del(failKey)
+	}
+}
 
-	// 获取当前窗口内的请求数
-	count := results[1].(*redis.IntCmd).Val()
-	return count <= maxAttempts
+func clearLoginFailures(username string) {
+	global.RedisDB.Del(fmt.Sprintf(config.RedisLoginFail, username))
 }
-func registerLimiter(c *gin.Context, username string) bool {
-	clientIP := c.ClientIP()
-	ipKey := fmt.Sprintf(config.RedisRegisterRateIP, clientIP)
-	ipCount, err := global.RedisDB.Incr(ipKey).Result() //获得其计数
-	if err == nil {
-		if ipCount == 1 {
-			global.RedisDB.Expire(ipKey, config.RedisRegisterRateTTL) // 第一次设置10分钟过期
-		}
-		if ipCount > config.RedisRateMaxAttempts {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "注册过于频繁,请" + config.RedisRegisterRateTTL.String() + "后再试",
-			})
-			return false
-		}
+
+// 返回剩余锁定时间
+func loginLocked(username string) (time.Duration, bool) {
+	ttl, err := global.RedisDB.TTL(fmt.Sprintf(config.RedisLoginLock, username)).Result()
+	if err != nil || ttl <= 0 {
+		return 0, false
 	}
+	return ttl, true
+}
 
-	usernameKey := fmt.Sprintf(config.RedisRegisterRateUser, username)
-	usernameCount, err := global.RedisDB.Incr(usernameKey).Result()
-	if err == nil {
-		if usernameCount == 1 {
-			global.RedisDB.Expire(usernameKey, config.RedisRegisterRateTTL)
-		}
-		if usernameCount > config.RedisRateMaxAttempts {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "该用户名注册尝试过于频繁，请于" + config.RedisRegisterRateTTL.String() + "后再试",
-			})
-			return false
-		}
+// 暂停/封禁/待审核时返回给用户的信息
+func blockedUserResponse(u *models.Users) gin.H {
+	body := gin.H{
+		"error":  "account " + u.Status,
+		"status": u.Status,
+		"reason": u.StatusReason,
+	}
+	if u.Status == models.StatusSuspended && u.SuspendedUntil != nil {
+		body["until"] = u.SuspendedUntil.Format(utils.FormatTime_specific)
+	}
+	if u.Status == models.StatusPending {
+		body["error"] = "account pending administrator approval"
 	}
-	return true
+	return body
 }
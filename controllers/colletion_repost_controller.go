@@ -59,14 +59,6 @@ func Repost(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission, user does not log in"})
 		return
 	}
-	// 限制用户转发频率（3秒/次）
-	rateKey := fmt.Sprintf(config.RedisRepostRate, userID)
-	if global.RedisDB.Exists(rateKey).Val() > 0 {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请在3秒后再次转发"})
-		return
-	}
-	global.RedisDB.Set(rateKey, "1", 3*time.Second) //失效期
-
 	//这里转发获取对应文章的ID
 	articleID, err := strconv.ParseUint(c.Param("article_id"), 10, 32)
 	if err != nil || articleID == 0 {
@@ -190,14 +182,6 @@ func CreateMycollection(c *gin.Context) { //创建个人的收藏夹
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
-	// 限制用户创建收藏夹频率（3秒/次）
-	rateKey := fmt.Sprintf(config.RedisCreateCollectionRate, userID)
-	if global.RedisDB.Exists(rateKey).Val() > 0 {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请在3秒后再次创建收藏文件夹"})
-		return
-	}
-	global.RedisDB.Set(rateKey, "1", 3*time.Second) //失效期
-
 	var req createCollectionReq //接受发送来的请求-只有名字
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid params"})
@@ -183,14 +183,6 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 
-	// 安全防刷：限制用户评论频率（3秒/次）
-	rateKey := fmt.Sprintf(config.RedisCommentRate, userID)
-	if global.RedisDB.Exists(rateKey).Val() > 0 {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请在3秒后再次评论"})
-		return
-	}
-	global.RedisDB.Set(rateKey, "1", 3*time.Second) //失效期
-
 	//文章存在性检验
 	// 这里先缓存查询文章的存在性，再通ID查询Mysql里是否有这个文章-带有缓存
 	IDkey := fmt.Sprintf(config.RedisArticleKey, req.ArticleID)
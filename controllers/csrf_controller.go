@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csrfTokenResponse CSRF 令牌
+type csrfTokenResponse struct {
+	Token  string `json:"csrf_token"`
+	Header string `json:"header"` // 非 GET 请求需要携带的请求头
+}
+
+// GetCSRFToken godoc
+// @Summary     获取 CSRF 令牌
+// @Description 使用 cookie 登录态发起 POST/PUT/PATCH/DELETE 请求时，需把令牌放在 X-CSRF-Token 请求头；令牌同时写入 csrf_token cookie（双重提交）。使用 Authorization 请求头的调用方不需要
+// @Tags        Auth
+// @Produce     json
+// @Success     200  {object}  csrfTokenResponse
+// @Failure     500  {object}  map[string]string
+// @Router      /auth/csrf [get]
+func GetCSRFToken(c *gin.Context) {
+	token, err := utils.EnsureCSRFToken(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate csrf token failed"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, &csrfTokenResponse{Token: token, Header: utils.CSRFHeaderName})
+}
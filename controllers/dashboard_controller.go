@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"project/config"
@@ -52,7 +53,7 @@ type TotalData struct {
 func GetDashboardTotalData(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermDashboardView) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -205,7 +206,7 @@ type DashboardAdd struct {
 func GetDashboardAdd(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermDashboardView) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -286,7 +287,7 @@ type DailyData struct {
 func GetDashboardCurveData(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermDashboardView) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -486,13 +487,14 @@ type UserListResponse struct {
 }
 
 // @Summary 获取用户列表
-// @Description 获取用户列表，支持分页和排序
+// @Description 获取用户列表，支持分页、排序和按状态筛选
 // @Tags UserManagement
 // @Accept json
 // @Produce json
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
 // @Param order query string false "排序方式" Enums(created_asc,created_desc) default(created_desc)
+// @Param status query string false "按状态筛选" Enums(active,suspended,banned,pending)
 // @Success 200 {object} UserListResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -501,7 +503,7 @@ type UserListResponse struct {
 func GetUserList(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersRead) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -511,8 +513,19 @@ func GetUserList(c *gin.Context) {
 	order := strings.TrimSpace(c.Query("order"))
 	var users []models.Users
 	var total int64
+	// 按状态筛选，status=pending 即待审核的注册申请；历史数据中的空状态视为 active
+	byStatus := func(db *gorm.DB) *gorm.DB {
+		switch status := strings.TrimSpace(c.Query("status")); status {
+		case "":
+			return db
+		case models.StatusActive:
+			return db.Where("status = ? OR status = '' OR status IS NULL", status)
+		default:
+			return db.Where("status = ?", status)
+		}
+	}
 	// 查询总数
-	if err := global.DB.Model(&models.Users{}).Count(&total).Error; err != nil {
+	if err := global.DB.Model(&models.Users{}).Scopes(byStatus).Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户总数失败"})
 		return
 	}
@@ -525,7 +538,7 @@ func GetUserList(c *gin.Context) {
 	if size > 100 {
 		size = 100
 	}
-	db := global.DB.Model(&models.Users{})
+	db := global.DB.Model(&models.Users{}).Scopes(byStatus)
 	switch order {
 	case "created_asc":
 		db = db.Order("created_at ASC")
@@ -578,7 +591,7 @@ type deleteUserDTO struct {
 func DeleteUserFromDashboard(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -587,10 +600,24 @@ func DeleteUserFromDashboard(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	} else {
+		var target models.Users
+		found := global.DB.Select("id", "username", "role", "status").First(&target, ID).Error == nil
+		if found && (target.Role == models.RoleSuperAdmin || !canManageRole(Role, target.Role)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不能删除超级管理员或拥有自己所没有的权限的用户"})
+			return
+		}
+		// 先让该用户的所有会话失效，避免删除后旧令牌仍可使用
+		if err := revokeAllUserSessions(uint(ID)); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注销用户会话失败"})
+			return
+		}
 		if err := global.DB.Delete(&models.Users{}, ID).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 			return
 		}
+		if found {
+			recordAudit(c, auditEntry{Action: models.AuditUserDelete, TargetType: models.AuditTargetUser, TargetID: target.ID, Before: auditUser(&target)})
+		}
 	}
 	c.JSON(http.StatusOK, &deleteUserDTO{Deleted: true})
 }
@@ -601,8 +628,8 @@ func DeleteUserFromDashboard(c *gin.Context) {
 // - oneof: 限定字段值必须是给定选项之一
 type userUpdateDTO struct {
 	Username string `json:"username" binding:"min=1,max=20"` // 用户名，长度1-20字符
-	Role     string `json:"role" binding:"oneof=admin user"` // 用户角色，只能是admin或user
-	Status   string `json:"status"`                          // 用户状态，非必填字段
+	Role     string `json:"role" binding:"required,max=16"` // 用户角色，须为已存在的角色且不能是superadmin
+	Status   string `json:"status" binding:"omitempty,oneof=active suspended banned"` // 用户状态，非必填；暂停/封禁请使用专门的接口以填写原因
 }
 
 // UpdateUser
@@ -622,7 +649,7 @@ type userUpdateDTO struct {
 func UpdateUser(c *gin.Context) { //这里请求是put并且接收参数
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -631,14 +658,31 @@ func UpdateUser(c *gin.Context) { //这里请求是put并且接收参数
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
-	if input.Role != "admin" && input.Role != "user" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户的权限设置错误，只能为admin或user"})
+	if !assignableRole(Role, input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户的角色设置错误：角色不存在，或包含自己所没有的权限"})
 		return
 	}
-	if err := global.DB.Model(&models.Users{}).Where("id = ?", c.Param("id")).Updates(input).Error; err != nil { //操作的数据使用结构体来操作
+	var target models.Users
+	if err := global.DB.First(&target, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if target.Role == models.RoleSuperAdmin || !canManageRole(Role, target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改超级管理员或拥有自己所没有的权限的用户"})
+		return
+	}
+	if err := global.DB.Model(&models.Users{}).Where("id = ?", target.ID).Updates(input).Error; err != nil { //操作的数据使用结构体来操作
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
 		return
 	}
+	// 鉴权中间件从缓存读取角色和状态，更新后清掉缓存即可立即生效
+	config.ClearUserCache(target.Username)
+	if input.Username != "" && input.Username != target.Username {
+		config.ClearUserCache(input.Username)
+	}
+	var updated models.Users
+	global.DB.First(&updated, target.ID)
+	recordAudit(c, auditEntry{Action: models.AuditUserUpdate, TargetType: models.AuditTargetUser, TargetID: target.ID, Before: auditUser(&target), After: auditUser(&updated)})
 	c.JSON(http.StatusOK, gin.H{"message": "用户信息更新成功"})
 }
 
@@ -646,14 +690,14 @@ func UpdateUser(c *gin.Context) { //这里请求是put并且接收参数
 type addUserReqDTO struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"oneof=admin user"`
-	Status   string `json:"status"`
+	Role     string `json:"role" binding:"required,max=16"`
+	Status   string `json:"status" binding:"omitempty,oneof=active suspended banned"`
 }
 
 // addUserResDTO 添加用户响应结果
 type addUserResDTO struct {
 	Username string `json:"username" binding:"required"`
-	Role     string `json:"role" binding:"oneof=admin user"`
+	Role     string `json:"role"`
 	Status   string `json:"status"`
 	ID       uint   `json:"id"`
 }
@@ -674,7 +718,7 @@ type addUserResDTO struct {
 func AddUser(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	Role := c.GetString("role")
-	if userID == 0 || Role == "user" {
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
 		return
 	}
@@ -683,8 +727,8 @@ func AddUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
-	if input.Role != "admin" && input.Role != "user" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户的权限设置错误，只能为admin或user"})
+	if !assignableRole(Role, input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户的角色设置错误：角色不存在，或包含自己所没有的权限"})
 		return
 	}
 	var count int64
@@ -698,6 +742,10 @@ func AddUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "用户已存在"})
 		return
 	}
+	if err := config.ValidatePassword(input.Username, input.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	hashPassword, err := utils.HashPassword(input.Password) // 对其加密
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash password failed"})
@@ -714,6 +762,7 @@ func AddUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败：" + err.Error()})
 		return
 	}
+	recordAudit(c, auditEntry{Action: models.AuditUserCreate, TargetType: models.AuditTargetUser, TargetID: user.ID, After: auditUser(user)})
 	c.JSON(http.StatusOK, &addUserResDTO{
 		Username: user.Username,
 		Role:     user.Role,
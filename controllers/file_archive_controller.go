@@ -0,0 +1,549 @@
+package controllers
+
+// 多文件打包下载（边读边写 ZIP，不落盘）与上传 ZIP 在服务端解压为单独的文件
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/media"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errExtractQuotaExceeded = errors.New("storage limit exceeded")
+
+// 已压缩过的格式直接存储，不再 Deflate
+var storedTypes = []string{"image/", "video/", "audio/", "application/zip", "application/pdf", "application/x-gzip"}
+
+type zipEntry struct {
+	file *models.Files
+	name string // 压缩包中的路径
+}
+
+// ExtractedFile 解压出的文件
+type ExtractedFile struct {
+	ID         uint   `json:"id"`
+	Filename   string `json:"filename"`
+	Path       string `json:"path"` // 在压缩包中的路径
+	FolderID   *uint  `json:"folder_id"`
+	Size       int64  `json:"size"`
+	ScanStatus string `json:"scan_status"`
+}
+
+// SkippedEntry 未解压的条目及原因
+type SkippedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type ExtractResponse struct {
+	Extracted []ExtractedFile `json:"extracted"`
+	Skipped   []SkippedEntry  `json:"skipped"`
+}
+
+// 解析 ids=1,2,3 或重复的 ids=1&ids=2
+func parseIDList(values []string) ([]uint, bool) {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(part, 10, 64)
+			if err != nil || id == 0 {
+				return nil, false
+			}
+			if !seen[uint(id)] {
+				seen[uint(id)] = true
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+	return ids, true
+}
+
+// 从 from 文件夹（nil 为根目录）到 to 文件夹的相对路径，包含 from 自身的名字
+func relFolderPath(all map[uint]models.Folder, from, to *uint) string {
+	var parts []string
+	for next := to; next != nil && len(parts) <= config.FolderMaxDepth; {
+		f, ok := all[*next]
+		if !ok {
+			break
+		}
+		parts = append([]string{f.Name}, parts...)
+		if from != nil && f.ID == *from {
+			break
+		}
+		next = f.ParentID
+	}
+	return strings.Join(parts, "/")
+}
+
+// 压缩包内重名时追加序号：a.txt、a (1).txt
+func uniqueZipName(used map[string]bool, name string) string {
+	if !used[name] {
+		used[name] = true
+		return name
+	}
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if !used[candidate] {
+			used[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// DownloadZip godoc
+// @Summary      打包下载多个文件
+// @Description  ids 为文件ID列表（逗号分隔或重复参数），或 folder_id 打包整个文件夹（含子文件夹，0 为全部文件）；边读边写 ZIP，不在服务端生成临时文件。每个文件的下载次数 +1
+// @Tags         Files
+// @Produce      application/zip
+// @Security     BearerAuth
+// @Param        ids        query   string  false  "文件ID列表，如 1,2,3"
+// @Param        folder_id  query   int     false  "文件夹ID，0 为全部文件"
+// @Success      200        {file}  file
+// @Failure      400        {object}  ErrorResponse
+// @Failure      401        {object}  ErrorResponse
+// @Failure      404        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /files/zip [get]
+func DownloadZip(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	ids, ok := parseIDList(c.QueryArray("ids"))
+	folderParam := strings.TrimSpace(c.Query("folder_id"))
+	if !ok || (len(ids) == 0 && folderParam == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids or folder_id is required"})
+		return
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+
+	var files []models.Files
+	archiveName := "files"
+	db := global.DB.Where("user_id = ? AND trashed_at IS NULL", userID)
+	var root *uint // 压缩包内路径的起点
+	if len(ids) > 0 {
+		if len(ids) > config.ArchiveMaxEntries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many files"})
+			return
+		}
+		if err := db.Where("id IN ?", ids).Order("id").Find(&files).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+			return
+		}
+		if len(files) != len(ids) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "some files were not found"})
+			return
+		}
+		for i := range files {
+			if blockedByScan(c, &files[i]) {
+				return
+			}
+		}
+	} else {
+		fid, err := strconv.ParseUint(folderParam, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+			return
+		}
+		if fid > 0 {
+			id := uint(fid)
+			folder, ok := all[id]
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+				return
+			}
+			subtree, _ := folderSubtree(all, id)
+			db = db.Where("folder_id IN ?", subtree)
+			root, archiveName = &id, folder.Name
+		}
+		// 待扫描或已隔离的文件不打包
+		db = db.Where("scan_status NOT IN ?", []string{models.ScanPending, models.ScanQuarantined})
+		if err := db.Order("folder_id, id").Limit(config.ArchiveMaxEntries + 1).Find(&files).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+			return
+		}
+		if len(files) > config.ArchiveMaxEntries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many files in this folder"})
+			return
+		}
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no files to download"})
+		return
+	}
+
+	used := map[string]bool{}
+	entries := make([]zipEntry, 0, len(files))
+	for i := range files {
+		name := filepath.Base(files[i].Filename)
+		if len(ids) == 0 { // 打包文件夹时保留目录结构
+			if dir := relFolderPath(all, root, files[i].FolderID); dir != "" {
+				name = dir + "/" + name
+			}
+		}
+		entries = append(entries, zipEntry{file: &files[i], name: uniqueZipName(used, name)})
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename*=UTF-8''%s`, url.PathEscape(archiveName+".zip")))
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	zw := zip.NewWriter(c.Writer)
+	for _, e := range entries {
+		if err := writeZipEntry(c, zw, e); err != nil {
+			// 响应头已发出，只能中断输出；不写中央目录，客户端会得到无法打开的压缩包而不是缺文件的压缩包
+			log.L().Warn("write zip entry failed", zap.Uint("file_id", e.file.ID), zap.Error(err))
+			c.Abort()
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.L().Warn("finish zip failed", zap.Error(err))
+		return
+	}
+	fileIDs := make([]uint, 0, len(files))
+	for _, f := range files {
+		fileIDs = append(fileIDs, f.ID)
+	}
+	global.DB.Model(&models.Files{}).Where("id IN ?", fileIDs).UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+}
+
+func writeZipEntry(c *gin.Context, zw *zip.Writer, e zipEntry) error {
+	f := e.file
+	var content io.ReadSeeker
+	if config.AppConfig.Upload.StripGPS && f.FileType == "image/jpeg" { // 与单个下载一致，抹去定位信息
+		obj, head, err := openWithoutGPS(c.Request.Context(), f.FilePath)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		content = obj
+		if head != nil {
+			content = media.OverlayHead(obj, head)
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		obj, err := global.Storage.Get(c.Request.Context(), f.FilePath)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		content = obj
+	}
+	method := zip.Deflate
+	for _, prefix := range storedTypes {
+		if strings.HasPrefix(f.FileType, prefix) {
+			method = zip.Store
+			break
+		}
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: method, Modified: f.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// 解压条目的检查结果
+type extractPlan struct {
+	zf   *zip.File
+	path string   // 清理后的相对路径
+	dirs []string // 需要创建或复用的文件夹
+	name string
+}
+
+// ExtractZip godoc
+// @Summary      上传 ZIP 并解压
+// @Description  ZIP 中的每个文件成为单独的文件记录，目录结构对应为文件夹（创建在 folder_id 下）。路径穿越、符号链接、隐藏文件、不允许的类型和超过单文件上限的条目会被跳过并在 skipped 中说明；解压后的总大小计入配额
+// @Tags         Files
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        file       formData  file  true   "ZIP 文件"
+// @Param        folder_id  formData  int   false  "解压到的文件夹，省略或 0 为根目录"
+// @Success      200        {object}  ExtractResponse
+// @Failure      400        {object}  ErrorResponse
+// @Failure      401        {object}  ErrorResponse
+// @Failure      404        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /files/extract [post]
+func ExtractZip(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	maxLoad := int64(config.AppConfig.Upload.FileSize) << 20
+	maxTotal := int64(config.AppConfig.Upload.TotalSize) << 20
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file or invalid form"})
+		return
+	}
+	defer file.Close()
+	if strings.ToLower(filepath.Ext(header.Filename)) != ".zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only .zip archives can be extracted"})
+		return
+	}
+	if header.Size > maxLoad {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archive is too large"})
+		return
+	}
+	var target *uint
+	if v := strings.TrimSpace(c.PostForm("folder_id")); v != "" {
+		fid, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+			return
+		}
+		id := uint(fid)
+		target = parentOrRoot(&id)
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	targetDepth := 0
+	if target != nil {
+		if _, ok := all[*target]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+			return
+		}
+		targetDepth = folderDepth(all, *target)
+	}
+
+	// ZIP 需要随机读取，先写入临时文件
+	archivePath, _, _, err := config.CopyToTemp(file, maxLoad, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "read archive failed"})
+		return
+	}
+	defer os.Remove(archivePath)
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zip archive"})
+		return
+	}
+	defer zr.Close()
+	if len(zr.File) > config.ArchiveMaxEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many entries in archive"})
+		return
+	}
+
+	resp := ExtractResponse{Extracted: []ExtractedFile{}, Skipped: []SkippedEntry{}}
+	var plans []extractPlan
+	var declared int64
+	for _, zf := range zr.File {
+		plan, reason := planZipEntry(zf, maxLoad, targetDepth)
+		if plan == nil {
+			if reason != "" {
+				resp.Skipped = append(resp.Skipped, SkippedEntry{Path: zf.Name, Reason: reason})
+			}
+			continue
+		}
+		declared += int64(zf.UncompressedSize64)
+		plans = append(plans, *plan)
+	}
+	usedQuota, err := usedUploadQuota(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if usedQuota+declared > maxTotal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "storage limit exceeded"})
+		return
+	}
+
+	for _, p := range plans {
+		folderID, err := ensureFolderPath(userID, all, target, p.dirs)
+		if err != nil {
+			resp.Skipped = append(resp.Skipped, SkippedEntry{Path: p.path, Reason: err.Error()})
+			continue
+		}
+		out, reason, err := extractZipEntry(c.Request.Context(), userID, p, folderID, maxLoad, maxTotal)
+		if err != nil {
+			log.L().Warn("extract zip entry failed", zap.String("path", p.path), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "extract failed", "extracted": resp.Extracted, "skipped": resp.Skipped})
+			return
+		}
+		if reason != "" {
+			resp.Skipped = append(resp.Skipped, SkippedEntry{Path: p.path, Reason: reason})
+			continue
+		}
+		resp.Extracted = append(resp.Extracted, *out)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// 检查单个条目；返回 nil 时 reason 为跳过原因（目录条目不算跳过，reason 为空）
+func planZipEntry(zf *zip.File, maxLoad int64, targetDepth int) (*extractPlan, string) {
+	name := strings.ReplaceAll(zf.Name, `\`, "/")
+	if zf.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
+		return nil, "" // 目录按文件路径自动创建
+	}
+	if zf.Mode()&os.ModeType != 0 {
+		return nil, "not a regular file"
+	}
+	// 防止 zip-slip：拒绝绝对路径和 .. 穿越
+	rel, err := utils.SafeJoinRel(".", name)
+	if err != nil {
+		return nil, "unsafe path"
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	base := parts[len(parts)-1]
+	for _, p := range parts {
+		if strings.HasPrefix(p, ".") || p == "__MACOSX" {
+			return nil, "hidden file"
+		}
+	}
+	if !allowedExts[strings.ToLower(filepath.Ext(base))] {
+		return nil, "file type not allowed"
+	}
+	if int64(zf.UncompressedSize64) > maxLoad {
+		return nil, "file too large"
+	}
+	if zf.UncompressedSize64 == 0 {
+		return nil, "empty file"
+	}
+	dirs := parts[:len(parts)-1]
+	for i, d := range dirs {
+		clean, ok := cleanFolderName(d)
+		if !ok {
+			return nil, "invalid folder name"
+		}
+		dirs[i] = clean
+	}
+	if targetDepth+len(dirs) > config.FolderMaxDepth {
+		return nil, "folders are nested too deeply"
+	}
+	return &extractPlan{zf: zf, path: strings.Join(parts, "/"), dirs: dirs, name: base}, ""
+}
+
+// 逐级查找或创建文件夹，返回最后一级的ID
+func ensureFolderPath(userID uint, all map[uint]models.Folder, parent *uint, dirs []string) (*uint, error) {
+	for _, name := range dirs {
+		var found *uint
+		for id, f := range all {
+			if f.Name == name && sameParent(f.ParentID, parent) {
+				found = &id
+				break
+			}
+		}
+		if found == nil {
+			if len(all) >= config.FolderMaxPerUser {
+				return nil, errors.New("too many folders")
+			}
+			f := models.Folder{UserID: userID, ParentID: parent, Name: name}
+			if err := global.DB.Create(&f).Error; err != nil {
+				return nil, errors.New("create folder failed")
+			}
+			all[f.ID] = f
+			found = &f.ID
+		}
+		parent = found
+	}
+	return parent, nil
+}
+
+// 解压单个条目并生成文件记录；内容与声明的大小不符等条目本身的问题返回 reason，存储或数据库错误返回 err
+func extractZipEntry(ctx context.Context, userID uint, p extractPlan, folderID *uint, maxLoad, maxTotal int64) (*ExtractedFile, string, error) {
+	rc, err := p.zf.Open()
+	if err != nil {
+		return nil, "unsupported compression", nil
+	}
+	defer rc.Close()
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(rc, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, "corrupt entry", nil
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	// 按声明的大小校验实际解压出的字节数，防止伪造大小的压缩炸弹
+	tmpPath, hash, written, err := config.CopyToTemp(io.MultiReader(bytes.NewReader(sniff[:n]), rc), maxLoad, int64(p.zf.UncompressedSize64))
+	if err != nil {
+		if errors.Is(err, utils.ErrSizeExceeded) || errors.Is(err, utils.ErrSizeMismatch) || errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) {
+			return nil, "corrupt entry", nil
+		}
+		return nil, "", err
+	}
+	scanStatus, scanDetail, err := config.ScanUpload(ctx, tmpPath, p.name)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err.Error(), nil
+	}
+	f := models.Files{
+		UserID:     userID,
+		Filename:   p.name,
+		FileType:   contentType,
+		FileSize:   written,
+		Hash:       hash,
+		FolderID:   folderID,
+		ScanStatus: scanStatus,
+		ScanDetail: scanDetail,
+	}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		// 解压前只按声明的大小检查过一次配额，同时进行的解压或上传可能已占用了配额：锁住用户行后按实际大小重新检查
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Users{}, userID).Error; err != nil {
+			return err
+		}
+		used, err := usedUploadQuotaTx(tx, userID, 0)
+		if err != nil {
+			return err
+		}
+		if used+written > maxTotal {
+			return errExtractQuotaExceeded
+		}
+		key, err := config.AttachBlob(tx, tmpPath, hash, written)
+		if err != nil {
+			return err
+		}
+		f.FilePath = key
+		return tx.Create(&f).Error
+	})
+	if errors.Is(err, errExtractQuotaExceeded) {
+		_ = os.Remove(tmpPath)
+		return nil, err.Error(), nil
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, "", err
+	}
+	config.EnqueueMedia(hash)
+	return &ExtractedFile{ID: f.ID, Filename: f.Filename, Path: p.path, FolderID: folderID, Size: written, ScanStatus: scanStatus}, "", nil
+}
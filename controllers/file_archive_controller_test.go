@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"archive/zip"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testZipFile(name string, size uint64, mode os.FileMode) *zip.File {
+	hdr := zip.FileHeader{Name: name, UncompressedSize64: size}
+	if mode != 0 {
+		hdr.SetMode(mode)
+	}
+	return &zip.File{FileHeader: hdr}
+}
+
+func TestPlanZipEntry(t *testing.T) {
+	const maxLoad = 1 << 20
+	cases := []struct {
+		name   string
+		entry  *zip.File
+		depth  int
+		path   string   // 期望的清理后路径，为空表示跳过
+		dirs   []string // 期望创建的文件夹
+		reason string
+	}{
+		{name: "plain file", entry: testZipFile("a.txt", 10, 0), path: "a.txt", dirs: []string{}},
+		{name: "nested file", entry: testZipFile("docs/2024/a.pdf", 10, 0), path: "docs/2024/a.pdf", dirs: []string{"docs", "2024"}},
+		{name: "backslash separators", entry: testZipFile(`docs\2024\a.pdf`, 10, 0), path: "docs/2024/a.pdf", dirs: []string{"docs", "2024"}},
+		{name: "dot segments inside", entry: testZipFile("docs/./x/../a.txt", 10, 0), path: "docs/a.txt", dirs: []string{"docs"}},
+		{name: "directory entry", entry: testZipFile("docs/", 0, 0)},
+		{name: "directory mode", entry: testZipFile("docs", 0, os.ModeDir|0755)},
+		{name: "parent traversal", entry: testZipFile("../evil.txt", 10, 0), reason: "unsafe path"},
+		{name: "nested traversal", entry: testZipFile("docs/../../evil.txt", 10, 0), reason: "unsafe path"},
+		{name: "backslash traversal", entry: testZipFile(`..\..\evil.txt`, 10, 0), reason: "unsafe path"},
+		{name: "absolute path", entry: testZipFile("/etc/evil.txt", 10, 0), reason: "unsafe path"},
+		{name: "absolute backslash path", entry: testZipFile(`\etc\evil.txt`, 10, 0), reason: "unsafe path"},
+		{name: "symlink", entry: testZipFile("link.txt", 10, os.ModeSymlink|0777), reason: "not a regular file"},
+		{name: "hidden file", entry: testZipFile(".env.txt", 10, 0), reason: "hidden file"},
+		{name: "hidden folder", entry: testZipFile(".git/a.txt", 10, 0), reason: "hidden file"},
+		{name: "macos metadata", entry: testZipFile("__MACOSX/a.txt", 10, 0), reason: "hidden file"},
+		{name: "disallowed type", entry: testZipFile("run.exe", 10, 0), reason: "file type not allowed"},
+		{name: "too large", entry: testZipFile("big.mp4", maxLoad+1, 0), reason: "file too large"},
+		{name: "empty", entry: testZipFile("empty.txt", 0, 0), reason: "empty file"},
+		{name: "too deep", entry: testZipFile(strings.Repeat("d/", 3)+"a.txt", 10, 0), depth: 8, reason: "folders are nested too deeply"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, reason := planZipEntry(tc.entry, maxLoad, tc.depth)
+			if reason != tc.reason {
+				t.Fatalf("reason = %q, want %q", reason, tc.reason)
+			}
+			if tc.path == "" {
+				if plan != nil {
+					t.Fatalf("plan = %+v, want skipped", plan)
+				}
+				return
+			}
+			if plan == nil {
+				t.Fatal("entry skipped, want extracted")
+			}
+			if plan.path != tc.path || !reflect.DeepEqual(plan.dirs, tc.dirs) {
+				t.Fatalf("plan = (%q, %q), want (%q, %q)", plan.path, plan.dirs, tc.path, tc.dirs)
+			}
+		})
+	}
+}
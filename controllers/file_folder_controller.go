@@ -0,0 +1,480 @@
+package controllers
+
+// 虚拟文件夹：可嵌套、重命名、移动；文件通过 folder_id 归属文件夹，内容的存储位置不变
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"project/config"
+	"project/global"
+	"project/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type createFolderDTO struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ParentID *uint  `json:"parent_id"` // 省略或 0 表示根目录
+}
+
+// updateFolderDTO 字段省略表示不修改；parent_id 为 0 表示移到根目录
+type updateFolderDTO struct {
+	Name     *string `json:"name" binding:"omitempty,max=100"`
+	ParentID *uint   `json:"parent_id"`
+}
+
+// updateFileDTO 重命名或移动文件；folder_id 为 0 表示移到根目录
+type updateFileDTO struct {
+	Filename *string `json:"filename" binding:"omitempty,max=255"`
+	FolderID *uint   `json:"folder_id"`
+}
+
+// folderItem 文件夹列表项，Path 为从根目录开始的完整路径
+type folderItem struct {
+	ID        uint      `json:"id"`
+	ParentID  *uint     `json:"parent_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	FileCount int64     `json:"file_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var errFolderNotFound = errors.New("folder not found")
+
+// 文件夹名：去掉首尾空白，不能为空、不能是 . 或 ..，不能包含路径分隔符和控制字符
+func cleanFolderName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || utf8.RuneCountInString(name) > 100 || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// 用户的全部文件夹（数量有上限），用于计算路径、层数和子树
+func loadFolders(userID uint) (map[uint]models.Folder, error) {
+	var rows []models.Folder
+	if err := global.DB.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]models.Folder, len(rows))
+	for _, f := range rows {
+		out[f.ID] = f
+	}
+	return out, nil
+}
+
+// 文件夹所在层数，根目录下的文件夹为 1
+func folderDepth(all map[uint]models.Folder, id uint) int {
+	depth := 0
+	for next := &id; next != nil && depth <= config.FolderMaxDepth; depth++ {
+		f, ok := all[*next]
+		if !ok {
+			break
+		}
+		next = f.ParentID
+	}
+	return depth
+}
+
+func folderPath(all map[uint]models.Folder, id uint) string {
+	var parts []string
+	for next := &id; next != nil && len(parts) <= config.FolderMaxDepth; {
+		f, ok := all[*next]
+		if !ok {
+			break
+		}
+		parts = append([]string{f.Name}, parts...)
+		next = f.ParentID
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// 文件夹及其全部子孙的ID，以及子树的高度（只有自身时为 1）
+func folderSubtree(all map[uint]models.Folder, id uint) ([]uint, int) {
+	children := map[uint][]uint{}
+	for _, f := range all {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+	ids := []uint{id}
+	height := 0
+	for level := []uint{id}; len(level) > 0; height++ {
+		var next []uint
+		for _, p := range level {
+			next = append(next, children[p]...)
+		}
+		ids = append(ids, next...)
+		level = next
+	}
+	return ids, height
+}
+
+// 同一父目录下是否已有同名文件夹
+func folderNameTaken(all map[uint]models.Folder, parentID *uint, name string, exclude uint) bool {
+	for _, f := range all {
+		if f.ID != exclude && f.Name == name && sameParent(f.ParentID, parentID) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// 0 表示根目录
+func parentOrRoot(id *uint) *uint {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return id
+}
+
+// ownFolderID 校验文件夹属于该用户；nil 表示根目录
+func ownFolderID(userID uint, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	var n int64
+	if err := global.DB.Model(&models.Folder{}).Where("id = ? AND user_id = ?", *id, userID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return errFolderNotFound
+	}
+	return nil
+}
+
+// ListFolders godoc
+// @Summary      我的文件夹
+// @Description  返回全部文件夹（扁平列表，按 parent_id 组成树），附带完整路径与其中的文件数（不含子文件夹和回收站）
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   folderItem
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/folders [get]
+func ListFolders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	var counts []struct {
+		FolderID uint
+		N        int64
+	}
+	global.DB.Model(&models.Files{}).Select("folder_id, COUNT(*) AS n").
+		Where("user_id = ? AND folder_id IS NOT NULL AND trashed_at IS NULL", userID).
+		Group("folder_id").Scan(&counts)
+	byFolder := make(map[uint]int64, len(counts))
+	for _, n := range counts {
+		byFolder[n.FolderID] = n.N
+	}
+	items := make([]folderItem, 0, len(all))
+	for id, f := range all {
+		items = append(items, folderItem{ID: id, ParentID: f.ParentID, Name: f.Name, Path: folderPath(all, id), FileCount: byFolder[id], CreatedAt: f.CreatedAt})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	c.JSON(http.StatusOK, items)
+}
+
+// CreateFolder godoc
+// @Summary      新建文件夹
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.createFolderDTO  true  "名称与父文件夹"
+// @Success      201   {object}  folderItem
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/folders [post]
+func CreateFolder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var in createFolderDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := cleanFolderName(in.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder name"})
+		return
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	parentID := parentOrRoot(in.ParentID)
+	if parentID != nil {
+		if _, ok := all[*parentID]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "parent folder not found"})
+			return
+		}
+		if folderDepth(all, *parentID) >= config.FolderMaxDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "folders are nested too deeply"})
+			return
+		}
+	}
+	if len(all) >= config.FolderMaxPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many folders"})
+		return
+	}
+	if folderNameTaken(all, parentID, name, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a folder with this name already exists"})
+		return
+	}
+	f := models.Folder{UserID: userID, ParentID: parentID, Name: name}
+	if err := global.DB.Create(&f).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create folder failed"})
+		return
+	}
+	all[f.ID] = f
+	c.JSON(http.StatusCreated, folderItem{ID: f.ID, ParentID: f.ParentID, Name: f.Name, Path: folderPath(all, f.ID), CreatedAt: f.CreatedAt})
+}
+
+// UpdateFolder godoc
+// @Summary      重命名或移动文件夹
+// @Description  name 与 parent_id 可只传其一；parent_id 为 0 表示移到根目录，不能移到自身或其子文件夹中
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                          true  "文件夹ID"
+// @Param        body  body      controllers.updateFolderDTO  true  "新名称或新的父文件夹"
+// @Success      200   {object}  folderItem
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/folders/{id} [patch]
+func UpdateFolder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+		return
+	}
+	var in updateFolderDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	f, ok := all[uint(id)]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return
+	}
+	if in.Name != nil {
+		if f.Name, ok = cleanFolderName(*in.Name); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder name"})
+			return
+		}
+	}
+	if in.ParentID != nil {
+		parentID := parentOrRoot(in.ParentID)
+		if parentID != nil {
+			if _, ok := all[*parentID]; !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "parent folder not found"})
+				return
+			}
+			subtree, height := folderSubtree(all, f.ID)
+			for _, sub := range subtree {
+				if sub == *parentID {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "cannot move a folder into itself"})
+					return
+				}
+			}
+			if folderDepth(all, *parentID)+height > config.FolderMaxDepth {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "folders are nested too deeply"})
+				return
+			}
+		}
+		f.ParentID = parentID
+	}
+	if folderNameTaken(all, f.ParentID, f.Name, f.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a folder with this name already exists"})
+		return
+	}
+	if err := global.DB.Model(&models.Folder{}).Where("id = ?", f.ID).
+		Updates(map[string]any{"name": f.Name, "parent_id": f.ParentID}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update folder failed"})
+		return
+	}
+	all[f.ID] = f
+	c.JSON(http.StatusOK, folderItem{ID: f.ID, ParentID: f.ParentID, Name: f.Name, Path: folderPath(all, f.ID), CreatedAt: f.CreatedAt})
+}
+
+// DeleteFolder godoc
+// @Summary      删除文件夹
+// @Description  同时删除其中的子文件夹；其中的文件移入回收站，恢复后位于根目录
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "文件夹ID"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/folders/{id} [delete]
+func DeleteFolder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+		return
+	}
+	all, err := loadFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if _, ok := all[uint(id)]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return
+	}
+	subtree, _ := folderSubtree(all, uint(id))
+	var trashed int64
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Files{}).
+			Where("user_id = ? AND folder_id IN ? AND trashed_at IS NULL", userID, subtree).
+			UpdateColumn("trashed_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		trashed = res.RowsAffected
+		// 文件的 folder_id 由外键置空
+		return tx.Where("id IN ? AND user_id = ?", subtree, userID).Delete(&models.Folder{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete folder failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "deleted", "folders": len(subtree), "trashed_files": trashed})
+}
+
+// UpdateFile godoc
+// @Summary      重命名或移动文件
+// @Description  filename 与 folder_id 可只传其一；folder_id 为 0 表示移到根目录；重命名不能修改扩展名（上传扫描按扩展名检查了文件头）
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                        true  "文件ID"
+// @Param        body  body      controllers.updateFileDTO  true  "新文件名或目标文件夹"
+// @Success      200   {object}  map[string]string
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/{id} [patch]
+func UpdateFile(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	var in updateFileDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var f models.Files
+	if err := global.DB.First(&f, "id = ? AND trashed_at IS NULL", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if f.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission ,forbidden"})
+		return
+	}
+	updates := map[string]any{}
+	if in.Filename != nil {
+		name := filepath.Base(strings.TrimSpace(*in.Filename))
+		ext := strings.ToLower(filepath.Ext(name))
+		if name == "." || name == "/" || !allowedExts[ext] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filename or file type not allowed"})
+			return
+		}
+		// 文件头只按上传时的扩展名检查过，改扩展名会绕过检查
+		if ext != strings.ToLower(filepath.Ext(f.Filename)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "changing the file extension is not allowed"})
+			return
+		}
+		updates["filename"] = name
+	}
+	if in.FolderID != nil {
+		folderID := parentOrRoot(in.FolderID)
+		if err := ownFolderID(userID, folderID); err != nil {
+			if errors.Is(err, errFolderNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+			}
+			return
+		}
+		updates["folder_id"] = folderID
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	if err := global.DB.Model(&models.Files{}).Where("id = ?", f.ID).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update file failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "updated"})
+}
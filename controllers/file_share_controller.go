@@ -0,0 +1,405 @@
+package controllers
+
+// 文件分享链接：所有者生成 /s/<slug> 链接，他人无需登录即可下载；可设置访问密码、有效期与下载次数上限
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	shareListLimit          = 200
+	shareCookiePrefix       = "share_"
+	shareResumeCookiePrefix = "share_resume_"
+)
+
+// createShareDTO 生成分享链接；ExpiresInHours 为 0 表示永不过期，MaxDownloads 为 0 表示不限次数
+type createShareDTO struct {
+	Password       string `json:"password" binding:"omitempty,min=4,max=72"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"min=0,max=8760"`
+	MaxDownloads   int    `json:"max_downloads" binding:"min=0,max=100000"`
+}
+
+type unlockShareDTO struct {
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// shareItem 分享链接列表项
+type shareItem struct {
+	ID           uint       `json:"id"`
+	FileID       uint       `json:"file_id"`
+	Filename     string     `json:"filename"`
+	Slug         string     `json:"slug"`
+	URL          string     `json:"url"`
+	HasPassword  bool       `json:"has_password"`
+	MaxDownloads int        `json:"max_downloads"`
+	Downloads    int        `json:"downloads"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Usable       bool       `json:"usable"`
+}
+
+// shareInfoResponse 分享页展示的信息；需要密码时在验证前不返回文件信息
+type shareInfoResponse struct {
+	PasswordRequired bool       `json:"password_required"`
+	Filename         string     `json:"filename,omitempty"`
+	Size             int64      `json:"size,omitempty"`
+	ContentType      string     `json:"content_type,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	DownloadsLeft    *int       `json:"downloads_left"` // 为空表示不限次数
+}
+
+func toShareItem(s *models.FileShare) shareItem {
+	item := shareItem{
+		ID:           s.ID,
+		FileID:       s.FileID,
+		Slug:         s.Slug,
+		URL:          "/s/" + s.Slug,
+		HasPassword:  s.PasswordHash != "",
+		MaxDownloads: s.MaxDownloads,
+		Downloads:    s.Downloads,
+		ExpiresAt:    s.ExpiresAt,
+		RevokedAt:    s.RevokedAt,
+		CreatedAt:    s.CreatedAt,
+		Usable:       s.Usable(time.Now()),
+	}
+	if s.File != nil {
+		item.Filename = s.File.Filename
+	}
+	return item
+}
+
+// 按 slug 读取可用的分享链接及其文件，不可用时直接响应
+func loadShare(c *gin.Context) (*models.FileShare, *models.Files, bool) {
+	var s models.FileShare
+	if err := global.DB.Where("slug = ? AND revoked_at IS NULL", c.Param("slug")).First(&s).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+		return nil, nil, false
+	}
+	if !s.Usable(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "share link has expired or reached its download limit"})
+		return nil, nil, false
+	}
+	// 所有者已注销（含冷静期中）、被暂停或封禁时链接不可用
+	var owner models.Users
+	if err := global.DB.Unscoped().Select("id", "status", "suspended_until", "deleted_at").First(&owner, s.UserID).Error; err != nil ||
+		owner.DeletedAt.Valid || owner.IsBlocked(time.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+		return nil, nil, false
+	}
+	var f models.Files
+	if err := global.DB.Where("trashed_at IS NULL").First(&f, s.FileID).Error; err != nil { // 文件已被删除或在回收站中
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+		return nil, nil, false
+	}
+	return &s, &f, true
+}
+
+// 有访问密码的分享：持有输入密码后下发的 cookie。
+// 密码只能通过限流的 unlock 接口提交，下载与信息接口不校验密码，避免被用来穷举
+func shareUnlocked(c *gin.Context, s *models.FileShare) bool {
+	if s.PasswordHash == "" {
+		return true
+	}
+	return shareCookieValid(c, shareCookiePrefix, config.RedisShareUnlock, s)
+}
+
+// cookie 中的凭据在 Redis 中存在且属于该分享
+func shareCookieValid(c *gin.Context, prefix, redisKey string, s *models.FileShare) bool {
+	token, err := c.Cookie(prefix + s.Slug)
+	if err != nil || token == "" {
+		return false
+	}
+	id, err := global.RedisDB.Get(fmt.Sprintf(redisKey, utils.HashToken(token))).Uint64()
+	return err == nil && uint(id) == s.ID
+}
+
+// 下发只对该链接有效的 cookie 凭据
+func issueShareCookie(c *gin.Context, prefix, redisKey string, s *models.FileShare, ttl time.Duration) error {
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	if err := global.RedisDB.Set(fmt.Sprintf(redisKey, utils.HashToken(token)), s.ID, ttl).Err(); err != nil {
+		return err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(prefix+s.Slug, token, int(ttl.Seconds()), "/s/"+s.Slug, "", utils.CookieSecure, true)
+	return nil
+}
+
+// CreateFileShare godoc
+// @Summary      生成分享链接
+// @Description  只能分享自己的文件；链接为 /s/{slug}，可选访问密码、有效期（小时）与下载次数上限
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                          true  "文件ID"
+// @Param        body  body      controllers.createShareDTO   true  "密码、有效期、下载次数上限"
+// @Success      201   {object}  shareItem
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/{id}/shares [post]
+func CreateFileShare(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	var in createShareDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var f models.Files
+	if err := global.DB.Where("trashed_at IS NULL").First(&f, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if f.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can share this file"})
+		return
+	}
+	var active int64
+	global.DB.Model(&models.FileShare{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&active)
+	if active >= config.ShareMaxPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many active share links, revoke some first"})
+		return
+	}
+	slug, err := utils.NewOpaqueToken(config.ShareSlugBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create share failed"})
+		return
+	}
+	row := models.FileShare{FileID: f.ID, UserID: userID, Slug: slug, MaxDownloads: in.MaxDownloads}
+	if in.Password != "" {
+		if row.PasswordHash, err = utils.HashPassword(in.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create share failed"})
+			return
+		}
+	}
+	if in.ExpiresInHours > 0 {
+		exp := time.Now().Add(time.Duration(min(in.ExpiresInHours, config.ShareMaxValidHours)) * time.Hour)
+		row.ExpiresAt = &exp
+	}
+	if err := global.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create share failed"})
+		return
+	}
+	row.File = &f
+	c.JSON(http.StatusCreated, toShareItem(&row))
+}
+
+// ListFileShares godoc
+// @Summary      我的分享链接
+// @Description  默认只返回未撤销的链接，all=true 时包含已撤销的；file_id 可只看某个文件的分享
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        file_id  query     int   false  "文件ID"
+// @Param        all      query     bool  false  "是否包含已撤销的链接"
+// @Success      200      {array}   shareItem
+// @Failure      401      {object}  ErrorResponse
+// @Failure      500      {object}  ErrorResponse
+// @Router       /files/shares [get]
+func ListFileShares(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	db := global.DB.Preload("File").Where("user_id = ?", userID)
+	if fileID, err := strconv.ParseUint(c.Query("file_id"), 10, 64); err == nil && fileID > 0 {
+		db = db.Where("file_id = ?", fileID)
+	}
+	if all, _ := strconv.ParseBool(c.Query("all")); !all {
+		db = db.Where("revoked_at IS NULL")
+	}
+	var rows []models.FileShare
+	if err := db.Order("created_at DESC").Limit(shareListLimit).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]shareItem, 0, len(rows))
+	for i := range rows {
+		items = append(items, toShareItem(&rows[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// RevokeFileShare godoc
+// @Summary      撤销分享链接
+// @Description  撤销后链接立即失效，已输入密码的访问者也无法继续下载
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "分享ID"
+// @Success      200  {object}  map[string]bool
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/shares/{id} [delete]
+func RevokeFileShare(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+		return
+	}
+	res := global.DB.Model(&models.FileShare{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke share failed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ShareInfo godoc
+// @Summary      分享链接信息（无需登录）
+// @Tags         Share
+// @Produce      json
+// @Param        slug  path      string  true  "分享链接"
+// @Success      200   {object}  shareInfoResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      410   {object}  ErrorResponse
+// @Router       /s/{slug}/info [get]
+func ShareInfo(c *gin.Context) {
+	s, f, ok := loadShare(c)
+	if !ok {
+		return
+	}
+	out := shareInfoResponse{PasswordRequired: !shareUnlocked(c, s), ExpiresAt: s.ExpiresAt}
+	if s.MaxDownloads > 0 {
+		left := s.MaxDownloads - s.Downloads
+		out.DownloadsLeft = &left
+	}
+	if !out.PasswordRequired {
+		out.Filename, out.Size, out.ContentType = f.Filename, f.FileSize, f.FileType
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// UnlockShare godoc
+// @Summary      输入分享密码（无需登录）
+// @Description  密码正确后下发只对该链接有效的 cookie，一小时内可直接下载
+// @Tags         Share
+// @Accept       json
+// @Produce      json
+// @Param        slug  path      string                       true  "分享链接"
+// @Param        body  body      controllers.unlockShareDTO   true  "访问密码"
+// @Success      200   {object}  map[string]bool
+// @Failure      400   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      410   {object}  ErrorResponse
+// @Router       /s/{slug}/unlock [post]
+func UnlockShare(c *gin.Context) {
+	s, _, ok := loadShare(c)
+	if !ok {
+		return
+	}
+	var in unlockShareDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.PasswordHash != "" && !CheckPassword(s.PasswordHash, in.Password) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "wrong password"})
+		return
+	}
+	if err := issueShareCookie(c, shareCookiePrefix, config.RedisShareUnlock, s, config.ShareUnlockTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unlock failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// DownloadShare godoc
+// @Summary      通过分享链接下载（无需登录）
+// @Description  与 /files/{id} 相同支持 Range/304 与 download=1；有密码时需先调用 unlock 并携带其下发的 cookie，浏览器访问时显示输入密码的页面。每次输出内容都计入该链接的下载次数，计数后一小时内带着下发的续传 cookie 的 Range 请求不再计数
+// @Tags         Share
+// @Produce      application/octet-stream
+// @Param        slug      path    string  true   "分享链接"
+// @Param        download  query   int     false  "1=attachment; 省略或0=inline"
+// @Success      200       {file}  file
+// @Failure      401       {object}  ErrorResponse
+// @Failure      404       {object}  ErrorResponse
+// @Failure      410       {object}  ErrorResponse
+// @Router       /s/{slug} [get]
+func DownloadShare(c *gin.Context) {
+	s, f, ok := loadShare(c)
+	if !ok {
+		return
+	}
+	if !shareUnlocked(c, s) {
+		if strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.HTML(http.StatusOK, "share.html", nil)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password required", "code": "share_password_required"})
+		return
+	}
+	c.Header("Cache-Control", "private, no-cache") // 每次都回源校验，撤销后缓存立即失效
+	serveFile(c, f, func() bool {
+		// 已计数下载的断点续传、拖动进度条不重复计数；其他 Range 请求同样输出内容，照常计数
+		if c.GetHeader("Range") != "" && shareCookieValid(c, shareResumeCookiePrefix, config.RedisShareResume, s) {
+			return true
+		}
+		res := global.DB.Model(&models.FileShare{}).
+			Where("id = ? AND (max_downloads = 0 OR downloads < max_downloads)", s.ID).
+			UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+			return false
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusGone, gin.H{"error": "share link has reached its download limit"})
+			return false
+		}
+		if err := issueShareCookie(c, shareResumeCookiePrefix, config.RedisShareResume, s, config.ShareResumeTTL); err != nil {
+			log.L().Warn("issue share resume token failed", zap.Uint("share_id", s.ID), zap.Error(err))
+		}
+		c.Header("X-Download-Count", strconv.Itoa(s.Downloads+1))
+		return true
+	})
+}
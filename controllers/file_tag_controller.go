@@ -0,0 +1,252 @@
+package controllers
+
+// 文件标签：用户自定义，设置文件标签时按名称自动创建；文件列表可按标签筛选
+import (
+	"errors"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errTooManyTags = errors.New("too many tags")
+
+type setFileTagsDTO struct {
+	Tags []string `json:"tags" binding:"max=20"` // 与 config.FileMaxTags 一致；空数组表示清除全部标签
+}
+
+// tagItem 标签列表项，FileCount 不含回收站中的文件
+type tagItem struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	FileCount int64  `json:"file_count"`
+}
+
+// 标签名：去掉首尾空白，1-32 个字符，不含控制字符和逗号
+func cleanTagName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 32 || strings.ContainsRune(name, ',') {
+		return "", false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// 文件列表中附带的标签名，按文件ID批量读取
+func loadFileTags(rows []models.Files) map[uint][]string {
+	out := make(map[uint][]string, len(rows))
+	if len(rows) == 0 {
+		return out
+	}
+	ids := make([]uint, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	var pairs []struct {
+		FileID uint
+		Name   string
+	}
+	global.DB.Model(&models.FileTag{}).Select("file_tags.file_id, tags.name").
+		Joins("JOIN tags ON tags.id = file_tags.tag_id").
+		Where("file_tags.file_id IN ?", ids).Order("tags.name").Scan(&pairs)
+	for _, p := range pairs {
+		out[p.FileID] = append(out[p.FileID], p.Name)
+	}
+	return out
+}
+
+// ListTags godoc
+// @Summary      我的标签
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   tagItem
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/tags [get]
+func ListTags(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	items := []tagItem{}
+	err := global.DB.Model(&models.Tag{}).
+		Select("tags.id, tags.name, COUNT(files.id) AS file_count").
+		Joins("LEFT JOIN file_tags ON file_tags.tag_id = tags.id").
+		Joins("LEFT JOIN files ON files.id = file_tags.file_id AND files.deleted_at IS NULL AND files.trashed_at IS NULL").
+		Where("tags.user_id = ?", userID).
+		Group("tags.id, tags.name").Order("tags.name").Scan(&items).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// SetFileTags godoc
+// @Summary      设置文件的标签
+// @Description  用给定的标签替换文件现有的标签，不存在的标签自动创建；传空数组清除全部标签
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                         true  "文件ID"
+// @Param        body  body      controllers.setFileTagsDTO  true  "标签名列表"
+// @Success      200   {object}  map[string][]string
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/{id}/tags [put]
+func SetFileTags(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	var in setFileTagsDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	names := make([]string, 0, len(in.Tags))
+	for _, raw := range in.Tags {
+		name, ok := cleanTagName(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag name: " + raw})
+			return
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > config.FileMaxTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many tags for one file"})
+		return
+	}
+	var f models.Files
+	if err := global.DB.First(&f, "id = ? AND trashed_at IS NULL", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if f.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission ,forbidden"})
+		return
+	}
+
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		var tags []models.Tag
+		if len(names) > 0 {
+			if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error; err != nil {
+				return err
+			}
+		}
+		if missing := len(names) - len(tags); missing > 0 {
+			var total int64
+			if err := tx.Model(&models.Tag{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+				return err
+			}
+			if total+int64(missing) > config.TagMaxPerUser {
+				return errTooManyTags
+			}
+			for _, name := range names {
+				if !slices.ContainsFunc(tags, func(t models.Tag) bool { return t.Name == name }) {
+					t := models.Tag{UserID: userID, Name: name}
+					// 并发创建同名标签时以已存在的为准
+					if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&t).Error; err != nil {
+						return err
+					}
+				}
+			}
+			if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("file_id = ?", f.ID).Delete(&models.FileTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		links := make([]models.FileTag, 0, len(tags))
+		for _, t := range tags {
+			links = append(links, models.FileTag{FileID: f.ID, TagID: t.ID})
+		}
+		return tx.Create(&links).Error
+	})
+	if errors.Is(err, errTooManyTags) {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many tags, delete some first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "set tags failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": names})
+}
+
+// DeleteTag godoc
+// @Summary      删除标签
+// @Description  从所有文件上移除该标签，文件本身不受影响
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "标签ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/tags/{id} [delete]
+func DeleteTag(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag id"})
+		return
+	}
+	found := false
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id IN (?)", tx.Model(&models.Tag{}).Select("id").Where("id = ? AND user_id = ?", id, userID)).
+			Delete(&models.FileTag{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Tag{})
+		found = res.RowsAffected > 0
+		return res.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete tag failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "deleted"})
+}
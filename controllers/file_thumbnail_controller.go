@@ -0,0 +1,141 @@
+package controllers
+
+// 图片缩略图：上传后由后台任务生成（见 config/media.go），这里只负责按尺寸输出
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"project/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 尺寸名对应已生成缩略图中从小到大的序号
+var thumbnailSizeNames = map[string]int{"sm": 0, "md": 1, "lg": 2}
+
+// GetThumbnail godoc
+// @Summary      获取图片缩略图
+// @Description  缩略图为 JPEG，已按 EXIF 方向摆正。size 可为 sm/md/lg 或像素数（取不小于它的最小尺寸）；后台尚未处理完时返回 202，不是图片时返回 404
+// @Tags         Files
+// @Produce      image/jpeg
+// @Security     BearerAuth
+// @Param        id    path   int     true   "文件ID"
+// @Param        size  query  string  false  "sm（默认）/md/lg 或像素数"
+// @Success      200   {file}    file
+// @Success      202   {object}  map[string]string
+// @Failure      400   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/{id}/thumbnail [get]
+func GetThumbnail(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var f models.Files
+	if err := global.DB.First(&f, "id = ? AND trashed_at IS NULL", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if f.UserID != userID {
+		if !canActOnOthers(c, models.PermFilesReadAny) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission ,forbidden"})
+			return
+		}
+		auditFileReadAny(c, &f, "thumbnail")
+	}
+	if blockedByScan(c, &f) {
+		return
+	}
+
+	var b models.Blob
+	if f.Hash == "" || global.DB.Where("hash = ?", f.Hash).Take(&b).Error != nil {
+		// 旧文件迁移为内容存储后才会处理
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+		return
+	}
+	switch b.MediaStatus {
+	case models.MediaPending:
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+		return
+	case models.MediaReady:
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "no thumbnail for this file"})
+		return
+	}
+	sizes := config.ParseThumbs(b.Thumbs)
+	size, ok := pickThumbnailSize(sizes, c.DefaultQuery("size", "sm"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid size"})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, b.Hash, size) // 内容不变缩略图就不变
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(config.ThumbnailCacheAge.Seconds())))
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatch(inm, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	obj, err := global.Storage.Get(c.Request.Context(), config.ThumbnailKey(b.Hash, size))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no thumbnail for this file"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "read thumbnail failed"})
+		}
+		return
+	}
+	defer obj.Close()
+	c.Header("Content-Type", "image/jpeg")
+	http.ServeContent(c.Writer, c.Request, "", b.UpdatedAt, obj)
+}
+
+// 按尺寸名或像素数选出已生成的缩略图边长
+func pickThumbnailSize(sizes []int, want string) (int, bool) {
+	if len(sizes) == 0 {
+		return 0, false
+	}
+	if i, ok := thumbnailSizeNames[want]; ok {
+		return sizes[min(i, len(sizes)-1)], true
+	}
+	px, err := strconv.Atoi(want)
+	if err != nil || px <= 0 {
+		return 0, false
+	}
+	for _, s := range sizes {
+		if s >= px {
+			return s, true
+		}
+	}
+	return sizes[len(sizes)-1], true
+}
+
+// 文件列表中附带的图片信息，按哈希批量读取
+func loadBlobMedia(rows []models.Files) map[string]models.Blob {
+	var hashes []string
+	for _, r := range rows {
+		if r.Hash != "" {
+			hashes = append(hashes, r.Hash)
+		}
+	}
+	out := make(map[string]models.Blob, len(hashes))
+	if len(hashes) == 0 {
+		return out
+	}
+	var blobs []models.Blob
+	global.DB.Select("hash", "media_status", "width", "height", "exif").Where("hash IN ?", hashes).Find(&blobs)
+	for _, b := range blobs {
+		out[b.Hash] = b
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package controllers
+
+// 文件回收站：删除的文件保留 upload.trashRetentionDays 天，期间可恢复，到期后由定时任务彻底删除（见 config/trash.go）
+import (
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrashItem 回收站列表项；回收站中的文件仍占用配额
+type TrashItem struct {
+	ID          uint      `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	FolderID    *uint     `json:"folder_id"` // 原所在文件夹，文件夹已删除时为空，恢复后位于根目录
+	TrashedAt   time.Time `json:"trashed_at"`
+	PurgeAt     time.Time `json:"purge_at"` // 到期彻底删除的时间
+}
+
+type ListTrashResponse struct {
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Items    []TrashItem `json:"items"`
+}
+
+// 读取当前用户回收站中的文件，不存在时直接响应
+func loadTrashedFile(c *gin.Context) (*models.Files, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return nil, false
+	}
+	var f models.Files
+	if err := global.DB.First(&f, "id = ? AND user_id = ? AND trashed_at IS NOT NULL", id, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found in trash"})
+		return nil, false
+	}
+	return &f, true
+}
+
+// ListTrash godoc
+// @Summary      回收站
+// @Description  按移入时间倒序分页列出回收站中的文件及其彻底删除的时间
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        page       query     int  false  "页码（默认1）"
+// @Param        page_size  query     int  false  "每页的条数（默认20，最大100）"
+// @Success      200        {object}  ListTrashResponse
+// @Failure      401        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /files/trash [get]
+func ListTrash(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 || size > 100 {
+		size = 20
+	}
+	db := global.DB.Model(&models.Files{}).Where("user_id = ? AND trashed_at IS NOT NULL", userID)
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	var rows []models.Files
+	if err := db.Order("trashed_at DESC").Offset((page - 1) * size).Limit(size).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	retention := config.TrashRetention()
+	items := make([]TrashItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, TrashItem{
+			ID:          r.ID,
+			Filename:    r.Filename,
+			ContentType: r.FileType,
+			SizeBytes:   r.FileSize,
+			FolderID:    r.FolderID,
+			TrashedAt:   *r.TrashedAt,
+			PurgeAt:     r.TrashedAt.Add(retention),
+		})
+	}
+	c.JSON(http.StatusOK, ListTrashResponse{Total: total, Page: page, PageSize: size, Items: items})
+}
+
+// RestoreFile godoc
+// @Summary      从回收站恢复文件
+// @Description  恢复到原文件夹；原文件夹已删除时恢复到根目录
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "文件ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/trash/{id}/restore [post]
+func RestoreFile(c *gin.Context) {
+	f, ok := loadTrashedFile(c)
+	if !ok {
+		return
+	}
+	if err := global.DB.Model(f).UpdateColumn("trashed_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "restore file failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "restored"})
+}
+
+// PurgeTrashedFile godoc
+// @Summary      彻底删除回收站中的文件
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "文件ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/trash/{id} [delete]
+func PurgeTrashedFile(c *gin.Context) {
+	f, ok := loadTrashedFile(c)
+	if !ok {
+		return
+	}
+	if err := config.DeleteFileRecord(f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "deleted"})
+}
+
+// EmptyTrash godoc
+// @Summary      清空回收站
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]int
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/trash [delete]
+func EmptyTrash(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	deleted := 0
+	for {
+		var rows []models.Files
+		if err := global.DB.Where("user_id = ? AND trashed_at IS NOT NULL", userID).
+			Order("id").Limit(config.BlobGCBatchSize).Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+			return
+		}
+		for i := range rows {
+			if err := config.DeleteFileRecord(&rows[i]); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "deleted": deleted})
+				return
+			}
+			deleted++
+		}
+		if len(rows) < config.BlobGCBatchSize {
+			break
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,13 +13,17 @@ import (
 	"path/filepath"
 	"project/config"
 	"project/global"
+	"project/log"
+	"project/media"
 	"project/models"
+	"project/storage"
 	"project/utils"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -31,10 +38,11 @@ var (
 )
 
 type UploadResponse struct {
-	Msg  string `json:"msg"`
-	ID   uint   `json:"id,omitempty"`
-	URL  string `json:"url,omitempty"`
-	Size string `json:"size"`
+	Msg        string `json:"msg"`
+	ID         uint   `json:"id,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Size       string `json:"size"`
+	ScanStatus string `json:"scan_status,omitempty"` // pending 表示扫描器暂不可用，扫描完成前不能下载
 }
 
 type ErrorResponse struct {
@@ -43,7 +51,7 @@ type ErrorResponse struct {
 
 // UploadFile godoc
 // @Summary      上传文件
-// @Description  使用相对路径存储；服务端校验扩展名/MIME、配额，写入相对目录（基于 CWD 的 config.AppConfig.Upload.Storagepath），并保存元信息到数据库。
+// @Description  服务端校验扩展名/MIME、配额，按内容的 SHA-256 存入上传目录（config.AppConfig.Upload.Storagepath）的 blobs 子目录，相同内容只保存一份；配额按每个文件的大小计算。
 // @Tags         Files
 // @Accept       multipart/form-data
 // @Produce      json
@@ -62,7 +70,6 @@ func UploadFile(c *gin.Context) {
 		return
 	}
 
-	baseRel := config.AppConfig.Upload.Storagepath                   // 这里是（相对）路径
 	maxLoad := int64(config.AppConfig.Upload.FileSize) * 1024 * 1024 //都化为64
 	maxTotal := int64(config.AppConfig.Upload.TotalSize) * 1024 * 1024
 
@@ -95,99 +102,76 @@ func UploadFile(c *gin.Context) {
 	contentType := http.DetectContentType(sniff[:n]) //后端这个函数来检测
 	reader := io.MultiReader(bytes.NewReader(sniff[:n]), file)
 
-	// 配额（写盘前）判断大小
-	var totalSize int64
-	global.DB.Model(&models.Files{}).
-		Where("user_id = ?", userID).
-		Select("COALESCE(SUM(file_size), 0)").
-		Scan(&totalSize)
-	if totalSize+header.Size > maxTotal {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "storage limit exceeded"})
+	// 配额（写盘前）判断大小，与分片上传一样计入未完成的上传会话预留的空间
+	totalSize, err := usedUploadQuota(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
 		return
 	}
-
-	// 目录 & 相对 key
-	dateDir := time.Now().Format("2006-01-02")
-	relDir := filepath.Join(fmt.Sprintf("user_%d", userID), dateDir)    //用户在文件里保存的路径名字
-	if dirPath, err := utils.SafeJoinRel(baseRel, relDir); err != nil { //这里dirPath是完整的相对路径
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
-		return
-	} else if err := os.MkdirAll(dirPath, 0755); err != nil { //创建
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "The syesytem create dir failed"})
+	if totalSize+header.Size > maxTotal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "storage limit exceeded"})
 		return
 	}
 
-	baseName := filepath.Base(header.Filename)                                           // 清洗并获得其文件名+拓展名
-	tmpRel, _ := utils.SafeJoinRel(baseRel, filepath.Join(relDir, "."+baseName+".part")) //先创建临时文件
-	finalRel, _ := utils.SafeJoinRel(baseRel, filepath.Join(relDir, baseName))           //完整的最终路径
-
-	out, err := os.Create(tmpRel)
+	// 写入临时文件的同时计算 SHA-256，内容已存在时只增加引用，不重复占用磁盘
+	tmpPath, hash, written, err := config.CopyToTemp(reader, maxLoad, header.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "create temp file failed"})
+		switch {
+		case errors.Is(err, utils.ErrSizeExceeded):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeded limit"})
+		case errors.Is(err, utils.ErrSizeMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file size mismatch"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "write file failed"})
+		}
 		return
 	}
-	defer out.Close()
 
-	// 直接拷贝文件，不计算hash（已移除去重功能）
-	written, err := io.Copy(out, io.LimitReader(reader, maxLoad+1))
+	baseName := filepath.Base(header.Filename) // 清洗并获得其文件名+拓展名
+	// 写入数据库前扫描内容，恶意或与扩展名不符的内容直接拒绝
+	scanStatus, scanDetail, err := config.ScanUpload(c.Request.Context(), tmpPath, baseName)
 	if err != nil {
-		_ = os.Remove(tmpRel)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "write file failed"})
-		return
-	}
-
-	// 检查文件大小
-	if written > maxLoad {
-		_ = os.Remove(tmpRel)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeded limit"})
-		return
-	}
-
-	if header.Size > 0 && written != header.Size {
-		_ = os.Remove(tmpRel)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file size mismatch"})
+		_ = os.Remove(tmpPath)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	if _, statErr := os.Stat(finalRel); statErr == nil {
-		_ = os.Remove(finalRel)
-	}
-	if err := os.Rename(tmpRel, finalRel); err != nil {
-		_ = os.Remove(tmpRel)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "The system commit file failed"})
-		return
-	}
-
-	// 相对 key（存库/对外） - 这个易错保证所有系统上的路径分割符一致 - 易错这个
-	finalKey := filepath.ToSlash(filepath.Join(relDir, baseName)) //不包括主的相对路径
-
-	// 入库（不进行哈希去重检查，允许上传相同内容的文件）
 	newFile := models.Files{
-		UserID:   userID,
-		Filename: baseName,
-		FileType: contentType,
-		FilePath: finalKey, // 相对 key
-		FileSize: written,
-		Hash:     "",                    // 不存储hash，避免唯一索引冲突
-		FileInfo: c.PostForm("content"), //上传的的文本信息内容
-	}
-	if err := global.DB.Create(&newFile).Error; err != nil {
-		_ = os.Remove(finalRel)
+		UserID:     userID,
+		Filename:   baseName,
+		FileType:   contentType,
+		FileSize:   written, // 配额按逻辑文件计算，与是否共享内容无关
+		Hash:       hash,
+		FileInfo:   c.PostForm("content"), //上传的的文本信息内容
+		ScanStatus: scanStatus,
+		ScanDetail: scanDetail,
+	}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		key, err := config.AttachBlob(tx, tmpPath, hash, written)
+		if err != nil {
+			return err
+		}
+		newFile.FilePath = key // 相对 key（存库/对外）
+		return tx.Create(&newFile).Error
+	})
+	if err != nil {
+		_ = os.Remove(tmpPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "save to database failed"})
 		return
 	}
+	config.EnqueueMedia(hash) // 图片在后台生成缩略图
 
 	c.JSON(http.StatusOK, &UploadResponse{
-		Msg:  "该文件上传成功！",
-		ID:   newFile.ID,
-		URL:  fmt.Sprintf("/files/%d", newFile.ID),
-		Size: utils.Get_size(written), //B
+		Msg:        "该文件上传成功！",
+		ID:         newFile.ID,
+		URL:        fmt.Sprintf("/files/%d", newFile.ID),
+		Size:       utils.Get_size(written), //B
+		ScanStatus: scanStatus,
 	})
 }
 
 // DownloadFile godoc
 // @Summary      下载/预览文件
-// @Description  根据文件ID下载或预览；支持 Range/304。query: download=1 为附件下载，否则 inline 预览。服务端会在成功响应时为该文件的下载次数 +1，并通过响应头 `X-Download-Count` 回传最新次数。
+// @Description  根据文件ID下载或预览；支持 Range/304。query: download=1 为附件下载，否则 inline 预览（只有图片、音视频、纯文本和 PDF 会 inline 打开，其余类型一律作为附件）。服务端会在成功响应时为该文件的下载次数 +1，并通过响应头 `X-Download-Count` 回传最新次数。
 // @Tags         Files
 // @Produce      application/octet-stream
 // @Security     BearerAuth
@@ -198,6 +182,7 @@ func UploadFile(c *gin.Context) {
 // @Failure      401       {object}  ErrorResponse
 // @Failure      403       {object}  ErrorResponse
 // @Failure      404       {object}  ErrorResponse
+// @Failure      423       {object}  ErrorResponse  "等待上传扫描完成"
 // @Failure      500       {object}  ErrorResponse
 // @Router       /files/{id} [get]
 func DownloadFile(c *gin.Context) {
@@ -210,73 +195,90 @@ func DownloadFile(c *gin.Context) {
 	}
 
 	var f models.Files
-	if err := global.DB.First(&f, "id = ?", id).Error; err != nil {
+	if err := global.DB.First(&f, "id = ? AND trashed_at IS NULL", id).Error; err != nil { // 回收站中的文件需先恢复
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
 	if f.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "No permission ,forbidden"})
-		return
+		if !canActOnOthers(c, models.PermFilesReadAny) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission ,forbidden"})
+			return
+		}
+		auditFileReadAny(c, &f, "download")
 	}
 
-	baseRel := config.AppConfig.Upload.Storagepath         // 相对基底，例如 "files"
-	relPath, err := utils.SafeJoinRel(baseRel, f.FilePath) //这里是从数据库中取相对base的文件路径-安全拼接加以保存
+	// 只有在实际发送文件内容时才增加下载计数
+	serveFile(c, &f, func() bool {
+		if err := global.DB.
+			Model(&models.Files{}). //更新
+			Where("id = ? AND user_id = ?", f.ID, userID).
+			UpdateColumn("downloads", gorm.Expr("downloads + ?", 1)).Error; err == nil { //gorm.Expr创建一个SQL表达式-对这里的参数+1
+
+			//获取其值
+			var newCnt int64
+			_ = global.DB.Model(&models.Files{}).
+				Where("id = ?", f.ID).
+				Select("downloads").
+				Scan(&newCnt).Error
+			c.Header("X-Download-Count", strconv.FormatInt(newCnt, 10)) //只要找到文件就下载量+1
+		}
+		return true
+	})
+}
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "It's invalid stored path"})
+// serveFile 输出文件内容：ETag/Last-Modified 缓存验证、Range、预签名重定向；
+// 确定要发送内容时调用 onServe（用于计数），onServe 返回 false 表示已自行响应并中止
+func serveFile(c *gin.Context, f *models.Files, onServe func() bool) {
+	if blockedByScan(c, f) {
 		return
 	}
-	fp, err := os.Open(relPath) //路径存在
+	info, err := global.Storage.Stat(c.Request.Context(), f.FilePath) //从存储后端获取对象信息，key 为数据库中的相对路径
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, storage.ErrNotExist) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "This file not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "The system opens file failed"})
 		}
 		return
 	}
-	defer fp.Close() //易忘
+	modTime := info.ModTime //获取文件的最后修改时间
 
-	stat, err := fp.Stat()          //获取当前文件状态
-	if err != nil || stat.IsDir() { //看其是否为目录
-		c.JSON(http.StatusNotFound, gin.H{"error": "This file not found"})
-		return
+	// 开启 stripGPS 时先读取 JPEG 开头，含定位信息则输出抹去后的内容（长度不变，Range 照常）
+	var obj storage.Object
+	var head []byte
+	if config.AppConfig.Upload.StripGPS && f.FileType == "image/jpeg" {
+		if obj, head, err = openWithoutGPS(c.Request.Context(), f.FilePath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "The system opens file failed"})
+			return
+		}
+		defer obj.Close()
 	}
-	modTime := stat.ModTime() //获取文件的最后修改时间
 
-	// 先定义etag变量
-	etag := `W/"` + f.Hash + `"` // W/+"文件内容的哈希值"
+	// 强 ETag 即内容的 SHA-256（抹去定位信息后的内容另加后缀）；去重上线前的旧文件迁移完成前没有哈希，不下发 ETag
+	etag := ""
+	if f.Hash != "" {
+		etag = `"` + f.Hash + `"`
+		if head != nil {
+			etag = `"` + f.Hash + `-nogps"`
+		}
+		c.Header("ETag", etag)
+	}
+	c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat)) //将文件上次修改的时间传回去
 
-	// 这里是缓存验证机制
-	if ims := c.GetHeader("If-Modified-Since"); ims != "" { // 获取请求头的If-Modified-Since值
-		if t, perr := http.ParseTime(ims); perr == nil && !modTime.After(t) { //解析客户端发送的时间字符串-检查客户端缓存的时间是否晚于文件修改时间
-			// 响应头都是键值对形式
-			c.Header("ETag", etag)                                           //设置对应的ETag头和Last-Modified
-			c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat)) //将文件上次修改的时间传回去
+	// 缓存验证：If-None-Match 优先，存在时忽略 If-Modified-Since；命中时不计下载次数
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etag != "" && etagMatch(inm, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if ims := c.GetHeader("If-Modified-Since"); ims != "" {
+		if t, perr := http.ParseTime(ims); perr == nil && !modTime.After(t) { //检查客户端缓存的时间是否晚于文件修改时间
 			c.Status(http.StatusNotModified)
 			return
 		}
 	}
 
-	// 只有在实际发送文件内容时才增加下载计数
-	if err := global.DB.
-		Model(&models.Files{}). //更新
-		Where("id = ? AND user_id = ?", f.ID, userID).
-		UpdateColumn("downloads", gorm.Expr("downloads + ?", 1)).Error; err == nil { //gorm.Expr创建一个SQL表达式-对这里的参数+1
-
-		//获取其值
-		var newCnt int64
-		_ = global.DB.Model(&models.Files{}).
-			Where("id = ?", f.ID).
-			Select("downloads").
-			Scan(&newCnt).Error
-		c.Header("X-Download-Count", strconv.FormatInt(newCnt, 10)) //只要找到文件就下载量+1
-	}
-
-	// 获取客户端即前端传来的ETag验证，获取其请求头并使用strings.Contains查找是否有对应的字串部分
-	if inm := c.GetHeader("If-None-Match"); inm != "" && strings.Contains(inm, f.Hash) {
-		c.Header("ETag", etag)
-		c.Status(http.StatusNotModified) //提前结束处理不发送文件内容
+	if !onServe() {
 		return
 	}
 
@@ -284,28 +286,105 @@ func DownloadFile(c *gin.Context) {
 	if ct == "" {
 		ct = "application/octet-stream" //默认二进制流类型
 	}
+	disp := "inline"                                   //浏览器会尝试直接显示文件
+	if c.Query("download") == "1" || !inlineSafe(ct) { //切换为强制下载；HTML、Office 文档等不在页面中打开
+		disp = "attachment"
+	}
+	filename := filepath.Base(f.Filename)                                                 //去除路径
+	disposition := fmt.Sprintf(`%s; filename*=UTF-8''%s`, disp, url.PathEscape(filename)) //UTF8处理文件名-URL文件名编码，到时候直接访问这个
+
+	// 对象存储可直接输出文件时重定向到预签名链接，不经过本服务中转；需要抹去定位信息时只能由本服务输出
+	if config.AppConfig.Upload.PresignDownloads && head == nil {
+		link, err := global.Storage.Presign(c.Request.Context(), f.FilePath, config.StoragePresignTTL,
+			storage.PresignOptions{ContentType: ct, ContentDisposition: disposition})
+		if err == nil {
+			c.Redirect(http.StatusFound, link)
+			return
+		}
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			log.L().Warn("presign download failed", zap.Uint("file_id", f.ID), zap.Error(err))
+		}
+	}
+
+	if obj == nil {
+		if obj, err = global.Storage.Get(c.Request.Context(), f.FilePath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "The system opens file failed"})
+			return
+		}
+		defer obj.Close() //易忘
+	}
 	c.Header("Content-Type", ct)
-	c.Header("ETag", etag)
-	c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	c.Header("Content-Disposition", disposition)
+	c.Header("X-Content-Type-Options", "nosniff") // 禁止浏览器按内容猜测类型，例如把像 HTML 的文本当网页渲染
 
-	disp := "inline"                //浏览器会尝试直接显示文件
-	if c.Query("download") == "1" { //切换为强制下载
-		disp = "attachment"
+	var content io.ReadSeeker = obj
+	if head != nil {
+		content = media.OverlayHead(obj, head)
+	}
+	http.ServeContent(c.Writer, c.Request, filename, modTime, content) //这个是文件流响应，Range/If-Range 按上面的 ETag 判断
+}
+
+// 可以在浏览器中直接打开的类型，其余一律作为附件下载
+var inlineTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/", "audio/", "text/plain", "application/pdf"}
+
+func inlineSafe(contentType string) bool {
+	for _, t := range inlineTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
 	}
-	filename := filepath.Base(f.Filename)                                                                   //去除路径
-	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename*=UTF-8''%s`, disp, url.PathEscape(filename))) //UTF8处理文件名-URL文件名编码，到时候直接访问这个
+	return false
+}
 
-	http.ServeContent(c.Writer, c.Request, filename, modTime, fp) //这个是文件流响应
+// 待扫描或已隔离的文件不能下载，已响应时返回 true
+func blockedByScan(c *gin.Context, f *models.Files) bool {
+	switch f.ScanStatus {
+	case models.ScanPending:
+		c.JSON(http.StatusLocked, gin.H{"error": "file is waiting for a malware scan, try again later"})
+	case models.ScanQuarantined:
+		c.JSON(http.StatusForbidden, gin.H{"error": "file is quarantined: " + f.ScanDetail})
+	default:
+		return false
+	}
+	return true
+}
+
+// 打开 JPEG 并检查开头的 EXIF：含 GPS 时返回抹去后的开头字节，否则 head 为 nil
+func openWithoutGPS(ctx context.Context, key string) (obj storage.Object, head []byte, err error) {
+	if obj, err = global.Storage.Get(ctx, key); err != nil {
+		return nil, nil, err
+	}
+	buf := make([]byte, min(obj.Info().Size, media.ExifScanSize))
+	if _, err = io.ReadFull(obj, buf); err != nil {
+		obj.Close()
+		return nil, nil, err
+	}
+	if media.StripGPS(buf) {
+		head = buf
+	}
+	return obj, head, nil
+}
+
+// If-None-Match 可以是以逗号分隔的多个 ETag 或 *，按弱比较（忽略 W/ 前缀）匹配
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // 依旧是给出文件id然后删除
 // DeleteFile godoc
 // @Summary      删除文件
-// @Description  根据ID删除当前用户的文件（先删磁盘，再删数据库）；文件不存在将被忽略以便幂等。
+// @Description  根据ID删除当前用户的文件：默认移入回收站，保留期内可恢复；permanent=1 或文件已在回收站时彻底删除记录并减少内容的引用数，最后一个引用删除后回收磁盘上的内容。
 // @Tags         Files
 // @Produce      json
 // @Security     BearerAuth
-// @Param        id   path  int  true  "文件ID"
+// @Param        id         path   int  true   "文件ID"
+// @Param        permanent  query  int  false  "1=跳过回收站直接彻底删除"
 // @Success      200  {object}  map[string]string
 // @Failure      401  {object}  ErrorResponse
 // @Failure      403  {object}  ErrorResponse
@@ -339,25 +418,15 @@ func DeleteFile(c *gin.Context) {
 		return
 	}
 
-	baseRel := config.AppConfig.Upload.Storagepath           // 相对基底，例如 "files"
-	finalPath, err := utils.SafeJoinRel(baseRel, f.FilePath) //获取文件的路径
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stored path"})
+	if f.TrashedAt == nil && c.Query("permanent") != "1" {
+		if err := global.DB.Model(&f).UpdateColumn("trashed_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "move to trash failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"msg": "moved to trash"})
 		return
 	}
-
-	// 事务：确保“删文件失败”能回滚数据库
-	if err := global.DB.Transaction(func(tx *gorm.DB) error {
-		// 先删磁盘（不存在则忽略，保证幂等）
-		if err := os.Remove(finalPath); err != nil && !os.IsNotExist(err) { //os.IsNotExist(err)如果其它类型错误存在false
-			return fmt.Errorf("remove file failed: %w", err)
-		}
-		// 删数据库
-		if err := tx.Delete(&models.Files{}, f.ID).Error; err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
+	if err := config.DeleteFileRecord(&f); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -376,6 +445,14 @@ type FileItem struct {
 	CreatedAt   time.Time `json:"created_at"`
 	Downloads   uint      `json:"downloads"`
 	FileInfo    string    `json:"fileinfo"`
+	FolderID    *uint     `json:"folder_id"` // 所在文件夹，为空表示根目录
+	Tags        []string  `json:"tags"`
+	ScanStatus  string    `json:"scan_status"` // pending 待扫描、quarantined 已隔离时不能下载
+	// 图片信息，后台处理完成前为空
+	Width        int               `json:"width,omitempty"`
+	Height       int               `json:"height,omitempty"`
+	Exif         map[string]string `json:"exif,omitempty"`
+	ThumbnailURL string            `json:"thumbnail_url,omitempty"`
 }
 
 type ListFilesResponse struct {
@@ -387,7 +464,7 @@ type ListFilesResponse struct {
 
 // ListMyFiles godoc
 // @Summary      列出当前用户的文件
-// @Description  支持按关键字、扩展名、MIME、时间范围、大小范围筛选，分页返回；按 created_at 排序。
+// @Description  支持按关键字、扩展名、MIME、时间范围、大小范围、文件夹、标签筛选，分页返回；按 created_at 排序。回收站中的文件不在此列出。
 // @Tags         Files
 // @Produce      json
 // @Security     BearerAuth
@@ -401,6 +478,8 @@ type ListFilesResponse struct {
 // @Param        page         query  int    false "页码（默认1）"
 // @Param        page_size    query  int    false "每页的条数（默认10，最大100）"
 // @Param        order        query  string false "排序：共四种组合，两种排序方式-上传日期和文件大小 created_desc（默认）/created_asc/size_desc/size_asc"
+// @Param        folder_id    query  string false "文件夹ID，0 或 root 为根目录；省略时不按文件夹筛选"
+// @Param        tag          query  []string false "标签名，可重复，须同时带有全部标签" collectionFormat(multi)
 // @Success      200  {object}  ListFilesResponse
 // @Failure      401  {object}  ErrorResponse
 // @Router       /files/lists [get]
@@ -410,11 +489,7 @@ func ListMyFiles(c *gin.Context) { //这里是展示用户的所有文件-并加
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	// 查找前先校准数据库
-	if err := syncFileWithDB(userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync files"})
-		return
-	}
+	// 记录与存储中内容的核对由存储一致性检查负责（config/consistency.go），列表不再逐个检查
 
 	// 解析HTTP请求，这个查询可以以各种各样的参数进行查询搜索
 	//查询q 后缀ext 文件文本类型 起始日期 结束日子 最小文件大小 最大文件
@@ -453,7 +528,29 @@ func ListMyFiles(c *gin.Context) { //这里是展示用户的所有文件-并加
 		}
 	}
 
-	db := global.DB.Model(&models.Files{}).Where("user_id = ?", userID) //查询对应的用户id
+	db := global.DB.Model(&models.Files{}).Where("user_id = ? AND trashed_at IS NULL", userID) //查询对应的用户id，不含回收站
+
+	// 虚拟文件夹：只看该层，不含子文件夹
+	switch folder := strings.TrimSpace(c.Query("folder_id")); folder {
+	case "":
+	case "0", "root":
+		db = db.Where("folder_id IS NULL")
+	default:
+		fid, err := strconv.ParseUint(folder, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder_id"})
+			return
+		}
+		db = db.Where("folder_id = ?", fid)
+	}
+	// 标签：须同时带有全部指定标签
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		db = db.Where("id IN (?)", global.DB.Model(&models.FileTag{}).Select("file_tags.file_id").
+			Joins("JOIN tags ON tags.id = file_tags.tag_id").Where("tags.user_id = ? AND tags.name = ?", userID, tag))
+	}
 
 	if q != "" { //查询文件名
 		like := "%" + q + "%"
@@ -515,9 +612,11 @@ func ListMyFiles(c *gin.Context) { //这里是展示用户的所有文件-并加
 		return
 	}
 
+	blobs := loadBlobMedia(rows)
+	tags := loadFileTags(rows)
 	items := make([]FileItem, 0, len(rows)) //构建切片，实际上这里的大小为size
 	for _, r := range rows {                //每个元素
-		items = append(items, FileItem{
+		item := FileItem{
 			ID:          r.ID,
 			Filename:    r.Filename,
 			ContentType: r.FileType,
@@ -527,7 +626,20 @@ func ListMyFiles(c *gin.Context) { //这里是展示用户的所有文件-并加
 			CreatedAt:   r.CreatedAt,
 			Downloads:   r.Downloads, //下载数
 			FileInfo:    r.FileInfo,
-		})
+			FolderID:    r.FolderID,
+			Tags:        tags[r.ID],
+			ScanStatus:  r.ScanStatus,
+		}
+		if b, ok := blobs[r.Hash]; ok {
+			item.Width, item.Height = b.Width, b.Height
+			if b.Exif != "" {
+				_ = json.Unmarshal([]byte(b.Exif), &item.Exif)
+			}
+			if b.MediaStatus == models.MediaReady {
+				item.ThumbnailURL = fmt.Sprintf("/api/files/%d/thumbnail", r.ID)
+			}
+		}
+		items = append(items, item)
 	}
 
 	c.JSON(http.StatusOK, ListFilesResponse{
@@ -537,28 +649,3 @@ func ListMyFiles(c *gin.Context) { //这里是展示用户的所有文件-并加
 		Items:    items, //数据
 	})
 }
-
-// 校准数据函数
-func syncFileWithDB(userID uint) error { //依据传来的用户id校准
-	// 获取该用户的所有文件记录
-	var files []models.Files
-	if err := global.DB.Where("user_id = ?", userID).Find(&files).Error; err != nil {
-		return err
-	}
-	baseRel := config.AppConfig.Upload.Storagepath
-	for _, f := range files { //一一查询遍历
-		// 构建完整文件路径
-		relPath, err := utils.SafeJoinRel(baseRel, f.FilePath)
-		if err != nil {
-			continue
-		}
-
-		// 检查文件是否存在
-		if _, err := os.Stat(relPath); os.IsNotExist(err) { //获得错误如果是不存在文件的错误-删除对应的数据
-			if err := global.DB.Delete(&f).Error; err != nil { //GORM会以这个建构提的主键即ID字段来删除
-				return err
-			}
-		}
-	}
-	return nil
-}
@@ -11,13 +11,6 @@ import (
 	"github.com/go-redis/redis"
 )
 
-var (
-	// 请求限制器
-	leaderboardLimiter = make(chan struct{}, 1000) // 限制并发1000
-)
-
-func exit_thread() { <-leaderboardLimiter }
-
 // 排行榜设置界面
 // 这里是从redis中读取某个用户的最佳成绩和排名
 // 分数排行设置isLowerBetter: true表示分数越低越好（如用时），false表示分数越高越好（如得分）
@@ -87,15 +80,6 @@ func myBestAndRank(zsetKey string, uid uint, isLowerBetter bool) (best int, rank
 // @Failure 500 {object} object{error=string} "服务器内部错误"
 // @Router /game/leaderboard/me [get]
 func GameLeaderboardMe(c *gin.Context) {
-
-	select {
-	case leaderboardLimiter <- struct{}{}: //送入空的结构体
-		defer exit_thread()
-	default:
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
-		return
-	}
-
 	uid := c.GetUint("user_id")
 	uname := c.GetString("username")
 	if uid == 0 || uname == "" {
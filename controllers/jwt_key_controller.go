@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"project/config"
+	"project/log"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// jwtKeysResponse 密钥环状态（只返回 kid，不返回密钥）
+type jwtKeysResponse struct {
+	CurrentKid   string   `json:"current_kid" example:"k20251101120000-a1b2c3"`
+	PreviousKids []string `json:"previous_kids"`
+}
+
+// ListJWTKeys
+// @Summary 查看JWT密钥环
+// @Description 返回当前签发密钥和仍在校验期内的历史密钥 kid（仅超级管理员）
+// @Tags System
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} jwtKeysResponse
+// @Failure 401 {object} map[string]string
+// @Router /superadmin/jwt/keys [get]
+func ListJWTKeys(c *gin.Context) {
+	if !config.HasPermission(c.GetString("role"), models.PermKeysManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission"})
+		return
+	}
+	current, previous := utils.JWTKeyIDs()
+	c.JSON(http.StatusOK, &jwtKeysResponse{CurrentKid: current, PreviousKids: previous})
+}
+
+// RotateJWTKey
+// @Summary 轮换JWT签名密钥
+// @Description 生成新的签名密钥用于后续签发，旧密钥保留到其签发的令牌全部过期（仅超级管理员）
+// @Tags System
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} jwtKeysResponse
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string "未配置 jwt.encryptionKey"
+// @Failure 500 {object} map[string]string
+// @Router /superadmin/jwt/rotate [post]
+func RotateJWTKey(c *gin.Context) {
+	if !config.HasPermission(c.GetString("role"), models.PermKeysManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission"})
+		return
+	}
+	kid, err := config.RotateJWTKey()
+	if errors.Is(err, config.ErrJWTEncryptionKeyMissing) {
+		c.JSON(http.StatusConflict, gin.H{"error": "configure jwt.encryptionKey before rotating keys"})
+		return
+	}
+	if err != nil {
+		log.L().Error("rotate jwt key failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rotate jwt key failed"})
+		return
+	}
+	log.L().Info("jwt signing key rotated", zap.String("kid", kid), zap.String("operator", c.GetString("username")))
+	current, previous := utils.JWTKeyIDs()
+	c.JSON(http.StatusOK, &jwtKeysResponse{CurrentKid: current, PreviousKids: previous})
+}
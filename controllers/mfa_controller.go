@@ -0,0 +1,528 @@
+package controllers
+
+// 两步验证（TOTP）：绑定、登录第二步、恢复码
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	errMFAChallengeInvalid = errors.New("two-factor login expired, please login again")
+	errMFACodeInvalid      = errors.New("invalid verification code")
+)
+
+// mfaLoginDTO 登录第二步
+type mfaLoginDTO struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // 6位验证码或恢复码
+}
+
+// mfaEnrollDTO 登录过程中绑定两步验证
+type mfaEnrollDTO struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"` // 确认绑定时必填
+}
+
+// mfaCodeDTO 已登录用户提交验证码
+type mfaCodeDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// mfaDisableDTO 关闭两步验证需要同时验证密码
+type mfaDisableDTO struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // 6位验证码或恢复码
+}
+
+// mfaSetupResponse 绑定信息：otpauth_url 用于生成二维码，secret 用于手动输入
+type mfaSetupResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURL string `json:"otpauth_url"`
+}
+
+// mfaStatusResponse 两步验证状态
+type mfaStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	Required          bool  `json:"required"` // 当前角色是否强制开启
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// mfaRecoveryCodesResponse 恢复码只在生成时返回一次
+type mfaRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// 密码验证通过后创建第二步凭据
+func startMFAChallenge(userID uint) (string, error) {
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf(config.RedisMFAPending, utils.HashToken(token))
+	if err := global.RedisDB.HMSet(key, map[string]interface{}{"uid": userID, "fails": 0}).Err(); err != nil {
+		return "", err
+	}
+	global.RedisDB.Expire(key, config.MFAPendingTTL)
+	return token, nil
+}
+
+// 读取第二步凭据对应的用户
+func loadMFAChallenge(token string) (*models.Users, string, error) {
+	key := fmt.Sprintf(config.RedisMFAPending, utils.HashToken(strings.TrimSpace(token)))
+	uid, err := global.RedisDB.HGet(key, "uid").Uint64()
+	if err != nil || uid == 0 {
+		return nil, key, errMFAChallengeInvalid
+	}
+	var user models.Users
+	if err := global.DB.Unscoped().First(&user, uid).Error; err != nil ||
+		(user.DeletedAt.Valid && !user.PendingDeletion(time.Now())) { // 冷静期内的账号允许登录以撤销注销
+		return nil, key, errMFAChallengeInvalid
+	}
+	if user.IsBlocked(time.Now()) {
+		global.RedisDB.Del(key)
+		return nil, key, errMFAChallengeInvalid
+	}
+	return &user, key, nil
+}
+
+// 验证码错误：同一凭据错误次数过多时作废，并计入账号的连续失败次数
+func failMFAChallenge(key, username string) {
+	recordLoginFailure(username)
+	if n, err := global.RedisDB.HIncrBy(key, "fails", 1).Result(); err == nil && n >= config.MFAMaxAttempts {
+		global.RedisDB.Del(key)
+	}
+}
+
+// 已登录用户提交验证码前检查锁定：与登录共用连续失败计数，输错次数过多时账号临时锁定
+func mfaAttemptAllowed(c *gin.Context, username string) bool {
+	if ttl, locked := loginLocked(username); locked {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(ttl.Seconds())))
+		c.JSON(http.StatusLocked, gin.H{"error": "too many failed attempts, account locked temporarily", "retry_after": int(ttl.Seconds())})
+		return false
+	}
+	return true
+}
+
+// 校验 TOTP 验证码，同一时间步的验证码只能使用一次
+func verifyTOTPCode(user *models.Users, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	ttl := time.Duration(3*utils.TOTPPeriod) * time.Second
+	first, err := global.RedisDB.SetNX(fmt.Sprintf(config.RedisTOTPUsed, user.ID, step), "1", ttl).Result()
+	if err != nil {
+		return true // Redis 不可用时不阻断登录
+	}
+	return first
+}
+
+// 第二步验证：6位验证码或一次性恢复码
+func verifySecondFactor(user *models.Users, code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) == utils.TOTPDigits {
+		return verifyTOTPCode(user, code)
+	}
+	return consumeRecoveryCode(user.ID, code)
+}
+
+// 恢复码格式 xxxxx-xxxxx，比较时忽略大小写和分隔符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func consumeRecoveryCode(userID uint, code string) bool {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false
+	}
+	// 条件更新保证并发请求中同一个恢复码只能成功一次
+	res := global.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected > 0
+}
+
+// 生成新的恢复码并作废旧的
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, config.RecoveryCodeSize)
+	rows := make([]models.RecoveryCode, 0, config.RecoveryCodeSize)
+	for i := 0; i < config.RecoveryCodeSize; i++ {
+		secret, err := utils.NewTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(secret[:10])
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(raw)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 生成待确认的密钥（此时尚未开启）
+func beginTOTPSetup(user *models.Users) (*mfaSetupResponse, error) {
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := global.DB.Model(&models.Users{}).Where("id = ?", user.ID).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	issuer := "Go-Web"
+	if config.AppConfig != nil && config.AppConfig.App.Name != "" {
+		issuer = config.AppConfig.App.Name
+	}
+	return &mfaSetupResponse{
+		Secret:     secret,
+		OtpauthURL: utils.TOTPProvisioningURI(issuer, user.Username, secret),
+	}, nil
+}
+
+// 验证码正确后开启两步验证并生成恢复码
+func confirmTOTPSetup(user *models.Users, code string) ([]string, error) {
+	if user.TOTPSecret == "" {
+		return nil, errors.New("two-factor setup has not been started")
+	}
+	if !verifyTOTPCode(user, code) {
+		return nil, errMFACodeInvalid
+	}
+	var codes []string
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Users{}).Where("id = ?", user.ID).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	config.ClearUserCache(user.Username) // 鉴权中间件依据缓存中的 TOTPEnabled 判断管理员是否已绑定
+	return codes, nil
+}
+
+// LoginMFA godoc
+// @Summary     登录第二步：两步验证
+// @Description 提交登录返回的 mfa_token 和验证器中的6位验证码（或一次性恢复码），验证通过后签发令牌
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      controllers.mfaLoginDTO  true  "第二步验证参数"
+// @Success     200   {object}  map[string]string  "token,refresh_token,expires_in,result_url"
+// @Failure     400   {object}  map[string]string
+// @Failure     401   {object}  map[string]string
+// @Router      /auth/login/2fa [post]
+func LoginMFA(c *gin.Context) {
+	var in mfaLoginDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, key, err := loadMFAChallenge(in.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled, please enroll first"})
+		return
+	}
+	if !verifySecondFactor(user, in.Code) {
+		failMFAChallenge(key, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errMFACodeInvalid.Error()})
+		return
+	}
+	global.RedisDB.Del(key) // 第二步凭据只能使用一次
+	clearLoginFailures(user.Username)
+	finishLogin(c, user, nil)
+}
+
+// EnrollMFA godoc
+// @Summary     登录过程中绑定两步验证
+// @Description 管理员首次登录时必须绑定：只提交 mfa_token 时返回密钥和二维码地址；同时提交 code 时确认绑定，返回恢复码并签发令牌
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      controllers.mfaEnrollDTO  true  "绑定参数"
+// @Success     200   {object}  mfaSetupResponse
+// @Failure     400   {object}  map[string]string
+// @Failure     401   {object}  map[string]string
+// @Router      /auth/2fa/enroll [post]
+func EnrollMFA(c *gin.Context) {
+	var in mfaEnrollDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, key, err := loadMFAChallenge(in.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if user.TOTPEnabled { // 已绑定的用户只能走验证流程，不能借此重置密钥
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if strings.TrimSpace(in.Code) == "" {
+		setup, err := beginTOTPSetup(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "start two-factor setup failed"})
+			return
+		}
+		c.JSON(http.StatusOK, setup)
+		return
+	}
+	codes, err := confirmTOTPSetup(user, in.Code)
+	if err != nil {
+		if errors.Is(err, errMFACodeInvalid) {
+			failMFAChallenge(key, user.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	global.RedisDB.Del(key)
+	clearLoginFailures(user.Username)
+	log.L().Info("two-factor authentication enabled", zap.Uint("user_id", user.ID))
+	finishLogin(c, user, gin.H{"recovery_codes": codes})
+}
+
+// 已登录用户从数据库读取完整信息（缓存中不含 TOTP 密钥）
+func loadCurrentUser(c *gin.Context) (*models.Users, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	var user models.Users
+	if err := global.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetMyMFA godoc
+// @Summary      查看两步验证状态
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  mfaStatusResponse
+// @Failure      401  {object}  ErrorResponse
+// @Router       /me/2fa [get]
+func GetMyMFA(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	var left int64
+	global.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&left)
+	c.JSON(http.StatusOK, &mfaStatusResponse{
+		Enabled:           user.TOTPEnabled,
+		Required:          config.RoleRequiresMFA(user.Role),
+		RecoveryCodesLeft: left,
+	})
+}
+
+// SetupMyMFA godoc
+// @Summary      开始绑定两步验证
+// @Description  生成新的 TOTP 密钥，返回 otpauth 地址（用于生成二维码）；需调用 /me/2fa/enable 提交验证码后才生效
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  mfaSetupResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Router       /me/2fa/setup [post]
+func SetupMyMFA(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	setup, err := beginTOTPSetup(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "start two-factor setup failed"})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableMyMFA godoc
+// @Summary      确认开启两步验证
+// @Description  提交验证器中的6位验证码，成功后开启两步验证并返回恢复码（仅显示一次）
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.mfaCodeDTO  true  "验证码"
+// @Success      200   {object}  mfaRecoveryCodesResponse
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      423   {object}  ErrorResponse  "输错次数过多，账号临时锁定"
+// @Router       /me/2fa/enable [post]
+func EnableMyMFA(c *gin.Context) {
+	var in mfaCodeDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if !mfaAttemptAllowed(c, user.Username) {
+		return
+	}
+	codes, err := confirmTOTPSetup(user, in.Code)
+	if errors.Is(err, errMFACodeInvalid) {
+		recordLoginFailure(user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	clearLoginFailures(user.Username)
+	log.L().Info("two-factor authentication enabled", zap.Uint("user_id", user.ID))
+	c.JSON(http.StatusOK, &mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMyMFA godoc
+// @Summary      关闭两步验证
+// @Description  需要同时提交密码和验证码（或恢复码）；管理员和超级管理员不能关闭
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.mfaDisableDTO  true  "密码和验证码"
+// @Success      200   {object}  map[string]bool
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      423   {object}  ErrorResponse  "输错次数过多，账号临时锁定"
+// @Router       /me/2fa/disable [post]
+func DisableMyMFA(c *gin.Context) {
+	var in mfaDisableDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if config.RoleRequiresMFA(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is mandatory for " + user.Role})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !mfaAttemptAllowed(c, user.Username) {
+		return
+	}
+	if !CheckPassword(user.Password, in.Password) || !verifySecondFactor(user, in.Code) {
+		recordLoginFailure(user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password or verification code"})
+		return
+	}
+	clearLoginFailures(user.Username)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Users{}).Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "disable two-factor authentication failed"})
+		return
+	}
+	config.ClearUserCache(user.Username)
+	log.L().Info("two-factor authentication disabled", zap.Uint("user_id", user.ID))
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RegenerateMyRecoveryCodes godoc
+// @Summary      重新生成恢复码
+// @Description  提交当前验证码后生成一组新的恢复码，旧的恢复码全部作废
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.mfaCodeDTO  true  "验证码"
+// @Success      200   {object}  mfaRecoveryCodesResponse
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      423   {object}  ErrorResponse  "输错次数过多，账号临时锁定"
+// @Router       /me/2fa/recovery_codes [post]
+func RegenerateMyRecoveryCodes(c *gin.Context) {
+	var in mfaCodeDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !mfaAttemptAllowed(c, user.Username) {
+		return
+	}
+	if !verifyTOTPCode(user, in.Code) {
+		recordLoginFailure(user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errMFACodeInvalid.Error()})
+		return
+	}
+	clearLoginFailures(user.Username)
+	var codes []string
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate recovery codes failed"})
+		return
+	}
+	c.JSON(http.StatusOK, &mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
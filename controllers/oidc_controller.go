@@ -0,0 +1,492 @@
+package controllers
+
+// 第三方登录（OIDC 授权码 + PKCE）：登录、首次登录自动建号、与已有账号绑定
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 发起授权的浏览器持有 state 的哈希，回调时必须一致，防止把别人的回调链接（攻击者的 code 与 state）发给受害者登录
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+// oidcState 发起授权时保存在 Redis 中，回调时取出校验
+type oidcState struct {
+	Provider   string `json:"provider"`
+	Verifier   string `json:"verifier"` // PKCE code_verifier
+	Nonce      string `json:"nonce"`
+	Next       string `json:"next"`
+	LinkUserID uint   `json:"link_user_id"` // 非零表示把身份绑定到该用户而不是登录
+}
+
+// oidcProviderItem 登录页展示的身份提供方
+type oidcProviderItem struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// identityItem 已绑定的第三方身份
+type identityItem struct {
+	ID          uint       `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LinkedAt    time.Time  `json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// unlinkIdentityDTO 解绑最后一个身份时需要验证密码，避免账号无法登录
+type unlinkIdentityDTO struct {
+	Password string `json:"password"`
+}
+
+// 只允许站内相对路径，防止开放重定向
+func safeNext(next string) string {
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\") {
+		return next
+	}
+	return ""
+}
+
+// 回调出错时回到登录页显示错误
+func oidcFail(c *gin.Context, msg string) {
+	c.Redirect(http.StatusFound, "/auth/login?oidc_error="+url.QueryEscape(msg))
+}
+
+// 生成 state/nonce/PKCE 并跳转到身份提供方
+func startOIDCAuth(c *gin.Context, p *config.OIDCProvider, linkUserID uint) {
+	state, err1 := utils.NewOpaqueToken(24)
+	nonce, err2 := utils.NewOpaqueToken(24)
+	verifier, challenge, err3 := utils.NewPKCEVerifier()
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "start oidc login failed"})
+		return
+	}
+	data, _ := json.Marshal(&oidcState{
+		Provider:   p.Name,
+		Verifier:   verifier,
+		Nonce:      nonce,
+		Next:       safeNext(c.Query("next")),
+		LinkUserID: linkUserID,
+	})
+	if err := global.RedisDB.Set(fmt.Sprintf(config.RedisOIDCState, state), data, config.OIDCStateTTL).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "start oidc login failed"})
+		return
+	}
+	authURL, err := p.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		log.L().Error("build oidc authorization url failed", zap.String("provider", p.Name), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+	// 身份提供方跳回时是跨站的顶层 GET 导航，Lax 的 cookie 会被携带
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, utils.HashToken(state), int(config.OIDCStateTTL.Seconds()), oidcStateCookiePath, "", utils.CookieSecure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// 回调的 state 是否由当前浏览器发起；校验后清除 cookie
+func oidcStateBound(c *gin.Context, state string) bool {
+	ck, err := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", utils.CookieSecure, true)
+	if err != nil || ck == "" || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ck), []byte(utils.HashToken(state))) == 1
+}
+
+// 回调请求所在浏览器当前登录的用户（回调路由不经过登录中间件），未登录或会话已失效时返回 0
+func oidcSessionUserID(c *gin.Context) uint {
+	token, err := c.Cookie(utils.CookieName)
+	if err != nil || token == "" {
+		return 0
+	}
+	claims, err := utils.ParseJWTClaims(token)
+	if err != nil || config.IsAccessTokenRevoked(claims.ID, claims.SessionID) {
+		return 0
+	}
+	var u models.Users
+	if err := global.DB.Where("username = ?", claims.Username).First(&u).Error; err != nil ||
+		u.TokenVersion != claims.Version || u.IsBlocked(time.Now()) {
+		return 0
+	}
+	return u.ID
+}
+
+// state 只能使用一次
+func takeOIDCState(state string) (*oidcState, bool) {
+	if state == "" {
+		return nil, false
+	}
+	key := fmt.Sprintf(config.RedisOIDCState, state)
+	data, err := global.RedisDB.Get(key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	if n, err := global.RedisDB.Del(key).Result(); err != nil || n == 0 { // 并发回调时只有一个能删除成功
+		return nil, false
+	}
+	var st oidcState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, false
+	}
+	return &st, true
+}
+
+// 由 ID Token 推导本地用户名：只保留字母数字，冲突时追加数字
+func oidcUsername(claims *utils.OIDCClaims) string {
+	candidates := []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name}
+	base := ""
+	for _, cand := range candidates {
+		base = strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return -1
+		}, cand)
+		if len(base) >= 3 {
+			break
+		}
+	}
+	if len(base) < 3 {
+		base = "user" + utils.HashToken(claims.Subject)[:8]
+	}
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	name := base
+	for i := 0; i < 5; i++ {
+		var cnt int64
+		global.DB.Unscoped().Model(&models.Users{}).Where("username = ?", name).Count(&cnt)
+		if cnt == 0 {
+			return name
+		}
+		suffix, _ := utils.NewOpaqueToken(3)
+		name = base + strings.ToLower(strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, suffix))
+	}
+	return name
+}
+
+// 首次登录自动创建普通用户；密码随机生成，用户无法用密码登录，除非管理员为其重置。
+// status 为 pending 时需要管理员审核后才能登录
+func createOIDCUser(p *config.OIDCProvider, claims *utils.OIDCClaims, status string) (*models.Users, error) {
+	random, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+	user := models.Users{Username: oidcUsername(claims), Password: hash, Role: "user", Status: status}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: p.Name,
+			Subject:  claims.Subject,
+			Email:    truncate(claims.Email, 255),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// OIDCProviders godoc
+// @Summary     可用的第三方登录方式
+// @Tags        Auth
+// @Produce     json
+// @Success     200  {array}  oidcProviderItem
+// @Router      /auth/oidc/providers [get]
+func OIDCProviders(c *gin.Context) {
+	items := make([]oidcProviderItem, 0)
+	for _, p := range config.OIDCProviders() {
+		items = append(items, oidcProviderItem{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			LoginURL:    "/api/auth/oidc/" + p.Name + "/login",
+		})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// OIDCLogin godoc
+// @Summary     第三方登录
+// @Description 跳转到身份提供方登录（授权码 + PKCE），完成后回到 next 指定的站内页面
+// @Tags        Auth
+// @Param       provider  path   string  true   "身份提供方"
+// @Param       next      query  string  false  "登录后跳转的站内路径"
+// @Success     302
+// @Failure     404  {object}  map[string]string
+// @Router      /auth/oidc/{provider}/login [get]
+func OIDCLogin(c *gin.Context) {
+	p, ok := config.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+	startOIDCAuth(c, p, 0)
+}
+
+// OIDCCallback godoc
+// @Summary     第三方登录回调
+// @Description 校验 state（须与发起登录的浏览器一致）与 ID Token，按绑定关系登录；未绑定时按配置自动创建普通用户，签发与密码登录相同的令牌 cookie
+// @Tags        Auth
+// @Param       provider  path   string  true  "身份提供方"
+// @Param       code      query  string  true  "授权码"
+// @Param       state     query  string  true  "state"
+// @Success     302
+// @Router      /auth/oidc/{provider}/callback [get]
+func OIDCCallback(c *gin.Context) {
+	p, ok := config.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		oidcFail(c, "unknown identity provider")
+		return
+	}
+	if !oidcStateBound(c, c.Query("state")) {
+		oidcFail(c, "login request expired, please try again")
+		return
+	}
+	st, ok := takeOIDCState(c.Query("state"))
+	if !ok || st.Provider != p.Name {
+		oidcFail(c, "login request expired, please try again")
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		oidcFail(c, "identity provider returned: "+e)
+		return
+	}
+	claims, err := p.Exchange(c.Request.Context(), c.Query("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		log.L().Warn("oidc exchange failed", zap.String("provider", p.Name), zap.Error(err))
+		oidcFail(c, "identity verification failed")
+		return
+	}
+
+	var ident models.UserIdentity
+	err = global.DB.Where("provider = ? AND subject = ?", p.Name, claims.Subject).First(&ident).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		oidcFail(c, "query identity failed")
+		return
+	}
+
+	// 绑定流程：已登录用户把第三方身份关联到自己的账号
+	if st.LinkUserID != 0 {
+		// 必须在发起绑定的账号的登录状态下完成，不能在另一个浏览器或切换账号后完成
+		if oidcSessionUserID(c) != st.LinkUserID {
+			oidcFail(c, "please sign in to the account that started linking and try again")
+			return
+		}
+		if found && ident.UserID != st.LinkUserID {
+			oidcFail(c, "this identity is already linked to another account")
+			return
+		}
+		if !found {
+			ident = models.UserIdentity{UserID: st.LinkUserID, Provider: p.Name, Subject: claims.Subject, Email: truncate(claims.Email, 255)}
+			if err := global.DB.Create(&ident).Error; err != nil {
+				oidcFail(c, "link identity failed")
+				return
+			}
+			c.Set("user_id", st.LinkUserID)
+			writeAudit(c, models.AuditIdentityLink, st.LinkUserID, "provider="+p.Name)
+		}
+		next := st.Next
+		if next == "" {
+			next = "/page/shell"
+		}
+		c.Redirect(http.StatusFound, next)
+		return
+	}
+
+	var user *models.Users
+	if found {
+		var u models.Users
+		if err := global.DB.Unscoped().First(&u, ident.UserID).Error; err != nil ||
+			(u.DeletedAt.Valid && !u.PendingDeletion(time.Now())) {
+			oidcFail(c, "account not found")
+			return
+		}
+		user = &u
+	} else {
+		// 自动注册同样遵循注册方式：邀请码注册无法在第三方登录中提交邀请码，与关闭注册一样不允许
+		mode := config.RegistrationMode()
+		if !p.AllowSignup || mode == config.RegistrationClosed || mode == config.RegistrationInvite {
+			oidcFail(c, "no account is linked to this identity, please login with password and link it first")
+			return
+		}
+		status := models.StatusActive
+		if mode == config.RegistrationApproval {
+			status = models.StatusPending
+		}
+		if user, err = createOIDCUser(p, claims, status); err != nil {
+			log.L().Error("create oidc user failed", zap.String("provider", p.Name), zap.Error(err))
+			oidcFail(c, "create account failed")
+			return
+		}
+		log.L().Info("user created via oidc", zap.String("provider", p.Name), zap.Uint("user_id", user.ID))
+		writeAudit(c, models.AuditUserRegister, user.ID, "mode="+mode+" provider="+p.Name)
+	}
+	global.DB.Model(&models.UserIdentity{}).Where("provider = ? AND subject = ?", p.Name, claims.Subject).
+		Updates(map[string]interface{}{"last_login_at": time.Now(), "email": truncate(claims.Email, 255)})
+
+	if user.Status == models.StatusPending {
+		oidcFail(c, "registration submitted, please wait for administrator approval")
+		return
+	}
+	if user.IsBlocked(time.Now()) {
+		oidcFail(c, "account "+user.Status+": "+user.StatusReason)
+		return
+	}
+	// 两步验证仍然需要：交给登录页完成第二步
+	if user.TOTPEnabled || config.RoleRequiresMFA(user.Role) {
+		mfaToken, err := startMFAChallenge(user.ID)
+		if err != nil {
+			oidcFail(c, "start two-factor login failed")
+			return
+		}
+		mode := "verify"
+		if !user.TOTPEnabled {
+			mode = "enroll"
+		}
+		c.Redirect(http.StatusFound, "/auth/login?mfa="+mode+"&mfa_token="+url.QueryEscape(mfaToken)+"&next="+url.QueryEscape(st.Next))
+		return
+	}
+	resp, err := completeLogin(c, user)
+	if err != nil {
+		oidcFail(c, err.Error())
+		return
+	}
+	next := st.Next
+	if next == "" {
+		next, _ = resp["result_url"].(string)
+	}
+	c.Redirect(http.StatusFound, next)
+}
+
+// LinkMyIdentity godoc
+// @Summary      绑定第三方身份
+// @Description  跳转到身份提供方登录，完成后该身份与当前账号绑定，之后可直接用其登录
+// @Tags         User
+// @Security     BearerAuth
+// @Param        provider  path   string  true   "身份提供方"
+// @Param        next      query  string  false  "完成后跳转的站内路径"
+// @Success      302
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /me/identities/{provider}/link [get]
+func LinkMyIdentity(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	p, ok := config.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+	startOIDCAuth(c, p, userID)
+}
+
+// ListMyIdentities godoc
+// @Summary      已绑定的第三方身份
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   identityItem
+// @Failure      401  {object}  ErrorResponse
+// @Router       /me/identities [get]
+func ListMyIdentities(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var rows []models.UserIdentity
+	if err := global.DB.Where("user_id = ?", userID).Order("id").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]identityItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, identityItem{ID: r.ID, Provider: r.Provider, Email: r.Email, LinkedAt: r.CreatedAt, LastLoginAt: r.LastLoginAt})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// UnlinkMyIdentity godoc
+// @Summary      解绑第三方身份
+// @Description  解绑最后一个身份时需要提交密码，确认解绑后仍能用密码登录
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                                true   "身份ID"
+// @Param        body  body      controllers.unlinkIdentityDTO      false  "密码"
+// @Success      200   {object}  map[string]bool
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Router       /me/identities/{id} [delete]
+func UnlinkMyIdentity(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var ident models.UserIdentity
+	if err := global.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&ident).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+	var cnt int64
+	global.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&cnt)
+	if cnt <= 1 {
+		var in unlinkIdentityDTO
+		_ = c.ShouldBindJSON(&in)
+		if in.Password == "" || !CheckPassword(user.Password, in.Password) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "this is your last linked identity, confirm your password to make sure you can still login"})
+			return
+		}
+	}
+	if err := global.DB.Unscoped().Delete(&ident).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unlink identity failed"})
+		return
+	}
+	writeAudit(c, models.AuditIdentityUnlink, user.ID, "provider="+ident.Provider)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
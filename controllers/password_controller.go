@@ -0,0 +1,236 @@
+package controllers
+
+// 修改密码与管理员发起的密码重置
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"project/config"
+	"project/global"
+	"project/models"
+	"project/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const passwordResetTokenBytes = 32
+
+// changePasswordDTO 修改密码，新密码规则与注册一致（config.ValidatePassword）
+type changePasswordDTO struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// redeemPasswordResetDTO 使用重置令牌设置新密码
+type redeemPasswordResetDTO struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// passwordResetResponse 重置令牌只在签发时返回一次，由管理员通过其他渠道交给用户
+type passwordResetResponse struct {
+	Token     string    `json:"token"`
+	ResetURL  string    `json:"reset_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// 更新密码哈希并作废未使用的重置令牌
+func updatePassword(tx *gorm.DB, userID uint, password string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Users{}).Where("id = ?", userID).Update("password", hash).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+// ChangeMyPassword godoc
+// @Summary      修改密码
+// @Description  验证旧密码后设置新密码；其他设备上的会话全部失效，当前设备获得新的令牌。个人访问令牌不受影响，需要时在令牌列表中撤销
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.changePasswordDTO  true  "旧密码和新密码"
+// @Success      200   {object}  tokenPairResponse
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /me/password [put]
+func ChangeMyPassword(c *gin.Context) {
+	var in changePasswordDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !CheckPassword(user.Password, in.OldPassword) {
+		recordLoginFailure(user.Username) // 与登录共用失败计数，防止借已登录会话暴力猜测密码
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "old password is incorrect"})
+		return
+	}
+	if in.OldPassword == in.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must be different from the old one"})
+		return
+	}
+	if err := config.ValidatePassword(user.Username, in.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "weak_password"})
+		return
+	}
+	if err := global.DB.Transaction(func(tx *gorm.DB) error {
+		return updatePassword(tx, user.ID, in.NewPassword)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update password failed"})
+		return
+	}
+	// 所有会话失效（包括当前会话），随后为当前设备重新签发令牌
+	if err := revokeAllUserSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+	writeAudit(c, models.AuditPasswordChange, user.ID, "")
+	if err := global.DB.First(user, user.ID).Error; err != nil { // 重新读取新的令牌版本
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	pair, err := issueTokenPair(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// IssuePasswordReset
+// @Summary 签发密码重置令牌
+// @Description 管理员为用户签发一次性密码重置令牌（24小时内有效），用户使用后自行设置新密码；之前未使用的令牌作废
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security Bearer
+// @Success 200 {object} passwordResetResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/password_reset [post]
+func IssuePasswordReset(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	raw, err := utils.NewOpaqueToken(passwordResetTokenBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
+		return
+	}
+	row := models.PasswordResetToken{
+		UserID:      target.ID,
+		TokenHash:   utils.HashToken(raw),
+		CreatedByID: userID,
+		ExpiresAt:   time.Now().Add(config.PasswordResetTTL),
+	}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", target.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create password reset token failed"})
+		return
+	}
+	writeAudit(c, models.AuditPasswordResetIssue, target.ID, "expires_at="+row.ExpiresAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, &passwordResetResponse{
+		Token:     raw,
+		ResetURL:  "/auth/password/reset?token=" + url.QueryEscape(raw),
+		ExpiresAt: row.ExpiresAt,
+	})
+}
+
+// RedeemPasswordReset godoc
+// @Summary     使用重置令牌设置新密码
+// @Description 令牌只能使用一次；成功后该用户所有会话失效、个人访问令牌全部撤销，需要使用新密码重新登录
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      controllers.redeemPasswordResetDTO  true  "重置令牌和新密码"
+// @Success     200   {object}  map[string]bool
+// @Failure     400   {object}  map[string]string
+// @Failure     500   {object}  map[string]string
+// @Router      /auth/password/reset [post]
+func RedeemPasswordReset(c *gin.Context) {
+	var in redeemPasswordResetDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var row models.PasswordResetToken
+	if err := global.DB.Where("token_hash = ?", utils.HashToken(strings.TrimSpace(in.Token))).First(&row).Error; err != nil ||
+		row.UsedAt != nil || time.Now().After(row.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+	var user models.Users
+	if err := global.DB.Select("id", "username").First(&user, row.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+	if err := config.ValidatePassword(user.Username, in.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "weak_password"})
+		return
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证令牌只能被使用一次
+		res := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", row.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return updatePassword(tx, row.UserID, in.NewPassword)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset password failed"})
+		return
+	}
+	if err := revokeAllUserSessions(row.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+	if err := revokeAllUserPATs(row.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke access tokens failed"})
+		return
+	}
+	clearLoginFailures(user.Username)
+	global.RedisDB.Del(fmt.Sprintf(config.RedisLoginLock, user.Username)) // 重置密码后解除临时锁定
+	writeAudit(c, models.AuditPasswordResetRedeem, row.UserID, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
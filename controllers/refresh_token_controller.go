@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const refreshTokenBytes = 32
+
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// refreshDTO 非浏览器客户端可以直接在请求体里提交刷新令牌
+type refreshDTO struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenPairResponse 访问令牌 + 刷新令牌
+type tokenPairResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in" example:"900"` // 访问令牌剩余秒数
+}
+
+// 登录成功后签发一对令牌：familyID 为空时开启新的令牌家族
+func issueTokenPair(c *gin.Context, user *models.Users, familyID string) (*tokenPairResponse, error) {
+	refresh, row, err := createRefreshToken(global.DB, c, user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := utils.GenerateJWT(user.Username, user.Role, row.FamilyID, user.TokenVersion) //会话ID即刷新令牌家族
+	if err != nil {
+		return nil, err
+	}
+	if familyID == "" { // 新会话换一个 CSRF 令牌，避免沿用登录前可能被植入的令牌
+		utils.RotateCSRFToken(c)
+	}
+	setTokenCookies(c, access, refresh)
+	return &tokenPairResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// 访问令牌的 cookie 与刷新令牌同寿命：其中的 JWT 过期后中间件能区分“需要续期”与“未登录”
+func setTokenCookies(c *gin.Context, access, refresh string) {
+	utils.SetAuthCookie(c, access, utils.RefreshTokenTTL)
+	utils.SetRefreshCookie(c, refresh, utils.RefreshTokenTTL)
+	utils.EnsureCSRFToken(c)
+}
+
+func createRefreshToken(db *gorm.DB, c *gin.Context, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	raw, err := utils.NewOpaqueToken(refreshTokenBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	if familyID == "" {
+		if familyID, err = utils.NewOpaqueToken(16); err != nil {
+			return "", nil, err
+		}
+	}
+	row := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: utils.HashToken(raw),
+		FamilyID:  familyID,
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if err := db.Create(row).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, row, nil
+}
+
+// 从 cookie 或请求体中读取刷新令牌
+func readRefreshToken(c *gin.Context) string {
+	if ck, err := c.Cookie(utils.RefreshCookieName); err == nil && ck != "" {
+		return ck
+	}
+	var in refreshDTO
+	if err := c.ShouldBindJSON(&in); err == nil {
+		return strings.TrimSpace(in.RefreshToken)
+	}
+	return ""
+}
+
+// 整个家族作废：检测到已轮换的令牌被再次使用时，说明令牌可能已被窃取
+func revokeRefreshFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// 宽限期内重复使用刚轮换的旧令牌（其他标签页同时刷新）时返回已轮换出的新令牌；新令牌必须仍然有效
+func refreshGraceSuccessor(raw string, oldID uint) (string, bool) {
+	var old models.RefreshToken // 重新读取：请求开始时读到的记录可能还未被另一方轮换
+	if err := global.DB.First(&old, oldID).Error; err != nil ||
+		old.RevokedAt == nil || time.Since(*old.RevokedAt) > config.RefreshReuseGrace {
+		return "", false
+	}
+	next, err := global.RedisDB.Get(fmt.Sprintf(config.RedisRefreshGrace, utils.HashToken(raw))).Result()
+	if err != nil || next == "" {
+		return "", false
+	}
+	var row models.RefreshToken
+	if err := global.DB.Where("token_hash = ? AND family_id = ? AND revoked_at IS NULL", utils.HashToken(next), old.FamilyID).
+		First(&row).Error; err != nil || time.Now().After(row.ExpiresAt) {
+		return "", false
+	}
+	return next, true
+}
+
+// RefreshToken godoc
+// @Summary     刷新访问令牌
+// @Description 使用刷新令牌（cookie Refresh 或请求体 refresh_token）换取新的访问令牌；刷新令牌每次使用后都会轮换，重复使用旧令牌会使整个会话失效（轮换后 20 秒内的重复使用视为多个标签页同时刷新，返回同一个新令牌）。
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      controllers.refreshDTO  false  "刷新令牌（浏览器使用 cookie 时可省略）"
+// @Success     200   {object}  tokenPairResponse
+// @Failure     401   {object}  map[string]string
+// @Router      /auth/refresh [post]
+func RefreshToken(c *gin.Context) {
+	raw := readRefreshToken(c)
+	if raw == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token required"})
+		return
+	}
+
+	var old models.RefreshToken
+	if err := global.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&old).Error; err != nil {
+		utils.ClearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	if time.Now().After(old.ExpiresAt) {
+		utils.ClearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired, please login again"})
+		return
+	}
+
+	var user models.Users
+	if err := global.DB.First(&user, old.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+	if user.IsBlocked(time.Now()) { // 暂停或封禁期间不能续期
+		c.JSON(http.StatusForbidden, blockedUserResponse(&user))
+		return
+	}
+
+	var newRaw string
+	oldRaw := raw
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证同一个刷新令牌只能被成功轮换一次
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		raw, row, err := createRefreshToken(tx, c, user.ID, old.FamilyID)
+		if err != nil {
+			return err
+		}
+		newRaw = raw
+		// 提交前写入，同时刷新的另一方在等待行锁结束后一定能读到；事务失败时新令牌不存在，宽限检查会拒绝
+		global.RedisDB.Set(fmt.Sprintf(config.RedisRefreshGrace, utils.HashToken(oldRaw)), raw, config.RefreshReuseGrace)
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", old.ID).Update("replaced_by_id", row.ID).Error
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		if next, ok := refreshGraceSuccessor(oldRaw, old.ID); ok {
+			newRaw, err = next, nil
+		}
+	}
+	if errors.Is(err, errRefreshTokenReused) {
+		revokeSession(old.FamilyID) // 整个会话作废，已签发的访问令牌一并失效
+		log.L().Warn("refresh token reuse detected",
+			zap.Uint("user_id", old.UserID),
+			zap.String("family_id", old.FamilyID),
+			zap.String("ip", c.ClientIP()),
+		)
+		utils.ClearAuthCookie(c)
+		utils.ClearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reused, session revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh token failed"})
+		return
+	}
+
+	access, err := utils.GenerateJWT(user.Username, user.Role, old.FamilyID, user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate token failed"})
+		return
+	}
+	setTokenCookies(c, access, newRaw)
+	c.JSON(http.StatusOK, &tokenPairResponse{
+		Token:        access,
+		RefreshToken: newRaw,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+func truncate(s string, n int) string {
+	return utils.TruncateUTF8(s, n)
+}
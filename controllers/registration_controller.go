@@ -0,0 +1,246 @@
+package controllers
+
+// 注册方式、注册邀请码与注册审核
+import (
+	"errors"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	inviteCodeBytes     = 12
+	inviteCodeListLimit = 200
+)
+
+var errInviteCodeInvalid = errors.New("invalid or expired invite code")
+
+// registrationInfoResponse 注册页根据注册方式显示邀请码输入框与密码规则
+type registrationInfoResponse struct {
+	Mode           string                `json:"mode"`
+	InviteRequired bool                  `json:"invite_required"`
+	PasswordPolicy config.PasswordPolicy `json:"password_policy"`
+}
+
+// createInviteDTO 生成邀请码；MaxUses 默认 1 次，为 0 表示不限次数；ExpiresInHours 为 0 表示永不过期
+type createInviteDTO struct {
+	MaxUses        *int   `json:"max_uses" binding:"omitempty,min=0,max=1000"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"min=0,max=8760"`
+	Note           string `json:"note" binding:"max=255"`
+}
+
+// inviteCodeItem 邀请码列表项，不包含邀请码本身
+type inviteCodeItem struct {
+	ID          uint       `json:"id"`
+	Prefix      string     `json:"prefix"`
+	Note        string     `json:"note"`
+	CreatedByID uint       `json:"created_by_id"`
+	MaxUses     int        `json:"max_uses"`
+	UsedCount   int        `json:"used_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	Usable      bool       `json:"usable"`
+}
+
+// createInviteResponse 邀请码明文只在生成时返回一次
+type createInviteResponse struct {
+	inviteCodeItem
+	Code string `json:"code"`
+}
+
+func toInviteCodeItem(i *models.InviteCode) inviteCodeItem {
+	return inviteCodeItem{
+		ID:          i.ID,
+		Prefix:      i.Prefix,
+		Note:        i.Note,
+		CreatedByID: i.CreatedByID,
+		MaxUses:     i.MaxUses,
+		UsedCount:   i.UsedCount,
+		CreatedAt:   i.CreatedAt,
+		ExpiresAt:   i.ExpiresAt,
+		RevokedAt:   i.RevokedAt,
+		Usable:      i.Usable(time.Now()),
+	}
+}
+
+// 在注册事务中使用一次邀请码；条件更新保证并发注册不会超出可用次数
+func redeemInviteCode(tx *gorm.DB, raw string) (*models.InviteCode, error) {
+	var inv models.InviteCode
+	if err := tx.Where("code_hash = ?", utils.HashToken(raw)).First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInviteCodeInvalid
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !inv.Usable(now) {
+		return nil, errInviteCodeInvalid
+	}
+	res := tx.Model(&models.InviteCode{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR used_count < max_uses)", inv.ID, now).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errInviteCodeInvalid
+	}
+	inv.UsedCount++
+	return &inv, nil
+}
+
+// RegistrationInfo godoc
+// @Summary     注册方式与密码规则
+// @Tags        Auth
+// @Produce     json
+// @Success     200  {object}  registrationInfoResponse
+// @Router      /auth/registration [get]
+func RegistrationInfo(c *gin.Context) {
+	mode := config.RegistrationMode()
+	c.JSON(http.StatusOK, &registrationInfoResponse{
+		Mode:           mode,
+		InviteRequired: mode == config.RegistrationInvite,
+		PasswordPolicy: config.CurrentPasswordPolicy(),
+	})
+}
+
+// ListInviteCodes
+// @Summary 邀请码列表
+// @Description 默认只返回未作废的邀请码，all=true 时包含已作废的
+// @Tags UserManagement
+// @Produce json
+// @Param all query bool false "是否包含已作废的邀请码"
+// @Security Bearer
+// @Success 200 {array} inviteCodeItem
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/invites [get]
+func ListInviteCodes(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	db := global.DB.Model(&models.InviteCode{})
+	if all, _ := strconv.ParseBool(c.Query("all")); !all {
+		db = db.Where("revoked_at IS NULL")
+	}
+	var rows []models.InviteCode
+	if err := db.Order("created_at DESC").Limit(inviteCodeListLimit).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]inviteCodeItem, 0, len(rows))
+	for i := range rows {
+		items = append(items, toInviteCodeItem(&rows[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"invites": items, "mode": config.RegistrationMode()})
+}
+
+// CreateInviteCode
+// @Summary 生成邀请码
+// @Description 邀请码以 inv_ 开头，只在生成时返回一次；邀请码注册方式下必须使用，审核注册方式下使用可免审核
+// @Tags UserManagement
+// @Accept json
+// @Produce json
+// @Param data body createInviteDTO true "可用次数、有效时长、备注"
+// @Security Bearer
+// @Success 201 {object} createInviteResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/invites [post]
+func CreateInviteCode(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	var in createInviteDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := utils.NewOpaqueToken(inviteCodeBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate invite code failed"})
+		return
+	}
+	raw := models.InviteCodePrefix + secret
+	row := models.InviteCode{
+		CodeHash:    utils.HashToken(raw),
+		Prefix:      raw[:len(models.InviteCodePrefix)+4],
+		Note:        strings.TrimSpace(in.Note),
+		CreatedByID: userID,
+		MaxUses:     1,
+	}
+	if in.MaxUses != nil {
+		row.MaxUses = *in.MaxUses
+	}
+	if in.ExpiresInHours > 0 {
+		exp := time.Now().Add(time.Duration(in.ExpiresInHours) * time.Hour)
+		row.ExpiresAt = &exp
+	}
+	if err := global.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create invite code failed"})
+		return
+	}
+	recordAudit(c, auditEntry{
+		Action:     models.AuditInviteCreate,
+		TargetType: models.AuditTargetInvite,
+		TargetID:   row.ID,
+		After:      gin.H{"prefix": row.Prefix, "max_uses": row.MaxUses, "expires_at": row.ExpiresAt, "note": row.Note},
+	})
+	c.JSON(http.StatusCreated, &createInviteResponse{inviteCodeItem: toInviteCodeItem(&row), Code: raw})
+}
+
+// RevokeInviteCode
+// @Summary 作废邀请码
+// @Description 作废后不能再用于注册，已注册的用户不受影响
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "邀请码ID"
+// @Security Bearer
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/invites/{id} [delete]
+func RevokeInviteCode(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res := global.DB.Model(&models.InviteCode{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke invite code failed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite code not found"})
+		return
+	}
+	recordAudit(c, auditEntry{Action: models.AuditInviteRevoke, TargetType: models.AuditTargetInvite, TargetID: uint(id)})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
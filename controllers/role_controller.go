@@ -0,0 +1,340 @@
+package controllers
+
+// 角色与权限管理：角色保存在数据库中，管理员可以新建角色、调整权限
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,15}$`)
+
+// roleItem 角色及其权限
+type roleItem struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+	Users       int64    `json:"users"` // 使用该角色的用户数
+}
+
+// createRoleDTO 新建角色
+type createRoleDTO struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// updateRoleDTO 修改角色；Permissions 为完整的权限列表
+type updateRoleDTO struct {
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// canManageRole 只能管理（分配、修改）权限是自己权限子集的角色，防止借角色管理提权
+// 操作其他用户的资源（下载他人文件、删除他人文章）：需要相应权限，管理类角色须已绑定两步验证（与 RequirePermission 一致），
+// 且不接受个人访问令牌，脚本只能访问令牌所属用户自己的资源
+func canActOnOthers(c *gin.Context, perm string) bool {
+	if _, viaPAT := c.Get("pat_id"); viaPAT {
+		return false
+	}
+	role := c.GetString("role")
+	if !config.HasPermission(role, perm) {
+		return false
+	}
+	return !config.RoleRequiresMFA(role) || c.GetBool("mfa_enabled")
+}
+
+// 记录读取其他用户文件的审计日志
+func auditFileReadAny(c *gin.Context, f *models.Files, detail string) {
+	recordAudit(c, auditEntry{Action: models.AuditFileReadAny, TargetType: models.AuditTargetFile, TargetID: f.ID,
+		Detail: fmt.Sprintf("owner=%d %s", f.UserID, detail)})
+}
+
+func canManageRole(actorRole, targetRole string) bool {
+	if actorRole == models.RoleSuperAdmin {
+		return true
+	}
+	mine := config.RolePermissions(actorRole)
+	for p := range config.RolePermissions(targetRole) {
+		if !mine[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// assignableRole 可以分配给用户的角色：已存在、不是超级管理员、且不超出操作者自己的权限
+func assignableRole(actorRole, role string) bool {
+	return role != models.RoleSuperAdmin && config.RoleExists(role) && canManageRole(actorRole, role)
+}
+
+// 角色当前的权限（排序后），用于审计日志
+func sortedRolePermissions(role string) []string {
+	perms := make([]string, 0)
+	for p := range config.RolePermissions(role) {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// 校验权限列表：必须存在且操作者自己拥有
+func checkGrantablePermissions(c *gin.Context, perms []string) ([]string, bool) {
+	actor := c.GetString("role")
+	mine := config.RolePermissions(actor)
+	seen := map[string]bool{}
+	out := make([]string, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if !models.ValidPermission(p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission: " + p})
+			return nil, false
+		}
+		if actor != models.RoleSuperAdmin && !mine[p] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot grant a permission you do not have: " + p})
+			return nil, false
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out, true
+}
+
+// 覆盖角色的权限列表
+func replaceRolePermissions(tx *gorm.DB, roleID uint, perms []string) error {
+	if err := tx.Where("role_id = ?", roleID).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if err := tx.Create(&models.RolePermission{RoleID: roleID, Permission: p}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPermissions
+// @Summary 权限列表
+// @Description 返回系统中全部权限及说明
+// @Tags RoleManagement
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} models.PermissionInfo
+// @Failure 403 {object} map[string]string
+// @Router /dashboard/permissions [get]
+func ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Permissions)
+}
+
+// ListRoles
+// @Summary 角色列表
+// @Description 返回全部角色、其权限以及使用该角色的用户数
+// @Tags RoleManagement
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} roleItem
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/roles [get]
+func ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := global.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	type roleCount struct {
+		Role string
+		N    int64
+	}
+	var counts []roleCount
+	global.DB.Model(&models.Users{}).Select("role, COUNT(*) AS n").Group("role").Scan(&counts)
+	byRole := make(map[string]int64, len(counts))
+	for _, rc := range counts {
+		byRole[rc.Role] = rc.N
+	}
+	items := make([]roleItem, 0, len(roles))
+	for _, r := range roles {
+		perms := make([]string, 0, len(r.Permissions))
+		for _, p := range r.Permissions {
+			perms = append(perms, p.Permission)
+		}
+		sort.Strings(perms)
+		items = append(items, roleItem{Name: r.Name, Description: r.Description, Builtin: r.Builtin, Permissions: perms, Users: byRole[r.Name]})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// CreateRole
+// @Summary 新建角色
+// @Description 角色名为2-16位小写字母、数字或下划线；只能授予自己拥有的权限
+// @Tags RoleManagement
+// @Accept json
+// @Produce json
+// @Param data body createRoleDTO true "角色信息"
+// @Security Bearer
+// @Success 201 {object} roleItem
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/roles [post]
+func CreateRole(c *gin.Context) {
+	var in createRoleDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in.Name = strings.ToLower(strings.TrimSpace(in.Name))
+	if !roleNamePattern.MatchString(in.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色名只能包含小写字母、数字和下划线，以字母开头，2-16位"})
+		return
+	}
+	perms, ok := checkGrantablePermissions(c, in.Permissions)
+	if !ok {
+		return
+	}
+	role := models.Role{Name: in.Name, Description: in.Description}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var cnt int64
+		tx.Model(&models.Role{}).Where("name = ?", in.Name).Count(&cnt)
+		if cnt > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return replaceRolePermissions(tx, role.ID, perms)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "角色已存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create role failed"})
+		return
+	}
+	config.InvalidateRolePermissions()
+	item := &roleItem{Name: role.Name, Description: role.Description, Permissions: perms}
+	recordAudit(c, auditEntry{Action: models.AuditRoleCreate, TargetType: models.AuditTargetRole, TargetID: role.ID, After: item})
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateRole
+// @Summary 修改角色
+// @Description 修改角色说明并整体替换其权限；超级管理员角色始终拥有全部权限，不能修改；只能修改权限是自己权限子集的角色
+// @Tags RoleManagement
+// @Accept json
+// @Produce json
+// @Param name path string true "角色名"
+// @Param data body updateRoleDTO true "角色信息"
+// @Security Bearer
+// @Success 200 {object} roleItem
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/roles/{name} [put]
+func UpdateRole(c *gin.Context) {
+	var in updateRoleDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var role models.Role
+	if err := global.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return
+	}
+	if role.Name == models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "超级管理员角色不能修改"})
+		return
+	}
+	if !canManageRole(c.GetString("role"), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改拥有自己所没有的权限的角色"})
+		return
+	}
+	perms, ok := checkGrantablePermissions(c, in.Permissions)
+	if !ok {
+		return
+	}
+	before := &roleItem{Name: role.Name, Description: role.Description, Builtin: role.Builtin, Permissions: sortedRolePermissions(role.Name)}
+	if in.Description != nil {
+		role.Description = *in.Description
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		return replaceRolePermissions(tx, role.ID, perms)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update role failed"})
+		return
+	}
+	config.InvalidateRolePermissions()
+	item := &roleItem{Name: role.Name, Description: role.Description, Builtin: role.Builtin, Permissions: perms}
+	recordAudit(c, auditEntry{Action: models.AuditRoleUpdate, TargetType: models.AuditTargetRole, TargetID: role.ID, Before: before, After: item})
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteRole
+// @Summary 删除角色
+// @Description 内置角色和仍有用户使用的角色不能删除
+// @Tags RoleManagement
+// @Produce json
+// @Param name path string true "角色名"
+// @Security Bearer
+// @Success 200 {object} map[string]bool
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/roles/{name} [delete]
+func DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := global.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return
+	}
+	if role.Builtin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "内置角色不能删除"})
+		return
+	}
+	if !canManageRole(c.GetString("role"), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能删除拥有自己所没有的权限的角色"})
+		return
+	}
+	var cnt int64
+	global.DB.Unscoped().Model(&models.Users{}).Where("role = ?", role.Name).Count(&cnt)
+	if cnt > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "仍有用户使用该角色，请先修改这些用户的角色", "users": cnt})
+		return
+	}
+	before := &roleItem{Name: role.Name, Description: role.Description, Permissions: sortedRolePermissions(role.Name)}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete role failed"})
+		return
+	}
+	config.InvalidateRolePermissions()
+	recordAudit(c, auditEntry{Action: models.AuditRoleDelete, TargetType: models.AuditTargetRole, TargetID: role.ID, Before: before})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/log"
+	"project/models"
+	"project/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// sessionItem 一个会话对应一次登录（同一个刷新令牌家族）
+type sessionItem struct {
+	ID         string    `json:"id"` // 会话ID，即刷新令牌家族ID
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"` // 首次登录时间
+	LastUsedAt time.Time `json:"last_used_at"` // 最近一次刷新时间
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // 是否为发起请求的会话
+}
+
+// revokeSession 作废会话的刷新令牌，并让该会话已签发的访问令牌立即失效
+func revokeSession(sid string) {
+	if sid == "" {
+		return
+	}
+	if err := revokeRefreshFamily(global.DB, sid); err != nil {
+		log.L().Error("revoke refresh token family failed", zap.String("sid", sid), zap.Error(err))
+	}
+	config.RevokeSession(sid)
+}
+
+// revokeAllUserSessions 递增令牌版本并作废全部刷新令牌，该用户所有设备都需要重新登录
+func revokeAllUserSessions(userID uint) error {
+	var u models.Users
+	if err := global.DB.Unscoped().Select("id", "username").First(&u, userID).Error; err != nil {
+		return err
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Users{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + ?", 1)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+	config.ClearUserCache(u.Username) // 缓存里的旧版本号必须清掉
+	return nil
+}
+
+// ListMySessions godoc
+// @Summary      列出我的登录会话
+// @Description  返回当前用户所有未过期、未注销的登录会话（设备、IP、登录时间）
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   sessionItem
+// @Failure      401  {object}  ErrorResponse
+// @Router       /me/sessions [get]
+func ListMySessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var active []models.RefreshToken // 每个会话只有一个未轮换的刷新令牌
+	if err := global.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	families := make([]string, 0, len(active))
+	for _, t := range active {
+		families = append(families, t.FamilyID)
+	}
+	// 家族中最早的令牌即登录时间
+	type firstSeen struct {
+		FamilyID string
+		First    time.Time
+	}
+	var firsts []firstSeen
+	if len(families) > 0 {
+		global.DB.Model(&models.RefreshToken{}).
+			Select("family_id, MIN(created_at) AS first").
+			Where("family_id IN ?", families).
+			Group("family_id").Scan(&firsts)
+	}
+	signedIn := make(map[string]time.Time, len(firsts))
+	for _, f := range firsts {
+		signedIn[f.FamilyID] = f.First
+	}
+
+	current := c.GetString("sid")
+	items := make([]sessionItem, 0, len(active))
+	for _, t := range active {
+		first, ok := signedIn[t.FamilyID]
+		if !ok {
+			first = t.CreatedAt
+		}
+		items = append(items, sessionItem{
+			ID:         t.FamilyID,
+			UserAgent:  t.UserAgent,
+			IP:         t.IP,
+			SignedInAt: first,
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			Current:    t.FamilyID == current,
+		})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// RevokeMySession godoc
+// @Summary      注销指定会话
+// @Description  注销当前用户的某个登录会话，该设备上的令牌立即失效
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path  string  true  "会话ID"
+// @Success      200  {object}  map[string]bool
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /me/sessions/{id} [delete]
+func RevokeMySession(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	sid := c.Param("id")
+	var cnt int64
+	if err := global.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND user_id = ?", sid, userID).
+		Count(&cnt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if cnt == 0 { // 只能注销自己的会话
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	revokeSession(sid)
+	if sid == c.GetString("sid") {
+		utils.ClearAuthCookie(c)
+		utils.ClearRefreshCookie(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RevokeAllMySessions godoc
+// @Summary      退出所有设备
+// @Description  注销当前用户的全部会话（包括当前会话），所有设备都需要重新登录；个人访问令牌不受影响
+// @Tags         User
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]bool
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /me/sessions/revoke_all [post]
+func RevokeAllMySessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if err := revokeAllUserSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+	utils.ClearAuthCookie(c)
+	utils.ClearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ForceLogoutUser
+// @Summary 强制用户下线
+// @Description 管理员注销指定用户的全部会话并撤销其全部个人访问令牌（仅管理员可访问）
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security Bearer
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/logout [post]
+func ForceLogoutUser(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	target, ok := loadManagedUser(c) // 不能强制自己、超级管理员或权限更高的用户下线
+	if !ok {
+		return
+	}
+	if err := revokeAllUserSessions(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+	if err := revokeAllUserPATs(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke access tokens failed"})
+		return
+	}
+	writeAudit(c, models.AuditUserForceLogout, target.ID, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
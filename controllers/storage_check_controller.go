@@ -0,0 +1,143 @@
+package controllers
+
+// 存储一致性检查：管理后台手动执行与查看报告，检查逻辑见 config/consistency.go
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type runStorageCheckDTO struct {
+	DryRun     *bool `json:"dry_run"`     // 省略时为 true，只生成报告
+	VerifyHash bool  `json:"verify_hash"` // 读取全部内容重新计算 SHA-256
+}
+
+// storageCheckDetail 检查记录及问题明细
+type storageCheckDetail struct {
+	models.StorageCheck
+	Issues []config.StorageIssue `json:"issues"`
+}
+
+// RunStorageCheck
+// @Summary 执行存储一致性检查
+// @Description 在后台对账 files/blobs 表与上传目录、存储后端，通过 GET /dashboard/storage/checks/{id} 查看进度与报告。dry_run 为 false 时修复：孤儿文件与损坏的内容移入上传目录下的 quarantine 目录，残留的 .part 临时文件删除，内容缺失或损坏的文件记录删除
+// @Tags Storage
+// @Accept json
+// @Produce json
+// @Param data body runStorageCheckDTO false "是否试运行、是否校验哈希"
+// @Security Bearer
+// @Success 202 {object} models.StorageCheck
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/storage/checks [post]
+func RunStorageCheck(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermStorageManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	var in runStorageCheckDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	dryRun := in.DryRun == nil || *in.DryRun
+	rec, err := config.StartStorageCheck(config.StorageCheckOptions{
+		DryRun:     dryRun,
+		VerifyHash: in.VerifyHash,
+		Trigger:    models.StorageCheckManual,
+		ActorID:    &userID,
+	})
+	if errors.Is(err, config.ErrStorageCheckRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a storage check is already running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "start storage check failed"})
+		return
+	}
+	recordAudit(c, auditEntry{
+		Action:     models.AuditStorageCheck,
+		TargetType: models.AuditTargetStorage,
+		TargetID:   rec.ID,
+		After:      gin.H{"dry_run": dryRun, "verify_hash": in.VerifyHash},
+	})
+	c.JSON(http.StatusAccepted, rec)
+}
+
+// ListStorageChecks
+// @Summary 存储一致性检查记录
+// @Description 按时间倒序返回最近的检查，不含问题明细
+// @Tags Storage
+// @Produce json
+// @Param limit query int false "条数（最多100）" default(20)
+// @Security Bearer
+// @Success 200 {array} models.StorageCheck
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/storage/checks [get]
+func ListStorageChecks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermStorageManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows := []models.StorageCheck{}
+	if err := global.DB.Omit("issues").Order("id DESC").Limit(limit).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// GetStorageCheck
+// @Summary 存储一致性检查报告
+// @Description 运行中的检查 status 为 running；完成后返回各类问题的数量与明细（最多 1000 条），修复时每条附带处理结果
+// @Tags Storage
+// @Produce json
+// @Param id path int true "检查ID"
+// @Security Bearer
+// @Success 200 {object} storageCheckDetail
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /dashboard/storage/checks/{id} [get]
+func GetStorageCheck(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermStorageManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var rec models.StorageCheck
+	if err := global.DB.First(&rec, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "storage check not found"})
+		return
+	}
+	out := storageCheckDetail{StorageCheck: rec, Issues: []config.StorageIssue{}}
+	if rec.Issues != "" {
+		_ = json.Unmarshal([]byte(rec.Issues), &out.Issues)
+	}
+	c.JSON(http.StatusOK, out)
+}
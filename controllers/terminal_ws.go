@@ -16,6 +16,7 @@ import (
 
 	"project/config"
 	"project/log"
+	"project/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket" //使用websocket
@@ -201,7 +202,7 @@ type terminalInfo struct {
 func GetTerminalInfo(c *gin.Context) {
 	role := c.GetString("role")
 	username := c.GetString("username")
-	if role != "superadmin" {
+	if !config.HasPermission(role, models.PermTerminalExec) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission"})
 		return
 	}
@@ -229,7 +230,7 @@ func GetTerminalInfo(c *gin.Context) {
 func TerminalWS(c *gin.Context) {
 	role := c.GetString("role")
 
-	if role != "superadmin" {
+	if !config.HasPermission(role, models.PermTerminalExec) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission"})
 		return
 	}
@@ -442,6 +443,7 @@ func TerminalWS(c *gin.Context) {
 				})
 				continue
 			}
+			recordAudit(c, auditEntry{Action: models.AuditTerminalExec, After: gin.H{"command": req.Command, "args": req.Args, "line": req.LineChoice}})
 			launchCommand(req) //新开一个线程保证不影响主程序
 		} //select
 	}
@@ -39,9 +39,7 @@ type TranslationResponse struct {
 }
 
 var (
-	// 只需要信号量控制并发
-	translationSemaphore = make(chan struct{}, 100) // 限制最多100个并发请求
-	historyLimitPerUser  = 50
+	historyLimitPerUser = 50
 )
 
 // TranslateText godoc
@@ -58,18 +56,6 @@ var (
 // @Failure     500      {object}  map[string]string    "服务器内部错误"
 // @Router      /translate [post]
 func TranslateText(c *gin.Context) {
-	//并发限制-select 的规则是：只在“就绪”的分支里随机选一个
-	select {
-	case translationSemaphore <- struct{}{}: // 尝试想这个通道发送一个空的结构体
-		defer func() { <-translationSemaphore }()
-	case <-c.Request.Context().Done(): // 检测到前面请求或者响应的客户端断开
-		c.JSON(http.StatusRequestTimeout, gin.H{"error": "client canceled"})
-		return
-	case <-time.After(300 * time.Millisecond): // 等待300ms后仍未获取到名额（通道仍然满）
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "The internet server is busy, try later"})
-		return
-	}
-
 	var req TranslationRequest // 接受前端的请求
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
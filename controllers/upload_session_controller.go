@@ -0,0 +1,544 @@
+package controllers
+
+// 分片上传（可断点续传）：初始化会话 -> 按偏移量依次上传分片 -> 完成时校验 SHA-256 并入库
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"project/config"
+	"project/global"
+	"project/models"
+	"project/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UploadOffsetHeader 分片的起始偏移量，与 tus 协议的同名请求头含义一致
+const UploadOffsetHeader = "Upload-Offset"
+
+// createUploadDTO 初始化分片上传；SHA256 为整个文件的十六进制摘要，提供时完成阶段会校验
+type createUploadDTO struct {
+	Filename string `json:"filename" binding:"required,max=255"`
+	Size     int64  `json:"size" binding:"required,min=1"`
+	SHA256   string `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	Content  string `json:"content" binding:"max=1000"` // 文件描述
+}
+
+// uploadSessionResponse 上传会话状态，断线后据此从 offset 继续上传
+type uploadSessionResponse struct {
+	ID        uint      `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	ChunkSize int64     `json:"chunk_size"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// completeUploadResponse 完成上传后的文件信息
+type completeUploadResponse struct {
+	UploadResponse
+	SHA256 string `json:"sha256"`
+}
+
+func toUploadSessionResponse(s *models.UploadSession) uploadSessionResponse {
+	return uploadSessionResponse{
+		ID:        s.ID,
+		Filename:  s.Filename,
+		Size:      s.FileSize,
+		Offset:    s.Offset,
+		ChunkSize: s.ChunkSize,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+// 分片大小、单个文件上限与用户总配额（字节）
+func uploadLimits() (chunk, maxFile, maxTotal int64) {
+	up := config.AppConfig.Upload
+	chunkMB := up.ChunkSize
+	if chunkMB <= 0 {
+		chunkMB = config.DefaultUploadChunkMB
+	}
+	fileMB := up.ResumableFileSize
+	if fileMB <= 0 {
+		fileMB = up.FileSize
+	}
+	return int64(chunkMB) << 20, int64(fileMB) << 20, int64(up.TotalSize) << 20
+}
+
+// 已占用的配额：已上传的文件加上其他未完成的上传会话声明的大小
+func usedUploadQuota(userID, excludeSession uint) (int64, error) {
+	return usedUploadQuotaTx(global.DB, userID, excludeSession)
+}
+
+func usedUploadQuotaTx(db *gorm.DB, userID, excludeSession uint) (int64, error) {
+	var files, pending int64
+	if err := db.Model(&models.Files{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(file_size), 0)").Scan(&files).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&models.UploadSession{}).Where("user_id = ? AND id <> ? AND expires_at > ?", userID, excludeSession, time.Now()).
+		Select("COALESCE(SUM(file_size), 0)").Scan(&pending).Error; err != nil {
+		return 0, err
+	}
+	return files + pending, nil
+}
+
+// 读取当前用户的上传会话，过期的视为不存在
+func loadUploadSession(c *gin.Context, userID uint) (*models.UploadSession, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload id"})
+		return nil, false
+	}
+	var s models.UploadSession
+	if err := global.DB.Where("id = ? AND user_id = ?", id, userID).First(&s).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return nil, false
+	}
+	if time.Now().After(s.ExpiresAt) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload expired, please start again"})
+		return nil, false
+	}
+	return &s, true
+}
+
+// 同一会话同时只处理一个分片或完成请求，避免并发写同一个临时文件
+func lockUploadSession(c *gin.Context, id uint) (func(), bool) {
+	key := fmt.Sprintf(config.RedisUploadLock, id)
+	ok, err := global.RedisDB.SetNX(key, "1", config.UploadChunkLockTTL).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "lock upload failed"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "another request is writing this upload"})
+		return nil, false
+	}
+	return func() { global.RedisDB.Del(key) }, true
+}
+
+// CreateUpload godoc
+// @Summary      初始化分片上传
+// @Description  校验扩展名、大小与配额（声明的大小在上传期间即计入配额），返回会话ID与分片大小；随后通过 PUT /files/uploads/{id} 按顺序上传分片
+// @Tags         Files
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      controllers.createUploadDTO  true  "文件名、大小、SHA-256（可选）"
+// @Success      201   {object}  uploadSessionResponse
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /files/uploads [post]
+func CreateUpload(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var in createUploadDTO
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	chunk, maxFile, maxTotal := uploadLimits()
+	baseName := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(in.Filename, "\\", "/")))
+	if baseName == "/" || baseName == "." {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filename"})
+		return
+	}
+	if !allowedExts[strings.ToLower(filepath.Ext(baseName))] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file type not allowed"})
+		return
+	}
+	if in.Size > maxFile {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("This file is too large (max %dMB)", maxFile>>20)})
+		return
+	}
+	var active int64
+	global.DB.Model(&models.UploadSession{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&active)
+	if active >= config.UploadMaxSessions {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many unfinished uploads, finish or cancel some first"})
+		return
+	}
+	used, err := usedUploadQuota(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if used+in.Size > maxTotal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "storage limit exceeded"})
+		return
+	}
+
+	baseRel := config.AppConfig.Upload.Storagepath
+	relDir := filepath.Join(fmt.Sprintf("user_%d", userID), time.Now().Format("2006-01-02"))
+	dirPath, err := utils.SafeJoinRel(baseRel, relDir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "The syesytem create dir failed"})
+		return
+	}
+	tok, err := utils.NewOpaqueToken(12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create upload failed"})
+		return
+	}
+	tempKey := filepath.ToSlash(filepath.Join(relDir, ".upload-"+tok+".part"))
+	tempPath, _ := utils.SafeJoinRel(baseRel, tempKey)
+	f, err := os.OpenFile(tempPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create temp file failed"})
+		return
+	}
+	f.Close()
+
+	s := models.UploadSession{
+		UserID:    userID,
+		Filename:  baseName,
+		FileSize:  in.Size,
+		ChunkSize: chunk,
+		SHA256:    strings.ToLower(in.SHA256),
+		TempPath:  tempKey,
+		FileInfo:  in.Content,
+		ExpiresAt: time.Now().Add(config.UploadSessionTTL),
+	}
+	if err := global.DB.Create(&s).Error; err != nil {
+		_ = os.Remove(tempPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create upload failed"})
+		return
+	}
+	c.JSON(http.StatusCreated, toUploadSessionResponse(&s))
+}
+
+// ListUploads godoc
+// @Summary      未完成的分片上传
+// @Description  页面刷新或断线后据此找回可以继续的上传
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   uploadSessionResponse
+// @Failure      401  {object}  ErrorResponse
+// @Router       /files/uploads [get]
+func ListUploads(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var rows []models.UploadSession
+	if err := global.DB.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	items := make([]uploadSessionResponse, 0, len(rows))
+	for i := range rows {
+		items = append(items, toUploadSessionResponse(&rows[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GetUpload godoc
+// @Summary      查询分片上传进度
+// @Description  返回服务端已保存的字节数（同时写入 Upload-Offset 响应头），客户端从该位置继续上传
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "上传会话ID"
+// @Success      200  {object}  uploadSessionResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /files/uploads/{id} [get]
+func GetUpload(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	s, ok := loadUploadSession(c, userID)
+	if !ok {
+		return
+	}
+	c.Header(UploadOffsetHeader, strconv.FormatInt(s.Offset, 10))
+	c.JSON(http.StatusOK, toUploadSessionResponse(s))
+}
+
+// UploadChunk godoc
+// @Summary      上传分片
+// @Description  请求体为分片的原始字节（application/octet-stream），Upload-Offset 请求头必须等于服务端已保存的字节数；分片不能超过 chunk_size。连接中断时已收到的字节会保留，查询进度后继续即可
+// @Tags         Files
+// @Accept       application/octet-stream
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id             path    int  true  "上传会话ID"
+// @Param        Upload-Offset  header  int  true  "分片起始偏移量"
+// @Success      200  {object}  uploadSessionResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse  "偏移量不一致，响应中的 offset 为正确位置"
+// @Failure      413  {object}  ErrorResponse
+// @Router       /files/uploads/{id} [put]
+func UploadChunk(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader(UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid Upload-Offset header"})
+		return
+	}
+	s, ok := loadUploadSession(c, userID)
+	if !ok {
+		return
+	}
+	unlock, ok := lockUploadSession(c, s.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if err := global.DB.First(s, s.ID).Error; err != nil { // 加锁后重新读取偏移量
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		return
+	}
+	c.Header(UploadOffsetHeader, strconv.FormatInt(s.Offset, 10))
+	if offset != s.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": "offset mismatch", "offset": s.Offset})
+		return
+	}
+	limit := min(s.ChunkSize, s.FileSize-s.Offset)
+	if limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload already has all bytes, call complete"})
+		return
+	}
+	tempPath, err := utils.SafeJoinRel(config.AppConfig.Upload.Storagepath, s.TempPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stored path"})
+		return
+	}
+	f, err := os.OpenFile(tempPath, os.O_WRONLY, 0644)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "open temp file failed"})
+		return
+	}
+	defer f.Close()
+	// 丢弃上次中断后残留的未确认字节，从已确认的位置写入
+	if err := f.Truncate(s.Offset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "write file failed"})
+		return
+	}
+	if _, err := f.Seek(s.Offset, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "write file failed"})
+		return
+	}
+	written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, limit+1))
+	if written > limit {
+		_ = f.Truncate(s.Offset)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("chunk exceeds %d bytes", limit), "offset": s.Offset})
+		return
+	}
+	if written == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty chunk", "offset": s.Offset})
+		return
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Truncate(s.Offset)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "write file failed", "offset": s.Offset})
+		return
+	}
+	// 连接中断时也保留已经写入的部分，客户端查询进度后继续
+	newOffset := s.Offset + written
+	if err := global.DB.Model(&models.UploadSession{}).Where("id = ? AND offset = ?", s.ID, s.Offset).
+		Updates(map[string]any{"offset": newOffset, "expires_at": time.Now().Add(config.UploadSessionTTL)}).Error; err != nil {
+		_ = f.Truncate(s.Offset)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "save progress failed", "offset": s.Offset})
+		return
+	}
+	s.Offset = newOffset
+	s.ExpiresAt = time.Now().Add(config.UploadSessionTTL)
+	c.Header(UploadOffsetHeader, strconv.FormatInt(s.Offset, 10))
+	if copyErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload interrupted", "offset": s.Offset})
+		return
+	}
+	c.JSON(http.StatusOK, toUploadSessionResponse(s))
+}
+
+// CompleteUpload godoc
+// @Summary      完成分片上传
+// @Description  所有字节到齐后计算 SHA-256（与初始化时声明的摘要不一致则丢弃该上传），再次校验配额，按哈希存入去重存储并生成文件记录
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "上传会话ID"
+// @Success      200  {object}  completeUploadResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse  "SHA-256 不一致"
+// @Failure      500  {object}  ErrorResponse
+// @Router       /files/uploads/{id}/complete [post]
+func CompleteUpload(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	s, ok := loadUploadSession(c, userID)
+	if !ok {
+		return
+	}
+	unlock, ok := lockUploadSession(c, s.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if err := global.DB.First(s, s.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		return
+	}
+	if s.Offset != s.FileSize {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is incomplete", "offset": s.Offset, "size": s.FileSize})
+		return
+	}
+	baseRel := config.AppConfig.Upload.Storagepath
+	tempPath, err := utils.SafeJoinRel(baseRel, s.TempPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stored path"})
+		return
+	}
+	f, err := os.Open(tempPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "open temp file failed"})
+		return
+	}
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(f, sniff)
+	contentType := http.DetectContentType(sniff[:n])
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "read file failed"})
+		return
+	}
+	_, maxFile, maxTotal := uploadLimits()
+	sum, written, err := utils.CopyWithHash(io.Discard, f, maxFile, s.FileSize)
+	f.Close()
+	if err != nil {
+		_ = config.RemoveUploadSession(s)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "verify file failed: " + err.Error()})
+		return
+	}
+	if s.SHA256 != "" && sum != s.SHA256 {
+		_ = config.RemoveUploadSession(s)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "sha256 mismatch, upload discarded", "expected": s.SHA256, "actual": sum})
+		return
+	}
+	used, err := usedUploadQuota(userID, s.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	if used+written > maxTotal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "storage limit exceeded"})
+		return
+	}
+
+	scanStatus, scanDetail, err := config.ScanUpload(c.Request.Context(), tempPath, s.Filename)
+	if err != nil {
+		_ = config.RemoveUploadSession(s)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + ", upload discarded"})
+		return
+	}
+
+	// 临时文件移入按哈希寻址的 blobs，内容已存在时只增加引用
+	newFile := models.Files{
+		UserID:     userID,
+		Filename:   s.Filename,
+		FileType:   contentType,
+		FileSize:   written,
+		Hash:       sum,
+		FileInfo:   s.FileInfo,
+		ScanStatus: scanStatus,
+		ScanDetail: scanDetail,
+	}
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		key, err := config.AttachBlob(tx, tempPath, sum, written)
+		if err != nil {
+			return err
+		}
+		newFile.FilePath = key
+		if err := tx.Create(&newFile).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.UploadSession{}, s.ID).Error
+	})
+	if err != nil {
+		_ = config.RemoveUploadSession(s) // 临时文件可能已被移走，无法重试，需要重新上传
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "save to database failed, please upload again"})
+		return
+	}
+	config.EnqueueMedia(sum) // 图片在后台生成缩略图
+	c.JSON(http.StatusOK, &completeUploadResponse{
+		UploadResponse: UploadResponse{
+			Msg:        "该文件上传成功！",
+			ID:         newFile.ID,
+			URL:        fmt.Sprintf("/files/%d", newFile.ID),
+			Size:       utils.Get_size(written),
+			ScanStatus: scanStatus,
+		},
+		SHA256: sum,
+	})
+}
+
+// AbortUpload godoc
+// @Summary      取消分片上传
+// @Description  删除会话和已上传的临时数据，释放占用的配额
+// @Tags         Files
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int  true  "上传会话ID"
+// @Success      200  {object}  map[string]bool
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Router       /files/uploads/{id} [delete]
+func AbortUpload(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	s, ok := loadUploadSession(c, userID)
+	if !ok {
+		return
+	}
+	unlock, ok := lockUploadSession(c, s.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if err := config.RemoveUploadSession(s); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cancel upload failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// suspendUserDTO 暂停/封禁请求参数
+type suspendUserDTO struct {
+	Status        string `json:"status" binding:"required,oneof=suspended banned"` // suspended 暂停，banned 封禁
+	DurationHours int    `json:"duration_hours" binding:"min=0"`                   // 暂停时长（小时），0 表示无限期；封禁时忽略
+	Reason        string `json:"reason" binding:"required,max=255"`                // 原因，用户登录时可见
+}
+
+// userStatusResponse 用户状态变更结果
+type userStatusResponse struct {
+	ID             uint       `json:"id"`
+	Status         string     `json:"status"`
+	StatusReason   string     `json:"reason"`
+	SuspendedUntil *time.Time `json:"until,omitempty"`
+}
+
+// 读取并校验管理操作的目标用户：不能操作自己、超级管理员以及拥有自己所没有的权限的用户
+func loadManagedUser(c *gin.Context) (*models.Users, bool) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || targetID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	var target models.Users
+	if err := global.DB.First(&target, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return nil, false
+	}
+	if target.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能对自己执行该操作"})
+		return nil, false
+	}
+	if target.Role == models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能操作超级管理员"})
+		return nil, false
+	}
+	if !canManageRole(c.GetString("role"), target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能操作拥有自己所没有权限的用户"})
+		return nil, false
+	}
+	return &target, true
+}
+
+// SuspendUser
+// @Summary 暂停或封禁用户
+// @Description 管理员暂停（可指定时长）或永久封禁用户，原因会在用户登录时展示；该用户所有会话立即失效
+// @Tags UserManagement
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param data body suspendUserDTO true "状态与原因"
+// @Security Bearer
+// @Success 200 {object} userStatusResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/suspend [post]
+func SuspendUser(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	var input suspendUserDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	var until *time.Time
+	if input.Status == models.StatusSuspended && input.DurationHours > 0 {
+		t := time.Now().Add(time.Duration(input.DurationHours) * time.Hour)
+		until = &t
+	}
+	if err := global.DB.Model(&models.Users{}).Where("id = ?", target.ID).Updates(map[string]any{
+		"status":          input.Status,
+		"status_reason":   input.Reason,
+		"suspended_until": until,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户状态失败"})
+		return
+	}
+	// 已登录的设备全部下线（同时清掉用户缓存）
+	if err := revokeAllUserSessions(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销用户会话失败"})
+		return
+	}
+	recordAudit(c, auditEntry{
+		Action:     models.AuditUserSuspend,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     gin.H{"status": target.Status, "reason": target.StatusReason, "until": target.SuspendedUntil},
+		After:      gin.H{"status": input.Status, "reason": input.Reason, "until": until},
+	})
+	c.JSON(http.StatusOK, &userStatusResponse{
+		ID:             target.ID,
+		Status:         input.Status,
+		StatusReason:   input.Reason,
+		SuspendedUntil: until,
+	})
+}
+
+// UnsuspendUser
+// @Summary 解除暂停或封禁
+// @Description 管理员将用户恢复为正常状态，并解除连续密码错误导致的临时锁定
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security Bearer
+// @Success 200 {object} userStatusResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/unsuspend [post]
+func UnsuspendUser(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if err := global.DB.Model(&models.Users{}).Where("id = ?", target.ID).Updates(map[string]any{
+		"status":          models.StatusActive,
+		"status_reason":   "",
+		"suspended_until": nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户状态失败"})
+		return
+	}
+	config.ClearUserCache(target.Username)
+	global.RedisDB.Del(fmt.Sprintf(config.RedisLoginLock, target.Username), fmt.Sprintf(config.RedisLoginFail, target.Username))
+	recordAudit(c, auditEntry{
+		Action:     models.AuditUserUnsuspend,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     gin.H{"status": target.Status, "reason": target.StatusReason, "until": target.SuspendedUntil},
+		After:      gin.H{"status": models.StatusActive},
+	})
+	c.JSON(http.StatusOK, &userStatusResponse{ID: target.ID, Status: models.StatusActive})
+}
+
+// 待审核的注册申请，其他状态的用户不能审核
+func loadPendingUser(c *gin.Context) (*models.Users, bool) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return nil, false
+	}
+	if target.Status != models.StatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "该用户不在待审核状态"})
+		return nil, false
+	}
+	return target, true
+}
+
+// ApproveUser
+// @Summary 通过注册审核
+// @Description 审核注册方式下新注册的用户处于待审核状态，通过后才能登录；待审核列表见 GET /dashboard/users?status=pending
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security Bearer
+// @Success 200 {object} userStatusResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/approve [post]
+func ApproveUser(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	target, ok := loadPendingUser(c)
+	if !ok {
+		return
+	}
+	res := global.DB.Model(&models.Users{}).
+		Where("id = ? AND status = ?", target.ID, models.StatusPending).
+		Update("status", models.StatusActive)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户状态失败"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "该用户不在待审核状态"})
+		return
+	}
+	config.ClearUserCache(target.Username)
+	recordAudit(c, auditEntry{
+		Action:     models.AuditUserApprove,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     gin.H{"status": models.StatusPending},
+		After:      gin.H{"status": models.StatusActive},
+	})
+	c.JSON(http.StatusOK, &userStatusResponse{ID: target.ID, Status: models.StatusActive})
+}
+
+// RejectUser
+// @Summary 拒绝注册申请
+// @Description 彻底删除待审核的用户，用户名可以重新注册
+// @Tags UserManagement
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security Bearer
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /dashboard/user/{id}/reject [post]
+func RejectUser(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	Role := c.GetString("role")
+	if userID == 0 || !config.HasPermission(Role, models.PermUsersManage) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no permission,the user does not log in"})
+		return
+	}
+	target, ok := loadPendingUser(c)
+	if !ok {
+		return
+	}
+	if err := config.PurgeUser(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
+		return
+	}
+	config.ClearUserCache(target.Username)
+	recordAudit(c, auditEntry{
+		Action:     models.AuditUserReject,
+		TargetType: models.AuditTargetUser,
+		TargetID:   target.ID,
+		Before:     auditUser(target),
+	})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
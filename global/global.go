@@ -2,6 +2,7 @@ package global
 
 // 供后端代码的全局变量使用
 import (
+	"project/storage"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -12,6 +13,7 @@ import (
 var (
 	DB           *gorm.DB // 数据库连接
 	RedisDB      *redis.Client
+	Storage      storage.Storage // 上传文件的存储后端
 	// 并行组
 	FetchGroup   singleflight.Group
 	// 单个请求的超时时间
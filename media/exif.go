@@ -0,0 +1,347 @@
+package media
+
+// JPEG 中 EXIF（APP1 段内的 TIFF 结构）的读取，以及原地抹去 GPS 定位信息
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExifScanSize 查找 EXIF 时读取的 JPEG 开头字节数：APP1 段最长 64KB，之前可能还有 APP0 等段
+const ExifScanSize = 128 << 10
+
+const (
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+// Exif 解析出的常用字段，Fields 的值已格式化为字符串
+type Exif struct {
+	Fields      map[string]string
+	Orientation int
+	HasGPS      bool
+}
+
+type exifKind int
+
+const (
+	kindString  exifKind = iota
+	kindInt              // 第一个整数
+	kindRatio            // 分数，如曝光时间 1/125
+	kindFloat            // 分数换算的小数，如光圈 2.8
+	kindDegrees          // 度分秒三个分数换算的十进制度数
+)
+
+type exifTag struct {
+	name string
+	kind exifKind
+}
+
+var (
+	ifd0Tags = map[uint16]exifTag{
+		0x010F: {"Make", kindString},
+		0x0110: {"Model", kindString},
+		0x0112: {"Orientation", kindInt},
+		0x0131: {"Software", kindString},
+		0x0132: {"DateTime", kindString},
+	}
+	exifIFDTags = map[uint16]exifTag{
+		0x9003: {"DateTimeOriginal", kindString},
+		0x829A: {"ExposureTime", kindRatio},
+		0x829D: {"FNumber", kindFloat},
+		0x8827: {"ISOSpeedRatings", kindInt},
+		0x920A: {"FocalLength", kindFloat},
+		0xA434: {"LensModel", kindString},
+	}
+	gpsTags = map[uint16]exifTag{
+		0x0001: {"GPSLatitudeRef", kindString},
+		0x0002: {"GPSLatitude", kindDegrees},
+		0x0003: {"GPSLongitudeRef", kindString},
+		0x0004: {"GPSLongitude", kindDegrees},
+		0x0006: {"GPSAltitude", kindFloat},
+	}
+)
+
+// 各 TIFF 数据类型单个值的字节数
+var tiffTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// ReadExif 从 JPEG 开头读取 EXIF；没有 EXIF 时返回 nil, nil
+func ReadExif(r io.Reader) (*Exif, error) {
+	head, err := io.ReadAll(io.LimitReader(r, ExifScanSize))
+	if err != nil {
+		return nil, err
+	}
+	t, ifd0, ok := newTIFF(findExif(head))
+	if !ok {
+		return nil, nil
+	}
+	ex := &Exif{Fields: map[string]string{}}
+	entries := t.entries(ifd0)
+	t.collect(entries, ifd0Tags, ex.Fields)
+	for _, e := range entries {
+		switch e.tag {
+		case 0x0112:
+			if v, ok := t.uints(e); ok && len(v) > 0 {
+				ex.Orientation = int(v[0])
+			}
+		case tagExifIFD:
+			if v, ok := t.uints(e); ok && len(v) > 0 {
+				t.collect(t.entries(uint32(v[0])), exifIFDTags, ex.Fields)
+			}
+		case tagGPSIFD:
+			if v, ok := t.uints(e); ok && len(v) > 0 {
+				gps := t.entries(uint32(v[0]))
+				ex.HasGPS = len(gps) > 0
+				t.collect(gps, gpsTags, ex.Fields)
+			}
+		}
+	}
+	return ex, nil
+}
+
+// StripGPS 在 JPEG 开头的字节中原地清零 GPS 子目录及其数据，文件长度不变；返回是否有改动。
+// head 至少应包含完整的 EXIF 段（读取 ExifScanSize 字节即可）
+func StripGPS(head []byte) bool {
+	t, ifd0, ok := newTIFF(findExif(head))
+	if !ok {
+		return false
+	}
+	for _, e := range t.entries(ifd0) {
+		if e.tag != tagGPSIFD {
+			continue
+		}
+		v, ok := t.uints(e)
+		if !ok || len(v) == 0 {
+			return false
+		}
+		off := uint32(v[0])
+		gps := t.entries(off)
+		if len(gps) == 0 {
+			return false
+		}
+		for _, g := range gps {
+			if size, ok := t.size(g); ok && size > 4 {
+				if p := t.bo.Uint32(t.b[g.pos+8:]); uint64(p)+uint64(size) <= uint64(len(t.b)) {
+					clear(t.b[p : p+size])
+				}
+			}
+			clear(t.b[g.pos : g.pos+12])
+		}
+		t.bo.PutUint16(t.b[off:], 0) // 目录项数为 0，之后的下一目录指针也已清零
+		return true
+	}
+	return false
+}
+
+// 返回 APP1 段中 TIFF 数据的切片（与 b 共享底层数组），没有 EXIF 时返回 nil
+func findExif(b []byte) []byte {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil
+	}
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			return nil
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF: // 填充字节
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // 图像数据开始，EXIF 只会出现在它之前
+			return nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // 没有长度字段的标记
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(b[i+2:]))
+		if n < 2 || i+2+n > len(b) {
+			return nil
+		}
+		seg := b[i+4 : i+2+n]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+type tiff struct {
+	b  []byte
+	bo binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	pos      int // 目录项在 TIFF 数据中的位置
+}
+
+func newTIFF(b []byte) (*tiff, uint32, bool) {
+	if len(b) < 8 {
+		return nil, 0, false
+	}
+	var bo binary.ByteOrder
+	switch string(b[:4]) {
+	case "II*\x00":
+		bo = binary.LittleEndian
+	case "MM\x00*":
+		bo = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	return &tiff{b: b, bo: bo}, bo.Uint32(b[4:]), true
+}
+
+// 读取一个目录的全部目录项，越界时返回 nil
+func (t *tiff) entries(off uint32) []ifdEntry {
+	if uint64(off)+2 > uint64(len(t.b)) {
+		return nil
+	}
+	n := int(t.bo.Uint16(t.b[off:]))
+	start := int(off) + 2
+	if start+n*12 > len(t.b) {
+		return nil
+	}
+	out := make([]ifdEntry, 0, n)
+	for i := 0; i < n; i++ {
+		p := start + i*12
+		out = append(out, ifdEntry{tag: t.bo.Uint16(t.b[p:]), typ: t.bo.Uint16(t.b[p+2:]), count: t.bo.Uint32(t.b[p+4:]), pos: p})
+	}
+	return out
+}
+
+func (t *tiff) size(e ifdEntry) (uint32, bool) {
+	unit, ok := tiffTypeSize[e.typ]
+	if !ok || e.count > 1<<20 {
+		return 0, false
+	}
+	return unit * e.count, true
+}
+
+// 目录项的值：不超过 4 字节时直接存放在目录项中，否则为偏移量
+func (t *tiff) value(e ifdEntry) ([]byte, bool) {
+	size, ok := t.size(e)
+	if !ok {
+		return nil, false
+	}
+	if size <= 4 {
+		return t.b[e.pos+8 : e.pos+8+int(size)], true
+	}
+	off := t.bo.Uint32(t.b[e.pos+8:])
+	if uint64(off)+uint64(size) > uint64(len(t.b)) {
+		return nil, false
+	}
+	return t.b[off : off+size], true
+}
+
+func (t *tiff) uints(e ifdEntry) ([]uint64, bool) {
+	v, ok := t.value(e)
+	if !ok {
+		return nil, false
+	}
+	var out []uint64
+	switch e.typ {
+	case 1, 7:
+		for _, c := range v {
+			out = append(out, uint64(c))
+		}
+	case 3:
+		for i := 0; i+2 <= len(v); i += 2 {
+			out = append(out, uint64(t.bo.Uint16(v[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(v); i += 4 {
+			out = append(out, uint64(t.bo.Uint32(v[i:])))
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+func (t *tiff) rationals(e ifdEntry) ([][2]int64, bool) {
+	if e.typ != 5 && e.typ != 10 {
+		return nil, false
+	}
+	v, ok := t.value(e)
+	if !ok {
+		return nil, false
+	}
+	var out [][2]int64
+	for i := 0; i+8 <= len(v); i += 8 {
+		n, d := int64(t.bo.Uint32(v[i:])), int64(t.bo.Uint32(v[i+4:]))
+		if e.typ == 10 {
+			n, d = int64(int32(n)), int64(int32(d))
+		}
+		out = append(out, [2]int64{n, d})
+	}
+	return out, true
+}
+
+// 按标签表取出并格式化目录中的字段，无法解析的字段忽略
+func (t *tiff) collect(entries []ifdEntry, tags map[uint16]exifTag, out map[string]string) {
+	for _, e := range entries {
+		tag, ok := tags[e.tag]
+		if !ok {
+			continue
+		}
+		if s, ok := t.format(e, tag.kind); ok && s != "" {
+			out[tag.name] = s
+		}
+	}
+}
+
+func (t *tiff) format(e ifdEntry, kind exifKind) (string, bool) {
+	switch kind {
+	case kindString:
+		v, ok := t.value(e)
+		if !ok || e.typ != 2 {
+			return "", false
+		}
+		s := strings.TrimRight(strings.ToValidUTF8(string(v), ""), "\x00 ")
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsPrint(r) {
+				return r
+			}
+			return -1
+		}, s)
+		if len(s) > 128 {
+			s = s[:128]
+		}
+		return strings.ToValidUTF8(s, ""), true
+	case kindInt:
+		v, ok := t.uints(e)
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return strconv.FormatUint(v[0], 10), true
+	case kindRatio, kindFloat:
+		v, ok := t.rationals(e)
+		if !ok || len(v) == 0 || v[0][1] == 0 {
+			return "", false
+		}
+		if kind == kindRatio {
+			return fmt.Sprintf("%d/%d", v[0][0], v[0][1]), true
+		}
+		return strconv.FormatFloat(float64(v[0][0])/float64(v[0][1]), 'f', -1, 64), true
+	case kindDegrees:
+		v, ok := t.rationals(e)
+		if !ok || len(v) < 3 {
+			return "", false
+		}
+		deg := 0.0
+		for i, div := range []float64{1, 60, 3600} {
+			if v[i][1] == 0 {
+				return "", false
+			}
+			deg += float64(v[i][0]) / float64(v[i][1]) / div
+		}
+		return strconv.FormatFloat(deg, 'f', 6, 64), true
+	}
+	return "", false
+}
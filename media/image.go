@@ -0,0 +1,145 @@
+package media
+
+// 纯 Go 的图片处理：读取尺寸、按 EXIF 方向摆正、生成 JPEG 缩略图；支持 JPEG/PNG/GIF（GIF 取第一帧）
+import (
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+const thumbnailQuality = 80
+
+var (
+	ErrUnsupported = errors.New("media: unsupported image format")
+	ErrTooLarge    = errors.New("media: image has too many pixels")
+)
+
+// Probe 只读取文件头，返回图片格式（jpeg/png/gif）与宽高
+func Probe(r io.Reader) (format string, width, height int, err error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return "", 0, 0, ErrUnsupported
+		}
+		return "", 0, 0, err
+	}
+	return format, cfg.Width, cfg.Height, nil
+}
+
+// Decode 解码图片并铺到白色背景上（缩略图统一输出 JPEG，没有透明通道）；
+// 先检查像素数，避免超大尺寸的图片解码时耗尽内存
+func Decode(r io.ReadSeeker, maxPixels int64) (*image.RGBA, error) {
+	_, w, h, err := Probe(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxPixels > 0 && int64(w)*int64(h) > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	} else {
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	}
+	return dst, nil
+}
+
+// Resize 按比例缩小到最长边不超过 limit（区域平均，缩小时不产生锯齿）；本身足够小时原样返回，不放大
+func Resize(src *image.RGBA, limit int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if limit <= 0 || (sw <= limit && sh <= limit) {
+		return src
+	}
+	tw, th := limit, limit
+	if sw >= sh {
+		th = max(1, sh*limit/sw)
+	} else {
+		tw = max(1, sw*limit/sh)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*sh/th, (y+1)*sh/th
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*sw/tw, (x+1)*sw/tw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a uint64
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					bl += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			j := dst.PixOffset(x, y)
+			dst.Pix[j], dst.Pix[j+1], dst.Pix[j+2], dst.Pix[j+3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// Orient 按 EXIF Orientation（1-8）把图片转为正常的显示方向
+func Orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 5-8 需要旋转 90 度，宽高互换
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			i, j := src.PixOffset(b.Min.X+sx, b.Min.Y+sy), dst.PixOffset(x, y)
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG 以缩略图的质量编码为 JPEG
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: thumbnailQuality})
+}
@@ -0,0 +1,61 @@
+package media
+
+import (
+	"errors"
+	"io"
+)
+
+// OverlayHead 返回的读取器前 len(head) 字节取自 head，其余取自 r，
+// 用于输出抹去 GPS 后的图片而不改动存储中的原件；支持 Seek，可直接交给 http.ServeContent
+func OverlayHead(r io.ReadSeeker, head []byte) io.ReadSeeker {
+	return &overlay{r: r, head: head, rpos: -1}
+}
+
+type overlay struct {
+	r    io.ReadSeeker
+	head []byte
+	off  int64 // 调用方的读取位置
+	rpos int64 // r 的当前位置，-1 表示未知
+}
+
+func (o *overlay) Read(p []byte) (int, error) {
+	if o.off < int64(len(o.head)) {
+		n := copy(p, o.head[o.off:])
+		o.off += int64(n)
+		return n, nil
+	}
+	if o.rpos != o.off {
+		if _, err := o.r.Seek(o.off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		o.rpos = o.off
+	}
+	n, err := o.r.Read(p)
+	o.off += int64(n)
+	o.rpos += int64(n)
+	return n, err
+}
+
+func (o *overlay) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.off + offset
+	case io.SeekEnd:
+		size, err := o.r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		o.rpos = size
+		abs = size + offset
+	default:
+		return 0, errors.New("media: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("media: negative position")
+	}
+	o.off = abs
+	return abs, nil
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"project/config"
 	"project/global"
 	"project/models"
 	"project/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,6 +23,7 @@ func AuthMiddleWare() gin.HandlerFunc { //返回的是gin下的函数类型
 		if token == "" {
 			if ck, err := c.Cookie(utils.CookieName); err == nil {
 				token = ck
+				c.Set("auth_via_cookie", true) // 浏览器自动携带的凭据，写操作需要 CSRF 校验
 			}
 		}
 		// 去掉 "Bearer " 前缀（如果存在）
@@ -33,51 +36,97 @@ func AuthMiddleWare() gin.HandlerFunc { //返回的是gin下的函数类型
 			c.Abort() //不中止
 			return
 		}
-		username, role, expireTime, err := utils.ParseJWT(token) //不管什么用户我都让其通过
+		if strings.HasPrefix(token, models.PATPrefix) { // 个人访问令牌，供脚本调用
+			authenticatePAT(c, token)
+			return
+		}
+		claims, err := utils.ParseJWTClaims(token) //不管什么用户我都让其通过
 		if err != nil {
+			if utils.IsTokenExpired(err) { // 访问令牌有效期很短，过期时提示前端用刷新令牌续期
+				abortTokenExpired(c)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
-		setContext(c, username, role, expireTime) //提前已经设置了
-		cacheKey := fmt.Sprintf(config.RedisKeyUsers, username)
-		var u models.Users
-		//L1 本地LRU缓存
-		if data, exists := config.LocalUserCache.Get(cacheKey); exists {
-			c.Set("user_id", data.ID)
-			c.Next()
+		// 服务端注销：单个令牌或整个会话已被拉黑
+		if config.IsAccessTokenRevoked(claims.ID, claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked, please login again"})
+			c.Abort()
 			return
 		}
-		//L2 Redis缓存
-		if data, err := global.RedisDB.Get(cacheKey).Result(); err == nil {
-			if err := json.Unmarshal([]byte(data), &u); err == nil {
-				// 更新本地缓存
-				config.LocalUserCache.Add(cacheKey, u)
-				c.Set("user_id", u.ID)
-				c.Next()
-				return
-			}
-		}
-		// 查询数据库
-		if err := global.DB.Select("id"). //只给这三组数据
-									Where("username = ?", username). //where限定条件
-									First(&u).Error; err != nil {
+		setContext(c, claims.Username, claims.Role, claims.ExpiresAt) //提前已经设置了
+		c.Set("jti", claims.ID)
+		c.Set("sid", claims.SessionID)
+		u, err := loadAuthUser(claims.Username)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 			c.Abort()
 			return
 		}
-		// 认证成功后
-		if userData, err := json.Marshal(u); err == nil {
-			global.RedisDB.Set(cacheKey, userData, config.CacheTTL) //2h
+		// 令牌版本落后说明管理员强制下线或用户执行了“全部退出”
+		if claims.Version != u.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session has been revoked, please login again"})
+			c.Abort()
+			return
+		}
+		if u.IsBlocked(time.Now()) { // 暂停或封禁立即生效
+			c.JSON(http.StatusForbidden, gin.H{"error": "account " + u.Status, "status": u.Status, "reason": u.StatusReason})
+			c.Abort()
+			return
 		}
-		config.LocalUserCache.Add(cacheKey, u) //添加设置
 		c.Set("user_id", u.ID)
+		c.Set("role", u.Role) // 以数据库中的角色为准，角色变更立即生效而不必等令牌过期
+		c.Set("mfa_enabled", u.TOTPEnabled)
 		c.Next()
 	}
 }
+
+// 依次查询 L1 本地LRU缓存、L2 Redis缓存、数据库；缓存的是完整的 models.Users，
+// 角色、状态等字段变化时由 config.ClearUserCache 失效
+func loadAuthUser(username string) (models.Users, error) {
+	cacheKey := fmt.Sprintf(config.RedisKeyUsers, username)
+	var u models.Users
+	//L1 本地LRU缓存
+	if data, exists := config.LocalUserCache.Get(cacheKey); exists {
+		return data, nil
+	}
+	//L2 Redis缓存
+	if data, err := global.RedisDB.Get(cacheKey).Result(); err == nil {
+		if err := json.Unmarshal([]byte(data), &u); err == nil {
+			// 更新本地缓存
+			config.LocalUserCache.Add(cacheKey, u)
+			return u, nil
+		}
+	}
+	// 查询数据库
+	if err := global.DB.Where("username = ?", username). //where限定条件
+								First(&u).Error; err != nil {
+		return u, err
+	}
+	u.Password = "" // 缓存完整的用户信息，但不缓存密码哈希
+	// 认证成功后
+	if userData, err := json.Marshal(u); err == nil {
+		global.RedisDB.Set(cacheKey, userData, config.CacheTTL) //2h
+	}
+	config.LocalUserCache.Add(cacheKey, u) //添加设置
+	return u, nil
+}
 func setContext(c *gin.Context, username, role string, expireTime int64) {
     c.Set("username", username)
     c.Set("role", role)
     c.Set("exp", expireTime)
     c.Set("my_blog", models.My_blog_url)
 }
+
+// 访问令牌过期：页面请求跳转到登录页由其尝试续期，接口请求返回 token_expired 供前端调用 /api/auth/refresh
+func abortTokenExpired(c *gin.Context) {
+	if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html") {
+		c.Redirect(http.StatusFound, "/auth/login?expired=1&next="+url.QueryEscape(c.Request.URL.RequestURI()))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired", "code": "token_expired"})
+	c.Abort()
+}
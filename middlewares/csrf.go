@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"net/http"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRFProtect 校验使用 cookie 认证的非安全方法请求（POST/PUT/PATCH/DELETE）；
+// 通过 Authorization 请求头携带 JWT 或个人访问令牌的调用方不受影响，浏览器不会自动附带请求头
+func CSRFProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if !c.GetBool("auth_via_cookie") || utils.CSRFTokenValid(c) {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing or invalid CSRF token", "code": "csrf_invalid"})
+		c.Abort()
+	}
+}
@@ -25,6 +25,7 @@ func GinLogger() gin.HandlerFunc { // 返回对应中间件的函数
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("latency", time.Since(start)),
 			zap.Int("response size", c.Writer.Size()), // 响应的大小
+			zap.String("request_id", c.GetString("request_id")),
 		}
 		// 记录完整的日志信息-每一次链接打印一边信息
 		if errMsg != "" {
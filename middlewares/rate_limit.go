@@ -0,0 +1,250 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"project/config"
+	"project/global"
+	"project/log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.uber.org/zap"
+)
+
+// 滑动窗口计数：上一窗口的计数按其仍落在滑动窗口内的比例折算，加上当前窗口的计数。
+// KEYS[1] 当前窗口，KEYS[2] 上一窗口；ARGV 依次为上限、窗口长度（毫秒）、当前窗口已过去的毫秒数
+var rateLimitScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * (ARGV[2] - ARGV[3]) / ARGV[2] + cur + 1 > tonumber(ARGV[1]) then
+	return {0, cur, prev}
+end
+cur = redis.call('INCR', KEYS[1])
+if cur == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2] * 2)
+end
+return {1, cur, prev}
+`)
+
+// Redis 不可用时的进程内计数，按计数对象淘汰最久未用的记录
+type localWindow struct {
+	index     int64
+	cur, prev int64
+}
+
+var (
+	localWindowsMu sync.Mutex
+	localWindows   *lru.Cache[string, *localWindow]
+)
+
+func init() {
+	localWindows, _ = lru.New[string, *localWindow](config.RateLimitLocalSize)
+}
+
+var errRedisUnavailable = errors.New("redis is not initialized")
+
+type ratePolicy struct {
+	name string
+	config.RateLimitPolicy
+}
+
+// 并发限制：名额已满时最多等待这么久，仍拿不到名额返回 429
+const concurrencyWait = 300 * time.Millisecond
+
+type rateResult struct {
+	allowed   bool
+	limit     int
+	remaining int
+	reset     time.Duration // 当前窗口结束的时间
+	retry     time.Duration // 被拒绝时需要等待的时间
+}
+
+// RateLimit 按 config.yaml 中 rateLimit.policies 的策略限流，可同时引用多个策略，任一超限即返回 429；
+// 响应头 RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset 取剩余次数最少的策略，超限时附带 Retry-After。
+// 配置了 concurrent 的策略限制本进程同时处理的请求数，请求结束后归还名额
+func RateLimit(names ...string) gin.HandlerFunc {
+	var policies []ratePolicy
+	var slots []chan struct{}
+	if config.AppConfig != nil && config.AppConfig.RateLimit.Enabled {
+		for _, name := range names {
+			p, ok := config.AppConfig.RateLimit.Policies[strings.ToLower(name)] // viper 读取的键均为小写
+			switch {
+			case ok && p.Concurrent > 0:
+				slots = append(slots, make(chan struct{}, p.Concurrent))
+			case ok && p.Limit > 0 && p.Window > 0:
+				policies = append(policies, ratePolicy{name: name, RateLimitPolicy: p})
+			default:
+				log.L().Warn("rate limit policy is not configured, skipped", zap.String("policy", name))
+			}
+		}
+	}
+	return func(c *gin.Context) {
+		if len(policies) == 0 && len(slots) == 0 {
+			c.Next()
+			return
+		}
+		if len(policies) == 0 {
+			acquireSlots(c, slots)
+			return
+		}
+		var tightest rateResult
+		for i, p := range policies {
+			r := takeRate(p, rateSubject(c, p.RateLimitPolicy), time.Now())
+			if !r.allowed {
+				setRateHeaders(c, r)
+				retry := int(math.Ceil(r.retry.Seconds()))
+				c.Header("Retry-After", strconv.Itoa(retry))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, please try again later", "code": "rate_limited", "retry_after": retry})
+				c.Abort()
+				return
+			}
+			if i == 0 || r.remaining < tightest.remaining {
+				tightest = r
+			}
+		}
+		setRateHeaders(c, tightest)
+		acquireSlots(c, slots)
+	}
+}
+
+// 依次占用并发名额后处理请求；任一名额在 concurrencyWait 内拿不到即返回 429
+func acquireSlots(c *gin.Context, slots []chan struct{}) {
+	for _, slot := range slots {
+		select {
+		case slot <- struct{}{}:
+			defer func(slot chan struct{}) { <-slot }(slot)
+		case <-c.Request.Context().Done():
+			c.AbortWithStatusJSON(http.StatusRequestTimeout, gin.H{"error": "client canceled"})
+			return
+		case <-time.After(concurrencyWait):
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "server is busy, please try again later", "code": "rate_limited", "retry_after": 1})
+			c.Abort()
+			return
+		}
+	}
+	c.Next()
+}
+
+// 计数对象：登录用户按用户ID（未登录时按IP），也可按IP或全部请求共享
+func rateSubject(c *gin.Context, p config.RateLimitPolicy) string {
+	var subject string
+	switch p.Key {
+	case "ip":
+		subject = "ip:" + c.ClientIP()
+	case "route":
+		subject = "all"
+	default:
+		if uid := c.GetUint("user_id"); uid != 0 {
+			subject = fmt.Sprintf("user:%d", uid)
+		} else {
+			subject = "ip:" + c.ClientIP()
+		}
+	}
+	if p.PerRoute || p.Key == "route" {
+		subject += ":" + c.Request.Method + ":" + c.FullPath()
+	}
+	return subject
+}
+
+func takeRate(p ratePolicy, subject string, now time.Time) rateResult {
+	window := time.Duration(p.Window) * time.Second
+	index := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(window))
+
+	var (
+		allowed   bool
+		cur, prev int64
+		err       = errRedisUnavailable
+	)
+	if global.RedisDB != nil {
+		allowed, cur, prev, err = takeRedis(p, subject, index, window, elapsed)
+	}
+	if err != nil {
+		allowed, cur, prev = takeLocal(p, subject, index, elapsed)
+	}
+	return rateOutcome(p.Limit, window, elapsed, allowed, cur, prev)
+}
+
+func takeRedis(p ratePolicy, subject string, index int64, window, elapsed time.Duration) (bool, int64, int64, error) {
+	keys := []string{
+		fmt.Sprintf(config.RedisRateLimit, p.name, subject, index),
+		fmt.Sprintf(config.RedisRateLimit, p.name, subject, index-1),
+	}
+	res, err := rateLimitScript.Run(global.RedisDB, keys, p.Limit, window.Milliseconds(), elapsed.Milliseconds()).Result()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	allowed, _ := vals[0].(int64)
+	cur, _ := vals[1].(int64)
+	prev, _ := vals[2].(int64)
+	return allowed == 1, cur, prev, nil
+}
+
+func takeLocal(p ratePolicy, subject string, index int64, elapsed time.Duration) (bool, int64, int64) {
+	localWindowsMu.Lock()
+	defer localWindowsMu.Unlock()
+	key := p.name + ":" + subject
+	w, ok := localWindows.Get(key)
+	if !ok {
+		w = &localWindow{index: index}
+		localWindows.Add(key, w)
+	}
+	switch {
+	case index == w.index+1:
+		w.index, w.prev, w.cur = index, w.cur, 0
+	case index != w.index:
+		w.index, w.prev, w.cur = index, 0, 0
+	}
+	window := time.Duration(p.Window) * time.Second
+	if slidingCount(w.cur, w.prev, window, elapsed)+1 > float64(p.Limit) {
+		return false, w.cur, w.prev
+	}
+	w.cur++
+	return true, w.cur, w.prev
+}
+
+func slidingCount(cur, prev int64, window, elapsed time.Duration) float64 {
+	return float64(prev)*float64(window-elapsed)/float64(window) + float64(cur)
+}
+
+func rateOutcome(limit int, window, elapsed time.Duration, allowed bool, cur, prev int64) rateResult {
+	r := rateResult{allowed: allowed, limit: limit, reset: window - elapsed}
+	r.remaining = limit - int(math.Ceil(slidingCount(cur, prev, window, elapsed)))
+	if r.remaining < 0 {
+		r.remaining = 0
+	}
+	if allowed {
+		return r
+	}
+	// 当前窗口内上一窗口的折算计数逐渐减少，计算何时能再放行一次；当前窗口已满则要等到下一窗口
+	free := float64(limit - 1)
+	if float64(cur) <= free {
+		at := time.Duration(float64(window) * (1 - (free-float64(cur))/float64(prev)))
+		r.retry = at - elapsed
+	} else {
+		r.retry = window - elapsed + time.Duration(float64(window)*(1-free/float64(cur)))
+	}
+	if r.retry < time.Second {
+		r.retry = time.Second
+	}
+	return r
+}
+
+func setRateHeaders(c *gin.Context, r rateResult) {
+	c.Header("RateLimit-Limit", strconv.Itoa(r.limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(r.remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(r.reset.Seconds()))))
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 请求ID响应头；上游（网关、负载均衡）传入时沿用，便于串联日志与审计记录
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// RequestID 为每个请求分配ID，写入上下文 request_id 和响应头
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err == nil {
+				id = hex.EncodeToString(b)
+			} else {
+				id = ""
+			}
+		}
+		if id != "" {
+			c.Set("request_id", id)
+			c.Header(RequestIDHeader, id)
+		}
+		c.Next()
+	}
+}
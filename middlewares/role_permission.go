@@ -2,52 +2,31 @@ package middlewares
 
 import (
 	"net/http"
+	"project/config"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 新建一个角色权限管理-这里函数输入是可变参数-可以传入多个角色
-func RolePermission(role_input ...string) gin.HandlerFunc { //双重校验-JWT和数据库
+// 权限校验-这里函数输入是可变参数-必须拥有全部权限；角色对应的权限保存在数据库中，由管理员维护
+func RequirePermission(perms ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// token := c.GetHeader("Authorization") // 这里的键是Authorization
-		// if token == "" {
-		// 	if ck, err := c.Cookie(utils.CookieName); err == nil {
-		// 		token = ck
-		// 	}
-		// }
-		// if token == "" {
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		// 	c.Abort() //中止
-		// 	return
-		// }
-		// username, role, expireTime,err := utils.ParseJWT(token) //不管什么用户我都让其通过-获取role角色
-		// if err != nil {
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		// 	c.Abort()
-		// 	return
-		// }
-		// 遍历可变参数，只要匹配任意一个角色就允许
 		role := c.GetString("role")
 		if role == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: role not found in context"})
 			c.Abort()
 			return
 		}
-		hasPermission := false
-		for _, allowedRole := range role_input {
-			if allowedRole == role {
-				hasPermission = true
-				break
-			}
-		}
-		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{"error": "The user's role permission denied"})
+		if !config.HasPermission(role, perms...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The user's role permission denied", "required_permissions": perms})
 			c.Abort()
 			return
 		}
+		if !mfaSatisfied(c, role) {
+			return
+		}
 		if exp, exists := c.Get("exp"); exists {
-			if time.Now().Unix() > exp.(int64) { //.unix是unix时间戳表示的时间数字
+			if e := exp.(int64); e > 0 && time.Now().Unix() > e { //.unix是unix时间戳表示的时间数字；个人访问令牌可以永不过期
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired,you need to login again"})
 				c.Abort()
 				return
@@ -57,29 +36,15 @@ func RolePermission(role_input ...string) gin.HandlerFunc { //双重校验-JWT
 	}
 }
 
-// 超级管理员权限
-func SuperAdminPermission() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role := c.GetString("role")
-		if role == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: role not found in context"})
-			c.Abort()
-			return
-		}
-		if role != "superadmin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "The user's role permission denied"})
-			c.Abort()
-			return
-		}
-		// 可选：添加额外的安全检查
-		// 检查token是否在有效期内
-		if exp, exists := c.Get("exp"); exists {
-			if time.Now().Unix() > exp.(int64) { //.unix是unix时间戳表示的时间数字
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired,you need to login again"})
-				c.Abort()
-				return
-			}
-		}
-		c.Next()
+// 管理类角色必须绑定两步验证后才能访问管理功能（兼容功能上线前签发的令牌、新晋升的管理员）
+func mfaSatisfied(c *gin.Context, role string) bool {
+	if !config.RoleRequiresMFA(role) {
+		return true
+	}
+	if c.GetBool("mfa_enabled") {
+		return true
 	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication enrollment required", "code": "mfa_enroll_required"})
+	c.Abort()
+	return false
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 审计动作
+const (
+	AuditPasswordChange      = "password.change"       // 用户自己修改密码
+	AuditPasswordResetIssue  = "password.reset.issue"  // 管理员签发重置令牌
+	AuditPasswordResetRedeem = "password.reset.redeem" // 用户使用重置令牌设置新密码
+	AuditAccountDelete       = "account.delete"        // 用户自助注销（进入冷静期）
+	AuditAccountRestore      = "account.restore"       // 冷静期内登录撤销注销
+	AuditAccountPurge        = "account.purge"         // 冷静期结束，彻底删除
+	AuditIdentityLink        = "identity.link"         // 绑定第三方身份
+	AuditIdentityUnlink      = "identity.unlink"       // 解绑第三方身份
+	AuditTokenCreate         = "token.create"          // 创建个人访问令牌
+	AuditTokenRevoke         = "token.revoke"          // 撤销个人访问令牌
+	AuditRoleCreate          = "role.create"           // 新建角色
+	AuditRoleUpdate          = "role.update"           // 修改角色权限
+	AuditRoleDelete          = "role.delete"           // 删除角色
+	AuditUserCreate          = "user.create"           // 管理员添加用户
+	AuditUserUpdate          = "user.update"           // 管理员修改用户信息
+	AuditUserDelete          = "user.delete"           // 管理员删除用户
+	AuditUserSuspend         = "user.suspend"          // 暂停或封禁用户
+	AuditUserUnsuspend       = "user.unsuspend"        // 解除暂停或封禁
+	AuditUserForceLogout     = "user.force_logout"     // 强制下线
+	AuditArticleDelete       = "article.delete"        // 删除文章（含删除他人文章）
+	AuditTerminalExec        = "terminal.exec"         // 在 Web 终端执行命令
+	AuditLogExport           = "audit.export"          // 导出审计日志
+	AuditUserRegister        = "user.register"         // 用户自行注册
+	AuditUserApprove         = "user.approve"          // 管理员通过注册审核
+	AuditUserReject          = "user.reject"           // 管理员拒绝注册（删除该用户）
+	AuditInviteCreate        = "invite.create"         // 生成邀请码
+	AuditInviteRevoke        = "invite.revoke"         // 作废邀请码
+	AuditStorageCheck        = "storage.check"         // 执行存储一致性检查（含修复）
+	AuditFileReadAny         = "file.read_any"         // 下载或预览其他用户的文件
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser    = "user"
+	AuditTargetRole    = "role"
+	AuditTargetArticle = "article"
+	AuditTargetInvite  = "invite"
+	AuditTargetStorage = "storage_check"
+	AuditTargetFile    = "file"
+)
+
+// ErrAuditAppendOnly 审计日志只能追加，不能修改或删除
+var ErrAuditAppendOnly = errors.New("audit logs are append-only")
+
+// AuditLog 审计日志：记录谁在什么时候对什么对象做了什么，以及变更前后的数据
+type AuditLog struct {
+	gorm.Model
+	ActorID    *uint  `gorm:"index"` // 操作者，未登录时为空
+	Action     string `gorm:"size:64;not null;index"`
+	TargetType string `gorm:"size:32;index:idx_audit_target"` // 被操作对象的类型，见 AuditTarget*
+	TargetID   *uint  `gorm:"index:idx_audit_target"`         // 被操作对象的ID
+	Before     string `gorm:"type:text"`                      // 变更前的数据（JSON）
+	After      string `gorm:"type:text"`                      // 变更后的数据（JSON）
+	IP         string `gorm:"size:64"`
+	UserAgent  string `gorm:"size:255"`
+	RequestID  string `gorm:"size:64;index"` // 与访问日志中的 request_id 对应
+	Detail     string `gorm:"type:text"`
+}
+
+func (AuditLog) TableName() string { return "audit_logs" }
+
+func (*AuditLog) BeforeUpdate(*gorm.DB) error { return ErrAuditAppendOnly }
+
+func (*AuditLog) BeforeDelete(*gorm.DB) error { return ErrAuditAppendOnly }
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Blob 按 SHA-256 寻址的文件内容，相同内容只在磁盘上保存一份；
+// RefCount 为引用它的 Files 记录数，降为 0 后由回收任务删除（回收中为 BlobCollecting）
+type Blob struct {
+	Hash     string `gorm:"primaryKey;size:64"`
+	Size     int64  `gorm:"not null"`
+	Path     string `gorm:"not null;size:500"` // 相对上传目录的路径
+	RefCount int64  `gorm:"not null;default:0;index"`
+	// 图片的尺寸、EXIF 与缩略图由后台任务在上传后生成，见 config/media.go
+	MediaStatus string `gorm:"size:16;not null;default:'';index"` // 空为待处理
+	Width       int    `gorm:"not null;default:0"`                // 按 EXIF 方向摆正后的宽高
+	Height      int    `gorm:"not null;default:0"`
+	Exif        string `gorm:"type:text"` // 常用 EXIF 字段的 JSON
+	HasGPS      bool   `gorm:"not null;default:false"`
+	Thumbs      string `gorm:"size:64"` // 已生成的缩略图边长，逗号分隔，如 128,320,800
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// BlobCollecting 回收中的内容的 RefCount：已确认没有引用，存储中的内容可能已被删除
+const BlobCollecting int64 = -1
+
+// 媒体处理状态
+const (
+	MediaPending = ""
+	MediaReady   = "ready"  // 已生成缩略图
+	MediaNone    = "none"   // 不是支持生成缩略图的图片
+	MediaFailed  = "failed" // 图片损坏或像素过多
+)
+
+func (Blob) TableName() string { return "blobs" }
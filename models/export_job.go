@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 导出任务状态
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired" // 压缩包超过保留时间已删除
+)
+
+// ExportJob 个人数据导出任务，压缩包保存在上传目录的 exports 子目录下
+type ExportJob struct {
+	gorm.Model
+	User        *Users `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID      uint   `gorm:"not null;index"`
+	Status      string `gorm:"size:16;not null;index"`
+	FilePath    string `gorm:"size:500"` // 相对上传目录的路径
+	FileSize    int64  `gorm:"not null;default:0"`
+	Error       string `gorm:"size:255"`
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // 压缩包保留截止时间
+}
+
+func (ExportJob) TableName() string { return "export_jobs" }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,14 +12,27 @@ type Files struct {
 	UserID     uint   `json:"user_id" gorm:"not null;index"`                 // 上传用户ID
 	Filename   string `gorm:"not null;size:255"`                             // 原始文件名
 	FileType   string `gorm:"not null;size:50"`                              // MIME 类型或扩展名
-	FilePath   string `gorm:"not null;size:500"`                             // 存储路径（本地路径 or URL）
+	FilePath   string `gorm:"not null;size:500"`                             // 存储路径（本地路径 or URL），去重后为 blobs 下的内容路径
 	FileSize   int64  `gorm:"not null"`
-	Downloads  uint   `gorm:"default:0"` // 下载数-配合redis缓存
-	Hash       string `gorm:"size:64"`   // 移除uniqueIndex，允许重复文件
+	Downloads  uint   `gorm:"default:0"`     // 下载数-配合redis缓存
+	Hash       string `gorm:"size:64;index"` // 内容的 SHA-256，对应 blobs 表；多条记录可引用同一内容
 	FileInfo   string
+	Folder     *Folder    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	FolderID   *uint      `json:"folder_id" gorm:"index"`                               // 所在的虚拟文件夹，为空表示根目录
+	TrashedAt  *time.Time `json:"trashed_at" gorm:"index"`                              // 移入回收站的时间，到期后彻底删除
+	ScanStatus string     `json:"scan_status" gorm:"size:16;not null;default:'';index"` // 上传扫描状态，空为扫描上线前上传的文件
+	ScanDetail string     `json:"scan_detail" gorm:"size:255"`                          // 隔离原因，如病毒名；待扫描时为上次扫描失败的原因
+	ScanTries  int        `json:"-" gorm:"not null;default:0"`                          // 待扫描文件重新扫描失败的次数
 	// 这里上传时间就是UpdatedAt
 }
 
+// 上传扫描状态；pending 与 quarantined 的文件不能下载
+const (
+	ScanClean       = "clean"
+	ScanPending     = "pending"     // 扫描器暂不可用，由后台任务重新扫描
+	ScanQuarantined = "quarantined" // 重新扫描时发现问题
+)
+
 func (Files) TableName() string {
 	return "files"
 }
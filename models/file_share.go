@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FileShare 文件分享链接：/s/<slug> 无需登录即可下载，可设置访问密码、有效期和下载次数上限
+type FileShare struct {
+	gorm.Model
+	File         *Files     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	FileID       uint       `gorm:"not null;index"`
+	User         *Users     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID       uint       `gorm:"not null;index"` // 分享者
+	Slug         string     `gorm:"size:32;not null;uniqueIndex"`
+	PasswordHash string     `gorm:"size:100"`           // bcrypt，为空表示不需要密码
+	MaxDownloads int        `gorm:"not null;default:0"` // 0 表示不限次数
+	Downloads    int        `gorm:"not null;default:0"` // 通过该链接下载的次数
+	ExpiresAt    *time.Time `gorm:"index"`              // 为空表示永不过期
+	RevokedAt    *time.Time
+}
+
+func (FileShare) TableName() string { return "file_shares" }
+
+// Usable 链接是否仍可下载
+func (s *FileShare) Usable(now time.Time) bool {
+	if s.RevokedAt != nil || (s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)) {
+		return false
+	}
+	return s.MaxDownloads == 0 || s.Downloads < s.MaxDownloads
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Folder 文件管理中的虚拟文件夹，只影响展示与筛选，不改变内容的存储位置；
+// ParentID 为空表示位于根目录，删除文件夹时子文件夹级联删除，其中的文件移入回收站
+type Folder struct {
+	ID        uint    `gorm:"primaryKey"`
+	User      *Users  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uint    `gorm:"not null;index"`
+	Parent    *Folder `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ParentID  *uint   `gorm:"index"`
+	Name      string  `gorm:"not null;size:100"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (Folder) TableName() string { return "folders" }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InviteCodePrefix 邀请码前缀，便于用户和管理员辨认
+const InviteCodePrefix = "inv_"
+
+// InviteCode 管理员生成的注册邀请码，只保存哈希
+type InviteCode struct {
+	gorm.Model
+	CodeHash    string     `gorm:"size:64;not null;uniqueIndex"` // SHA-256(code)
+	Prefix      string     `gorm:"size:16;not null"`             // 邀请码开头几位，便于辨认
+	Note        string     `gorm:"size:255"`                     // 备注，例如发给谁
+	CreatedByID uint       `gorm:"not null;index"`               // 生成的管理员
+	MaxUses     int        `gorm:"not null;default:0"`           // 可使用次数，0 表示不限
+	UsedCount   int        `gorm:"not null;default:0"`
+	ExpiresAt   *time.Time `gorm:"index"` // 为空表示永不过期
+	RevokedAt   *time.Time
+}
+
+func (InviteCode) TableName() string { return "invite_codes" }
+
+// Usable 未作废、未过期且仍有剩余次数
+func (i *InviteCode) Usable(now time.Time) bool {
+	return i.RevokedAt == nil &&
+		(i.ExpiresAt == nil || now.Before(*i.ExpiresAt)) &&
+		(i.MaxUses == 0 || i.UsedCount < i.MaxUses)
+}
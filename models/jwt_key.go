@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JWTKey 管理员轮换生成的签名密钥，配置文件里的初始密钥不入库
+type JWTKey struct {
+	gorm.Model
+	Kid       string     `gorm:"size:64;uniqueIndex;not null"`
+	Secret    string     `gorm:"size:128;not null"` // 用 jwt.encryptionKey 加密的 HMAC 密钥，早期记录为明文十六进制
+	RetiredAt *time.Time `gorm:"index"`             // 为空表示当前签发密钥
+}
+
+func (JWTKey) TableName() string { return "jwt_keys" }
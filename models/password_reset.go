@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken 管理员签发的一次性密码重置令牌，只保存哈希
+type PasswordResetToken struct {
+	gorm.Model
+	User        *Users     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID      uint       `gorm:"not null;index"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex"` // SHA-256(token)
+	CreatedByID uint       `gorm:"not null"`                     // 签发的管理员
+	ExpiresAt   time.Time  `gorm:"not null"`
+	UsedAt      *time.Time // 使用时间，为空表示未使用
+}
+
+func (PasswordResetToken) TableName() string { return "password_reset_tokens" }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PATPrefix 个人访问令牌前缀，认证中间件据此区分访问令牌与登录JWT
+const PATPrefix = "gwp_"
+
+// PATScopes 个人访问令牌可选的权限范围，按接口分组；write 包含 read
+var PATScopes = []string{
+	"articles:read", "articles:write",
+	"collections:read", "collections:write",
+	"files:read", "files:write",
+	"games:read", "games:write",
+	"rates:read", "rates:write",
+	"translate:read", "translate:write",
+	"weather:read",
+}
+
+// ValidPATScope 判断权限范围是否合法
+func ValidPATScope(scope string) bool {
+	for _, s := range PATScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken 用户自行创建的访问令牌，用于脚本调用 /api，只保存哈希
+type PersonalAccessToken struct {
+	gorm.Model
+	User       *Users     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID     uint       `gorm:"not null;index"`
+	Name       string     `gorm:"size:64;not null"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex"` // SHA-256(token)
+	Prefix     string     `gorm:"size:16;not null"`             // 令牌开头几位，便于用户辨认
+	Scopes     string     `gorm:"size:255;not null"`            // 逗号分隔
+	ExpiresAt  *time.Time `gorm:"index"`                        // 为空表示永不过期
+	LastUsedAt *time.Time
+	LastUsedIP string     `gorm:"size:64"`
+	RevokedAt  *time.Time `gorm:"index"`
+}
+
+func (PersonalAccessToken) TableName() string { return "personal_access_tokens" }
+
+// ScopeList 权限范围列表
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// Allows 是否具有某个分组的读或写权限，写权限包含读权限
+func (t *PersonalAccessToken) Allows(group string, write bool) bool {
+	for _, s := range t.ScopeList() {
+		if s == group+":write" || (!write && s == group+":read") {
+			return true
+		}
+	}
+	return false
+}
+
+// Active 未撤销且未过期
+func (t *PersonalAccessToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode 两步验证恢复码，只保存哈希，每个只能使用一次
+type RecoveryCode struct {
+	gorm.Model
+	User     *Users     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID   uint       `gorm:"not null;index"`
+	CodeHash string     `gorm:"size:64;not null;index"` // SHA-256(code)
+	UsedAt   *time.Time // 使用时间，为空表示仍可用
+}
+
+func (RecoveryCode) TableName() string { return "recovery_codes" }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken 长期刷新令牌，只保存哈希；每次刷新都会轮换出同一家族的新令牌
+type RefreshToken struct {
+	gorm.Model
+	User         *Users     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID       uint       `gorm:"not null;index"`
+	TokenHash    string     `gorm:"size:64;not null;uniqueIndex"` // SHA-256(token)
+	FamilyID     string     `gorm:"size:64;not null;index"`       // 同一次登录轮换出的令牌共享家族ID
+	UserAgent    string     `gorm:"size:255"`
+	IP           string     `gorm:"size:64"`
+	ExpiresAt    time.Time  `gorm:"not null;index"`
+	RevokedAt    *time.Time `gorm:"index"` // 被轮换或注销的时间
+	ReplacedByID *uint      // 轮换后的新令牌
+}
+
+func (RefreshToken) TableName() string { return "refresh_tokens" }
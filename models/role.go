@@ -0,0 +1,72 @@
+package models
+
+// 权限常量：代码中按权限而不是角色名判断，角色与权限的对应关系保存在数据库中，可由管理员修改
+const (
+	PermDashboardView    = "dashboard.view"    // 管理后台与统计数据
+	PermUsersRead        = "users.read"        // 查看用户列表
+	PermUsersManage      = "users.manage"      // 新增、修改、删除、暂停用户，强制下线，签发密码重置
+	PermRolesManage      = "roles.manage"      // 管理角色及其权限
+	PermArticlesModerate = "articles.moderate" // 删除任意用户的文章
+	PermFilesReadAny     = "files.read_any"    // 下载任意用户的文件
+	PermTerminalExec     = "terminal.exec"     // 使用 Web 终端
+	PermKeysManage       = "keys.manage"       // 查看与轮换 JWT 签名密钥
+	PermAuditRead        = "audit.read"        // 查询与导出审计日志
+	PermStorageManage    = "storage.manage"    // 检查并修复上传文件的存储一致性
+)
+
+// PermissionInfo 权限说明，供管理后台展示
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 全部权限
+var Permissions = []PermissionInfo{
+	{PermDashboardView, "查看管理后台与统计数据"},
+	{PermUsersRead, "查看用户列表"},
+	{PermUsersManage, "新增、修改、删除、暂停用户，强制下线，签发密码重置"},
+	{PermRolesManage, "管理角色及其权限"},
+	{PermArticlesModerate, "删除任意用户的文章"},
+	{PermFilesReadAny, "下载任意用户的文件"},
+	{PermTerminalExec, "使用 Web 终端"},
+	{PermKeysManage, "查看与轮换 JWT 签名密钥"},
+	{PermAuditRead, "查询与导出审计日志"},
+	{PermStorageManage, "检查并修复上传文件的存储一致性"},
+}
+
+// ValidPermission 判断权限是否存在
+func ValidPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRolePermissions 内置角色的初始权限，与引入权限模型之前三个固定角色的能力一致
+// （管理员原先只能下载、删除自己的文件和文章）；超级管理员始终拥有全部权限
+var DefaultRolePermissions = map[string][]string{
+	RoleNormal: {},
+	RoleAdmin:  {PermDashboardView, PermUsersRead, PermUsersManage},
+}
+
+// Role 角色：一组权限，Users.Role 保存角色名
+type Role struct {
+	ID          uint             `gorm:"primarykey" json:"id"`
+	Name        string           `gorm:"type:varchar(16);not null;uniqueIndex" json:"name"`
+	Description string           `gorm:"size:255" json:"description"`
+	Builtin     bool             `gorm:"not null;default:false" json:"builtin"` // 内置角色不能删除
+	Permissions []RolePermission `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (Role) TableName() string { return "roles" }
+
+// RolePermission 角色拥有的一项权限
+type RolePermission struct {
+	ID         uint   `gorm:"primarykey"`
+	RoleID     uint   `gorm:"not null;uniqueIndex:idx_role_permission"`
+	Permission string `gorm:"size:64;not null;uniqueIndex:idx_role_permission"`
+}
+
+func (RolePermission) TableName() string { return "role_permissions" }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// 存储检查状态
+const (
+	StorageCheckRunning = "running"
+	StorageCheckDone    = "done"
+	StorageCheckFailed  = "failed"
+)
+
+// 存储检查的触发方式
+const (
+	StorageCheckManual   = "manual"   // 管理员在后台手动执行
+	StorageCheckSchedule = "schedule" // 按 upload.checkIntervalHours 定时执行
+)
+
+// 存储检查发现的问题类型
+const (
+	IssueOrphan    = "orphan"     // 磁盘上没有任何记录引用的文件
+	IssueStalePart = "stale_part" // 长时间未完成的 .part 临时文件
+	IssueMissing   = "missing"    // 记录引用的内容在存储后端中不存在
+	IssueMismatch  = "mismatch"   // 内容的大小或哈希与记录不符
+)
+
+// StorageCheck 一次存储一致性检查（files/blobs 表与上传目录、存储后端的对账）及其结果
+type StorageCheck struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Trigger    string     `gorm:"size:16;not null" json:"trigger"` // manual / schedule
+	ActorID    *uint      `json:"actor_id"`                        // 手动触发的管理员
+	DryRun     bool       `gorm:"not null" json:"dry_run"`         // 只报告，不修复
+	VerifyHash bool       `gorm:"not null" json:"verify_hash"`     // 重新计算内容的 SHA-256
+	Status     string     `gorm:"size:16;not null;index" json:"status"`
+	Scanned    int        `gorm:"not null;default:0" json:"scanned"` // 扫描的磁盘文件数
+	Checked    int        `gorm:"not null;default:0" json:"checked"` // 核对的 blobs 与旧文件记录数
+	Orphans    int        `gorm:"not null;default:0" json:"orphans"`
+	StaleParts int        `gorm:"not null;default:0" json:"stale_parts"`
+	Missing    int        `gorm:"not null;default:0" json:"missing"`
+	Mismatches int        `gorm:"not null;default:0" json:"mismatches"`
+	Repaired   int        `gorm:"not null;default:0" json:"repaired"`
+	Failed     int        `gorm:"not null;default:0" json:"failed"`
+	Issues     string     `gorm:"type:longtext" json:"-"` // 问题明细的 JSON，条数有上限
+	Error      string     `gorm:"size:255" json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (StorageCheck) TableName() string { return "storage_checks" }
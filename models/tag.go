@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Tag 用户自定义的文件标签，同一用户下名称唯一
+type Tag struct {
+	ID        uint   `gorm:"primaryKey"`
+	User      *Users `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_tag_user_name"`
+	Name      string `gorm:"not null;size:32;uniqueIndex:idx_tag_user_name"`
+	CreatedAt time.Time
+}
+
+func (Tag) TableName() string { return "tags" }
+
+// FileTag 文件与标签的关联
+type FileTag struct {
+	File   *Files `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	FileID uint   `gorm:"primaryKey"`
+	Tag    *Tag   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TagID  uint   `gorm:"primaryKey;index"`
+}
+
+func (FileTag) TableName() string { return "file_tags" }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadSession 分片上传会话：分片按顺序写入上传目录下的 .part 临时文件，全部到齐后校验并转为 Files 记录
+type UploadSession struct {
+	gorm.Model
+	User      *Users    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uint      `gorm:"not null;index"`
+	Filename  string    `gorm:"not null;size:255"`
+	FileSize  int64     `gorm:"not null"`           // 声明的文件总大小，初始化时计入配额
+	ChunkSize int64     `gorm:"not null"`           // 单个分片的最大字节数
+	Offset    int64     `gorm:"not null;default:0"` // 已写入的字节数，下一个分片必须从这里开始
+	SHA256    string    `gorm:"size:64"`            // 客户端声明的 SHA-256，完成时校验，为空则只记录
+	TempPath  string    `gorm:"not null;size:500"`  // 相对上传目录的 .part 临时文件
+	FileInfo  string    // 文件描述
+	ExpiresAt time.Time `gorm:"not null;index"` // 超过该时间未继续上传则被清理，每个分片都会顺延
+}
+
+func (UploadSession) TableName() string { return "upload_sessions" }
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 
 // 用户角色常量
@@ -10,13 +14,45 @@ const (
     RoleSuperAdmin = "superadmin"  // 超级管理员
 )
 
+// 用户状态常量（历史数据中的空字符串视为 active）
+const (
+	StatusActive    = "active"    // 正常
+	StatusSuspended = "suspended" // 暂停：到 SuspendedUntil 自动恢复，为空表示无限期
+	StatusBanned    = "banned"    // 封禁：永久不可登录
+	StatusPending   = "pending"   // 待审核：审核注册方式下新注册的用户，管理员通过前不可登录
+)
+
 // 用户数据
 type Users struct {
 	gorm.Model        //内嵌的一个模型 包括基础的ID 创建、更新、删除的时间戳
 	Username   string `gorm:"size:64;uniqueIndex"`
 	Password   string
-	Role string  `gorm:"type:varchar(16);not null;default:'user';check:role in ('user','admin','superadmin')"` // 用户角色
-	Status string  	// 用户状态-可随意填写
+	Role string  `gorm:"type:varchar(16);not null;default:'user'"` // 用户角色，对应 roles 表中的角色名
+	Status string  	// 用户状态：active/suspended/banned/pending
+	StatusReason   string     `gorm:"size:255"` // 暂停或封禁的原因，登录时展示给用户
+	SuspendedUntil *time.Time // 暂停截止时间
+	TokenVersion uint `gorm:"not null;default:0"` // 令牌版本，递增后该用户已签发的访问令牌全部失效
+	TOTPSecret   string `gorm:"size:64" json:"-"` // 两步验证密钥（base32），不进入用户缓存
+	TOTPEnabled  bool   `gorm:"not null;default:false"` // 是否已完成两步验证绑定
+	DeletionScheduledAt *time.Time `gorm:"index"` // 用户自助注销后计划彻底删除的时间，之前登录可撤销
+	InviteCodeID *uint `gorm:"index"` // 注册时使用的邀请码
+}
+
+// PendingDeletion 用户已自助注销但仍在冷静期内，可以通过登录恢复
+func (u *Users) PendingDeletion(now time.Time) bool {
+	return u.DeletedAt.Valid && u.DeletionScheduledAt != nil && now.Before(*u.DeletionScheduledAt)
+}
+
+// IsBlocked 判断用户在 now 时刻是否被禁止使用系统：封禁和待审核一直生效，暂停到期后自动解除
+func (u *Users) IsBlocked(now time.Time) bool {
+	switch u.Status {
+	case StatusBanned, StatusPending:
+		return true
+	case StatusSuspended:
+		return u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil)
+	default:
+		return false
+	}
 }
 
 // 显示使用名称
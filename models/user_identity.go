@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 第三方身份（OIDC）与本地用户的绑定，同一身份只能绑定一个用户
+type UserIdentity struct {
+	gorm.Model
+	User        *Users `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID      uint   `gorm:"not null;index"`
+	Provider    string `gorm:"size:32;not null;uniqueIndex:idx_provider_subject"`
+	Subject     string `gorm:"size:255;not null;uniqueIndex:idx_provider_subject"` // ID Token 中的 sub
+	Email       string `gorm:"size:255"`
+	LastLoginAt *time.Time
+}
+
+func (UserIdentity) TableName() string { return "user_identities" }
@@ -4,13 +4,14 @@ package router
 import (
 	"project/controllers"
 	"project/middlewares"
+	"project/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
 	r := gin.New()
-	r.Use(middlewares.GinLogger(), middlewares.GinRecovery()) //middlewares.GinLogger(),
+	r.Use(middlewares.RequestID(), middlewares.GinLogger(), middlewares.GinRecovery()) //middlewares.GinLogger(),
 	mountSwagger(r)
 
 	//加载数据
@@ -24,10 +25,27 @@ func SetupRouter() *gin.Engine {
 	r.GET("/auth/login", func(c *gin.Context) { c.HTML(200, "login.html", nil) })
 	r.GET("/auth/register", func(c *gin.Context) { c.HTML(200, "register.html", nil) })
 	r.GET("/auth/logout", func(c *gin.Context) { c.HTML(200, "logout.html", nil) }) // 注销页面
-	auth := r.Group("/api/auth")                                                    //给出路由组的路径
-	auth.POST("/login", controllers.Login)
-	auth.POST("/register", controllers.Register)
+	r.GET("/auth/password/reset", func(c *gin.Context) { c.HTML(200, "password_reset.html", nil) })
+	r.GET("/exports/download/:token", controllers.DownloadExport) // 导出压缩包的限时下载链接
+	// 文件分享链接，无需登录
+	r.GET("/s/:slug", controllers.DownloadShare)
+	r.GET("/s/:slug/info", controllers.ShareInfo)
+	r.POST("/s/:slug/unlock", middlewares.RateLimit("login"), controllers.UnlockShare)
+	auth := r.Group("/api/auth") //给出路由组的路径
+	// 限流策略见 config.yaml 的 rateLimit.policies
+	loginLimit := middlewares.RateLimit("login")
+	auth.POST("/login", loginLimit, controllers.Login)
+	auth.POST("/register", middlewares.RateLimit("register"), controllers.Register)
+	auth.GET("/registration", controllers.RegistrationInfo) // 注册方式与密码规则
 	auth.POST("/logout", controllers.Logout)
+	auth.POST("/refresh", controllers.RefreshToken)                           // 刷新令牌换取新的访问令牌
+	auth.POST("/login/2fa", loginLimit, controllers.LoginMFA)                 // 登录第二步：两步验证
+	auth.POST("/2fa/enroll", loginLimit, controllers.EnrollMFA)               // 管理员登录时强制绑定两步验证
+	auth.POST("/password/reset", loginLimit, controllers.RedeemPasswordReset) // 使用管理员签发的重置令牌设置新密码
+	auth.GET("/csrf", controllers.GetCSRFToken)                               // 页面发起写请求前获取 CSRF 令牌
+	auth.GET("/oidc/providers", controllers.OIDCProviders)                    // 第三方登录
+	auth.GET("/oidc/:provider/login", controllers.OIDCLogin)
+	auth.GET("/oidc/:provider/callback", controllers.OIDCCallback)
 
 	// 受保护的页面端
 	page := r.Group("/page", middlewares.AuthMiddleWare()) //也是需要登录
@@ -69,14 +87,39 @@ func SetupRouter() *gin.Engine {
 	}
 
 	// 受保护的 API（数据接口，需要登录）
-	api := r.Group("/api", middlewares.AuthMiddleWare())
+	api := r.Group("/api", middlewares.AuthMiddleWare(), middlewares.CSRFProtect(), middlewares.RateLimit("api"))
 	{
-		api.GET("/ws/terminal", controllers.TerminalWS)
-		api.GET("/ws/terminal/info", controllers.GetTerminalInfo)
+		interactionLimit := middlewares.RateLimit("interaction") // 防刷：评论、转发、创建收藏夹
+		// 旧的终端地址，与 /api/superadmin/terminal 同样需要终端权限（并校验两步验证）
+		api.GET("/ws/terminal", middlewares.RequirePermission(models.PermTerminalExec), controllers.TerminalWS)
+		api.GET("/ws/terminal/info", middlewares.RequirePermission(models.PermTerminalExec), controllers.GetTerminalInfo)
 		api.GET("/proxy/image", controllers.ProxyImage)
 
 		// 基本信息获取模块
 		api.GET("/me", controllers.GetUserName) //用户名称
+		// 登录会话管理
+		api.GET("/me/sessions", controllers.ListMySessions)
+		api.DELETE("/me/sessions/:id", controllers.RevokeMySession)
+		api.POST("/me/sessions/revoke_all", controllers.RevokeAllMySessions) // 退出所有设备
+		// 两步验证
+		api.GET("/me/2fa", controllers.GetMyMFA)
+		api.POST("/me/2fa/setup", controllers.SetupMyMFA)
+		api.POST("/me/2fa/enable", controllers.EnableMyMFA)
+		api.POST("/me/2fa/disable", controllers.DisableMyMFA)
+		api.POST("/me/2fa/recovery_codes", controllers.RegenerateMyRecoveryCodes) // 重新生成恢复码
+		api.PUT("/me/password", controllers.ChangeMyPassword)                     // 修改密码
+		api.DELETE("/me", controllers.DeleteUser)                                 // 注销账号（冷静期后彻底删除）
+		api.POST("/me/exports", controllers.CreateMyExport)                       // 申请导出个人数据
+		api.GET("/me/exports", controllers.ListMyExports)
+		api.GET("/me/exports/:id", controllers.GetMyExport)
+		// 第三方身份绑定
+		api.GET("/me/identities", controllers.ListMyIdentities)
+		api.GET("/me/identities/:provider/link", controllers.LinkMyIdentity)
+		api.DELETE("/me/identities/:id", controllers.UnlinkMyIdentity)
+		// 个人访问令牌（脚本调用）
+		api.GET("/me/tokens", controllers.ListMyTokens)
+		api.POST("/me/tokens", controllers.CreateMyToken)
+		api.DELETE("/me/tokens/:id", controllers.RevokeMyToken)
 		api.GET("/ad", controllers.Get_advertisement)
 
 		// 汇率模块
@@ -96,7 +139,7 @@ func SetupRouter() *gin.Engine {
 		api.POST("/game/guess", controllers.GameGuess)
 		api.POST("/game/reset", controllers.GameGuess_Reset)
 		api.GET("/game/leaderboards", controllers.GameLeaderboards)
-		api.GET("/game/leaderboard/me", controllers.GameLeaderboardMe) //获取个人排名和成绩-可以针对任何游戏
+		api.GET("/game/leaderboard/me", middlewares.RateLimit("leaderboard", "leaderboard_global"), controllers.GameLeaderboardMe) //获取个人排名和成绩-可以针对任何游戏
 		// 地图游戏模块
 		api.POST("/game/map/start", controllers.GameMapStart)       // 开始地图游戏
 		api.POST("/game/map/complete", controllers.GameMapComplete) // 完成地图游戏
@@ -105,17 +148,17 @@ func SetupRouter() *gin.Engine {
 		// 2048游戏模块
 		api.POST("/game/2048/save", controllers.Game2048SaveScore) // 保存2048游戏分数
 		//文章操作模块
-		api.GET("/articles", controllers.Get_All_Articles)                // 获取所有文章
-		api.POST("/create_articles", controllers.CreateArticle)           // 创建文章
-		api.PUT("/update_articles/:id", controllers.UpdateArticle)        // 更新文章
-		api.DELETE("/articles/:id", controllers.DeleteArticle)            // 删除文章
-		api.GET("/articles/me", controllers.GetMyArticles)                // 获取我的文章列表
-		api.POST("/articles/:article_id/like", controllers.ToggleLike)    // 点赞/取消点赞
-		api.POST("/comments", controllers.CreateComment)                  // 创建评论
-		api.GET("/articles/:id/comments", controllers.GetArticleComments) // 获取文章评论
+		api.GET("/articles", controllers.Get_All_Articles)                 // 获取所有文章
+		api.POST("/create_articles", controllers.CreateArticle)            // 创建文章
+		api.PUT("/update_articles/:id", controllers.UpdateArticle)         // 更新文章
+		api.DELETE("/articles/:id", controllers.DeleteArticle)             // 删除文章
+		api.GET("/articles/me", controllers.GetMyArticles)                 // 获取我的文章列表
+		api.POST("/articles/:article_id/like", controllers.ToggleLike)     // 点赞/取消点赞
+		api.POST("/comments", interactionLimit, controllers.CreateComment) // 创建评论
+		api.GET("/articles/:id/comments", controllers.GetArticleComments)  // 获取文章评论
 
 		// 翻译功能模块
-		api.POST("/translate", controllers.TranslateText)
+		api.POST("/translate", middlewares.RateLimit("translate", "translate_global"), controllers.TranslateText)
 		api.GET("/translate/languages", controllers.GetSupportedLanguages) //返给前端指定的翻译信息
 		// 翻译历史记录模块
 		api.GET("/translate/history", controllers.GetTranslationHistory)
@@ -126,14 +169,41 @@ func SetupRouter() *gin.Engine {
 		api.POST("/files/upload", controllers.UploadFile)
 		api.GET("/files/:id", controllers.DownloadFile) // Get只需要获得文件id即可
 		api.DELETE("/files/:id", controllers.DeleteFile)
+		api.GET("/files/:id/thumbnail", controllers.GetThumbnail) // 图片缩略图
+		api.PATCH("/files/:id", controllers.UpdateFile)           // 重命名或移动到其他文件夹
+		api.PUT("/files/:id/tags", controllers.SetFileTags)
+		// 文件夹、标签与回收站
+		api.GET("/files/folders", controllers.ListFolders)
+		api.POST("/files/folders", controllers.CreateFolder)
+		api.PATCH("/files/folders/:id", controllers.UpdateFolder)
+		api.DELETE("/files/folders/:id", controllers.DeleteFolder)
+		api.GET("/files/zip", middlewares.RateLimit("archive"), controllers.DownloadZip)
+		api.POST("/files/extract", middlewares.RateLimit("archive"), controllers.ExtractZip)
+		api.GET("/files/tags", controllers.ListTags)
+		api.DELETE("/files/tags/:id", controllers.DeleteTag)
+		api.GET("/files/trash", controllers.ListTrash)
+		api.DELETE("/files/trash", controllers.EmptyTrash)
+		api.POST("/files/trash/:id/restore", controllers.RestoreFile)
+		api.DELETE("/files/trash/:id", controllers.PurgeTrashedFile)
 		api.GET("/files/lists", controllers.ListMyFiles)
+		// 分片上传（可断点续传）
+		api.POST("/files/uploads", controllers.CreateUpload)
+		api.GET("/files/uploads", controllers.ListUploads)
+		api.GET("/files/uploads/:id", controllers.GetUpload)
+		api.PUT("/files/uploads/:id", controllers.UploadChunk)
+		api.POST("/files/uploads/:id/complete", controllers.CompleteUpload)
+		api.DELETE("/files/uploads/:id", controllers.AbortUpload)
+		// 分享链接
+		api.POST("/files/:id/shares", controllers.CreateFileShare)
+		api.GET("/files/shares", controllers.ListFileShares)
+		api.DELETE("/files/shares/:id", controllers.RevokeFileShare)
 
 		// 计算器模块
 		api.POST("/calculator/calculate", controllers.Calculate)
 
 		collections := api.Group("/collections")
 		{
-			collections.POST("", controllers.CreateMycollection)
+			collections.POST("", interactionLimit, controllers.CreateMycollection)
 			collections.GET("/all", controllers.ListMyCollections)
 			collections.GET("/all_items", controllers.ListMyCollectionsWithItems)
 			collections.POST("/item", controllers.AddArticleToMyCollection)
@@ -141,31 +211,59 @@ func SetupRouter() *gin.Engine {
 			collections.DELETE("/:collectionId", controllers.DeleteMyCollection)
 		}
 	}
-	// 超级管理员系统
-	admin := r.Group("/admin", middlewares.AuthMiddleWare(), middlewares.RolePermission("admin", "superadmin")) //给定用户的身份登记
+	// 管理后台：按权限而不是角色名放行，角色与权限的对应关系见 /api/dashboard/roles
+	admin := r.Group("/admin", middlewares.AuthMiddleWare())
 	{
-		admin.GET("/dashboard", func(c *gin.Context) { c.HTML(200, "dashboard.html", nil) })
-		admin.GET("/users", func(c *gin.Context) { c.HTML(200, "admin_users.html", nil) })
-		superadminPage := admin.Group("/superadmin", middlewares.RolePermission("superadmin"))
-		{
-			superadminPage.GET("/terminal", func(c *gin.Context) { c.HTML(200, "terminal.html", nil) })
-		}
+		admin.GET("/dashboard", middlewares.RequirePermission(models.PermDashboardView), func(c *gin.Context) { c.HTML(200, "dashboard.html", nil) })
+		admin.GET("/users", middlewares.RequirePermission(models.PermUsersRead), func(c *gin.Context) { c.HTML(200, "admin_users.html", nil) })
+		admin.GET("/superadmin/terminal", middlewares.RequirePermission(models.PermTerminalExec), func(c *gin.Context) { c.HTML(200, "terminal.html", nil) })
 	}
-	adminDashboard := api.Group("/dashboard", middlewares.RolePermission("admin", "superadmin"))
+	adminDashboard := api.Group("/dashboard")
 	{
-		adminDashboard.GET("/total", controllers.GetDashboardTotalData)
-		adminDashboard.GET("/add", controllers.GetDashboardAdd)
-		adminDashboard.POST("/curve", controllers.GetDashboardCurveData)
-		adminDashboard.GET("/time/sse", controllers.GetDashboardTimeInfo)
-		adminDashboard.GET("/users", controllers.GetUserList)
-		adminDashboard.POST("/user", controllers.AddUser)
-		adminDashboard.PUT("/user/:id", controllers.UpdateUser)
-		adminDashboard.DELETE("/user/:id", controllers.DeleteUserFromDashboard)
-		superadmin := api.Group("/superadmin", middlewares.RolePermission("superadmin"))
-		{
-			superadmin.GET("/terminal", controllers.TerminalWS)
-			superadmin.GET("/terminal/info", controllers.GetTerminalInfo)
-		}
+		stats := adminDashboard.Group("", middlewares.RequirePermission(models.PermDashboardView))
+		stats.GET("/total", controllers.GetDashboardTotalData)
+		stats.GET("/add", controllers.GetDashboardAdd)
+		stats.POST("/curve", controllers.GetDashboardCurveData)
+		stats.GET("/time/sse", controllers.GetDashboardTimeInfo)
+		adminDashboard.GET("/users", middlewares.RequirePermission(models.PermUsersRead), controllers.GetUserList)
+		users := adminDashboard.Group("/user", middlewares.RequirePermission(models.PermUsersManage))
+		users.POST("", controllers.AddUser)
+		users.PUT("/:id", controllers.UpdateUser)
+		users.DELETE("/:id", controllers.DeleteUserFromDashboard)
+		users.POST("/:id/logout", controllers.ForceLogoutUser) // 强制下线
+		users.POST("/:id/suspend", controllers.SuspendUser)    // 暂停/封禁
+		users.POST("/:id/unsuspend", controllers.UnsuspendUser)
+		users.POST("/:id/password_reset", controllers.IssuePasswordReset) // 签发密码重置令牌
+		users.POST("/:id/approve", controllers.ApproveUser)               // 注册审核：待审核列表见 GET /users?status=pending
+		users.POST("/:id/reject", controllers.RejectUser)
+		// 注册邀请码
+		invites := adminDashboard.Group("/invites", middlewares.RequirePermission(models.PermUsersManage))
+		invites.GET("", controllers.ListInviteCodes)
+		invites.POST("", controllers.CreateInviteCode)
+		invites.DELETE("/:id", controllers.RevokeInviteCode)
+		// 角色与权限管理
+		roles := adminDashboard.Group("", middlewares.RequirePermission(models.PermRolesManage))
+		roles.GET("/permissions", controllers.ListPermissions)
+		roles.GET("/roles", controllers.ListRoles)
+		roles.POST("/roles", controllers.CreateRole)
+		roles.PUT("/roles/:name", controllers.UpdateRole)
+		roles.DELETE("/roles/:name", controllers.DeleteRole)
+		// 审计日志
+		audit := adminDashboard.Group("/audit", middlewares.RequirePermission(models.PermAuditRead))
+		audit.GET("", controllers.ListAuditLogs)
+		audit.GET("/export", controllers.ExportAuditLogs) // CSV
+		// 存储一致性检查
+		storageChecks := adminDashboard.Group("/storage/checks", middlewares.RequirePermission(models.PermStorageManage))
+		storageChecks.GET("", controllers.ListStorageChecks)
+		storageChecks.POST("", controllers.RunStorageCheck)
+		storageChecks.GET("/:id", controllers.GetStorageCheck)
+	}
+	superadmin := api.Group("/superadmin")
+	{
+		superadmin.GET("/terminal", middlewares.RequirePermission(models.PermTerminalExec), controllers.TerminalWS)
+		superadmin.GET("/terminal/info", middlewares.RequirePermission(models.PermTerminalExec), controllers.GetTerminalInfo)
+		superadmin.GET("/jwt/keys", middlewares.RequirePermission(models.PermKeysManage), controllers.ListJWTKeys)
+		superadmin.POST("/jwt/rotate", middlewares.RequirePermission(models.PermKeysManage), controllers.RotateJWTKey) // 轮换JWT签名密钥
 	}
 	return r //返回路由组
 }
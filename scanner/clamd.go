@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamd INSTREAM 每个分块的大小，需小于 clamd 的 StreamMaxLength
+const clamdChunkSize = 64 << 10
+
+// Clamd ClamAV 守护进程，按 clamd 协议的 INSTREAM 命令把内容发给它扫描
+type Clamd struct {
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// NewClamd address 为 tcp://host:port、unix:///path/clamd.ctl 或 host:port
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	c := &Clamd{network: "tcp", addr: address, timeout: timeout}
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		c.addr = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		c.network, c.addr = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.Contains(address, "://"):
+		return nil, fmt.Errorf("unsupported clamd address %q", address)
+	}
+	if c.addr == "" {
+		return nil, errors.New("empty clamd address")
+	}
+	return c, nil
+}
+
+func (*Clamd) Name() string { return "clamd" }
+
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	deadline := time.Now().Add(c.timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// Ping 检查 clamd 是否可用
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// Scan 以 zINSTREAM 发送内容：每个分块前为 4 字节大端长度，长度为 0 的分块表示结束
+func (c *Clamd) Scan(ctx context.Context, _ string, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	werr := sendStream(conn, r)
+	// 内容超过 StreamMaxLength 时 clamd 会提前回复并断开，写入失败时仍尝试读取回复
+	reply, err := readReply(conn)
+	if err != nil {
+		if werr != nil {
+			return Result{}, werr
+		}
+		return Result{}, err
+	}
+	return parseReply(reply)
+}
+
+func sendStream(w io.Writer, r io.Reader) error {
+	if _, err := w.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// 回复以 NUL 结尾（z 前缀的命令）
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// stream: OK / stream: Eicar-Signature FOUND / INSTREAM size limit exceeded. ERROR
+func parseReply(reply string) (Result, error) {
+	msg := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case msg == "OK":
+		return Result{Verdict: Clean}, nil
+	case strings.HasSuffix(msg, " FOUND"):
+		return Result{Verdict: Infected, Reason: strings.TrimSuffix(msg, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", msg)
+	}
+}
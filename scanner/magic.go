@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// 检查文件头时读取的字节数，与 http.DetectContentType 一致
+const sniffLen = 512
+
+// Magic 检查文件头是否与扩展名相符，防止把可执行文件、HTML 等改名为允许的扩展名上传
+type Magic struct{}
+
+// NewMagic 创建文件头检查
+func NewMagic() *Magic { return &Magic{} }
+
+func (*Magic) Name() string { return "magic" }
+
+// 各扩展名允许的文件头；没有列出的扩展名不检查
+var magicRules = map[string]func(head []byte) bool{
+	".jpg":  isJPEG,
+	".jpeg": isJPEG,
+	".png":  prefix("\x89PNG\r\n\x1a\n"),
+	".gif":  isGIF,
+	".webp": riff("WEBP"),
+	".avi":  riff("AVI "),
+	".mp4":  isISOMedia,
+	".mov":  isISOMedia,
+	".mkv":  prefix("\x1a\x45\xdf\xa3"), // EBML
+	".pdf":  prefix("%PDF-"),
+	".docx": prefix("PK\x03\x04"), // Office Open XML 是 ZIP
+	".xlsx": prefix("PK\x03\x04"),
+	".doc":  prefix("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), // OLE2
+	".txt":  isText,
+	".md":   isText,
+	".csv":  isText,
+}
+
+func (*Magic) Scan(_ context.Context, filename string, r io.Reader) (Result, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	rule, ok := magicRules[ext]
+	if !ok {
+		return Result{Verdict: Clean}, nil
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return Result{}, err
+	}
+	if !rule(head[:n]) {
+		return Result{Verdict: Rejected, Reason: "content does not match the " + ext + " extension"}, nil
+	}
+	return Result{Verdict: Clean}, nil
+}
+
+func prefix(sig string) func([]byte) bool {
+	return func(h []byte) bool { return bytes.HasPrefix(h, []byte(sig)) }
+}
+
+func isJPEG(h []byte) bool { return bytes.HasPrefix(h, []byte("\xff\xd8\xff")) }
+
+func isGIF(h []byte) bool {
+	return bytes.HasPrefix(h, []byte("GIF87a")) || bytes.HasPrefix(h, []byte("GIF89a"))
+}
+
+// RIFF 容器：RIFF <大小> <格式>
+func riff(format string) func([]byte) bool {
+	return func(h []byte) bool {
+		return len(h) >= 12 && bytes.HasPrefix(h, []byte("RIFF")) && string(h[8:12]) == format
+	}
+}
+
+// MP4/MOV：第一个 box 为 ftyp；早期的 QuickTime 文件可能直接以 moov/mdat/wide/free 开头
+func isISOMedia(h []byte) bool {
+	if len(h) < 8 {
+		return false
+	}
+	switch string(h[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// 文本文件：不含 NUL 字节（允许 UTF-16 BOM），不要求 UTF-8，GBK 等编码的 CSV 也能通过
+func isText(h []byte) bool {
+	if bytes.HasPrefix(h, []byte("\xff\xfe")) || bytes.HasPrefix(h, []byte("\xfe\xff")) {
+		return true
+	}
+	return bytes.IndexByte(h, 0) < 0
+}
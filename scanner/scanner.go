@@ -0,0 +1,31 @@
+package scanner
+
+// 上传内容扫描：上传的内容写入数据库之前依次交给各个扫描器检查，
+// 任一扫描器判定为恶意或不符合内容策略时拒绝上传
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrUnavailable 连接不上扫描引擎；与单个文件扫描失败（如超过引擎的大小上限）区分
+var ErrUnavailable = errors.New("scanner unavailable")
+
+// 扫描结论
+const (
+	Clean    = "clean"
+	Infected = "infected" // 杀毒引擎识别为恶意内容
+	Rejected = "rejected" // 不符合内容策略，如文件头与扩展名不符
+)
+
+// Result 扫描结果，Reason 为病毒名或拒绝的原因
+type Result struct {
+	Verdict string
+	Reason  string
+}
+
+// Scanner 扫描器；返回 error 表示无法完成扫描（引擎不可用、超时等），与扫描出问题区分
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, filename string, r io.Reader) (Result, error)
+}
@@ -0,0 +1,83 @@
+// 访问令牌有效期很短：接口返回 token_expired 时自动调用刷新接口续期并重试原请求
+// 使用 cookie 登录态的写请求（POST/PUT/PATCH/DELETE）自动附带 X-CSRF-Token 请求头
+(function () {
+    const rawFetch = window.fetch.bind(window);
+    let refreshing = null; // 并发请求共享同一次刷新，避免刷新令牌被重复使用
+    let csrfLoading = null;
+
+    function refreshToken() {
+        if (!refreshing) {
+            refreshing = rawFetch('/api/auth/refresh', { method: 'POST', credentials: 'include' })
+                .then(async (res) => {
+                    if (!res.ok) return null;
+                    const data = await res.json().catch(() => ({}));
+                    if (data.token) localStorage.setItem('token', data.token);
+                    return data.token || null;
+                })
+                .catch(() => null)
+                .finally(() => { refreshing = null; });
+        }
+        return refreshing;
+    }
+
+    function readCsrfCookie() {
+        const m = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]+)/);
+        return m ? decodeURIComponent(m[1]) : '';
+    }
+
+    // cookie 中没有令牌时向服务端申请
+    function csrfToken(force) {
+        const existing = force ? '' : readCsrfCookie();
+        if (existing) return Promise.resolve(existing);
+        if (!csrfLoading) {
+            csrfLoading = rawFetch('/api/auth/csrf', { credentials: 'include' })
+                .then(res => res.ok ? res.json() : {})
+                .then(data => data.csrf_token || readCsrfCookie())
+                .catch(() => '')
+                .finally(() => { csrfLoading = null; });
+        }
+        return csrfLoading;
+    }
+
+    function isUnsafe(input, init) {
+        const method = ((init && init.method) || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+        return !['GET', 'HEAD', 'OPTIONS'].includes(method);
+    }
+
+    async function withCsrf(input, init, force) {
+        const opts = Object.assign({}, init || {});
+        if (!isUnsafe(input, init)) return opts;
+        const headers = new Headers(opts.headers || (input instanceof Request ? input.headers : undefined));
+        const token = await csrfToken(force);
+        if (token) headers.set('X-CSRF-Token', token);
+        opts.headers = headers;
+        return opts;
+    }
+
+    async function errorCode(res, status) {
+        if (res.status !== status) return '';
+        const data = await res.clone().json().catch(() => ({}));
+        return data.code || '';
+    }
+
+    window.fetch = async function (input, init) {
+        const url = typeof input === 'string' ? input : (input && input.url) || '';
+        const sameOrigin = !/^https?:\/\//i.test(url) || url.startsWith(location.origin);
+        if (!sameOrigin) return rawFetch(input, init); // 不把令牌发给其他站点
+
+        let opts = await withCsrf(input, init, false);
+        let res = await rawFetch(input, opts);
+        if (await errorCode(res, 403) === 'csrf_invalid') { // 令牌过期或被清除，重新获取后重试一次
+            opts = await withCsrf(input, init, true);
+            res = await rawFetch(input, opts);
+        }
+        if (url.indexOf('/api/auth/') !== -1 || await errorCode(res, 401) !== 'token_expired') return res;
+
+        const token = await refreshToken();
+        if (!token) return res;
+        const headers = new Headers(opts.headers || (input instanceof Request ? input.headers : undefined));
+        if (headers.has('Authorization')) headers.set('Authorization', token);
+        opts.headers = headers;
+        return rawFetch(input, opts);
+    };
+})();
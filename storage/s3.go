@@ -0,0 +1,345 @@
+package storage
+
+// 兼容 S3 协议的对象存储（AWS S3、MinIO 等），请求使用 AWS Signature V4 签名
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3TimeFormat     = "20060102T150405Z"
+	s3MaxPresignTime = 7 * 24 * time.Hour // S3 允许的最长预签名有效期
+)
+
+// S3Options S3 后端的连接参数
+type S3Options struct {
+	Endpoint  string // 如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // MinIO 等自建服务通常需要 path-style（endpoint/bucket/key）
+	Prefix    string // 对象 key 的公共前缀
+}
+
+// S3 兼容 S3 协议的对象存储
+type S3 struct {
+	opt      S3Options
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 创建 S3 后端
+func NewS3(opt S3Options) (*S3, error) {
+	u, err := url.Parse(strings.TrimRight(opt.Endpoint, "/"))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", opt.Endpoint)
+	}
+	if opt.Bucket == "" || opt.AccessKey == "" || opt.SecretKey == "" {
+		return nil, errors.New("s3 bucket, accessKey and secretKey are required")
+	}
+	if opt.Region == "" {
+		opt.Region = "us-east-1"
+	}
+	opt.Prefix = strings.Trim(opt.Prefix, "/")
+	return &S3{opt: opt, endpoint: u, client: &http.Client{}, now: time.Now}, nil
+}
+
+func (s *S3) Name() string { return "s3" }
+
+// 对象的访问地址
+func (s *S3) objectURL(key string) *url.URL {
+	objectKey := strings.TrimLeft(path.Join(s.opt.Prefix, key), "/")
+	u := *s.endpoint
+	if s.opt.PathStyle {
+		u.Path = u.Path + "/" + s.opt.Bucket + "/" + objectKey
+	} else {
+		u.Host = s.opt.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + objectKey
+	}
+	u.RawPath = s3EscapePath(u.Path) // 实际发送的路径与签名时的规范化路径保持一致
+	return &u
+}
+
+// s3Error S3 返回的 XML 错误
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3ResponseError(op, key string, res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+	var e s3Error
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s (%s)", op, key, e.Code, e.Message)
+	}
+	return fmt.Errorf("s3 %s %s: unexpected status %s", op, key, res.Status)
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 { // 未知长度的 body 会以 chunked 发送，S3 对空对象返回 411 MissingContentLength
+			req.Body = http.NoBody
+		}
+	}
+	s.sign(req, s3UnsignedBody, s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	res, err := s.do(ctx, http.MethodPut, key, r, size, http.Header{"Content-Type": {"application/octet-stream"}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3ResponseError("put", key, res)
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ObjectInfo{}, s3ResponseError("head", key, res)
+	}
+	return s3Info(key, res), nil
+}
+
+func s3Info(key string, res *http.Response) ObjectInfo {
+	info := ObjectInfo{Key: key, Size: res.ContentLength}
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+func (s *S3) Get(ctx context.Context, key string) (Object, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, s3ResponseError("get", key, res)
+	}
+	return &s3Object{s: s, ctx: ctx, info: s3Info(key, res), body: res.Body}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return s3ResponseError("delete", key, res)
+	}
+	return nil
+}
+
+// Presign 生成限时的 GET 下载链接，可指定响应的 Content-Type / Content-Disposition
+func (s *S3) Presign(_ context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error) {
+	if ttl <= 0 || ttl > s3MaxPresignTime {
+		ttl = s3MaxPresignTime
+	}
+	u := s.objectURL(key)
+	now := s.now().UTC()
+	amzDate := now.Format(s3TimeFormat)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.opt.AccessKey+"/"+s.scope(amzDate))
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if opts.ContentType != "" {
+		q.Set("response-content-type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		q.Set("response-content-disposition", opts.ContentDisposition)
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		s3EscapePath(u.Path),
+		s3CanonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedBody,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(amzDate, canonical))
+	u.RawQuery = s3CanonicalQuery(q)
+	return u.String(), nil
+}
+
+// sign 为请求添加 Signature V4 的 Authorization 头，签名 host、x-amz-content-sha256、x-amz-date 三个头
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(s3TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.opt.AccessKey, s.scope(amzDate), signed, s.signature(amzDate, canonical)))
+}
+
+func (s *S3) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.opt.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(amzDate, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	toSign := s3Algorithm + "\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(sum[:])
+	key := hmacSHA256([]byte("AWS4"+s.opt.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.opt.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// S3 规范化 URI：除未保留字符与 / 外全部百分号编码
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return strings.ReplaceAll(s3Escape(p), "%2F", "/")
+}
+
+func s3Escape(v string) string {
+	var b strings.Builder
+	for _, c := range []byte(v) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Object 按需发起 Range 请求的读取器：Seek 只记录位置，下一次 Read 时从该位置重新请求
+type s3Object struct {
+	s       *S3
+	ctx     context.Context
+	info    ObjectInfo
+	body    io.ReadCloser
+	bodyOff int64 // body 当前读到的位置
+	off     int64 // 调用方期望的读取位置
+}
+
+func (o *s3Object) Info() ObjectInfo { return o.info }
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.off >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body != nil && o.bodyOff != o.off {
+		o.body.Close()
+		o.body = nil
+	}
+	if o.body == nil {
+		res, err := o.s.do(o.ctx, http.MethodGet, o.info.Key, nil, 0, http.Header{"Range": {fmt.Sprintf("bytes=%d-", o.off)}})
+		if err != nil {
+			return 0, err
+		}
+		if res.StatusCode != http.StatusPartialContent {
+			defer res.Body.Close()
+			return 0, s3ResponseError("get", o.info.Key, res)
+		}
+		o.body, o.bodyOff = res.Body, o.off
+	}
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	o.bodyOff += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.off + offset
+	case io.SeekEnd:
+		abs = o.info.Size + offset
+	default:
+		return 0, errors.New("s3 object: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("s3 object: negative position")
+	}
+	o.off = abs
+	return abs, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
@@ -0,0 +1,81 @@
+package storage
+
+// 文件存储后端：上传的内容按相对 key（如 blobs/ab/<sha256>）保存，key 与后端无关，
+// 切换后端时只需把对象复制过去，数据库中的 key 保持不变
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	ErrNotExist           = errors.New("object does not exist")
+	ErrPresignUnsupported = errors.New("storage driver does not support presigned urls")
+)
+
+// ObjectInfo 对象的元信息
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object 读取中的对象，支持 Seek，可直接交给 http.ServeContent 处理 Range 请求
+type Object interface {
+	io.ReadSeekCloser
+	Info() ObjectInfo
+}
+
+// PresignOptions 预签名下载链接附带的响应头
+type PresignOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Storage 存储后端；key 一律使用 / 分隔的相对路径
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (Object, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error // 对象不存在时不报错
+	Presign(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error)
+}
+
+// fileMover 后端可以直接接管本地文件时实现（本地磁盘直接重命名），避免多拷贝一次
+type fileMover interface {
+	MoveFile(ctx context.Context, localPath, key string) error
+}
+
+// PutFile 把本地临时文件存入后端，成功后临时文件不再存在
+func PutFile(ctx context.Context, s Storage, localPath, key string) error {
+	if m, ok := s.(fileMover); ok {
+		return m.MoveFile(ctx, localPath, key)
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = s.Put(ctx, key, f, st.Size())
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(localPath)
+}
+
+// Exists 对象是否存在
+func Exists(ctx context.Context, s Storage, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,107 @@
+// fakeclamd 本地调试用的 clamd 替身：实现 PING 与 INSTREAM 命令，内容中含 EICAR 测试串时报告发现病毒
+//
+//	go run ./tools/fakeclamd -addr 127.0.0.1:3310
+//
+// 把 upload.scan.clamd 设为 tcp://127.0.0.1:3310 即可在没有安装 ClamAV 的环境中测试上传扫描
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// EICAR 标准反病毒测试文件的内容
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:3310", "listen address")
+	maxStream := flag.Int64("max-stream", 100<<20, "like clamd StreamMaxLength, in bytes")
+	flag.Parse()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log.Printf("fake clamd listening on %s", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		go handle(conn, *maxStream)
+	}
+}
+
+func handle(conn net.Conn, maxStream int64) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// z 前缀的命令以 NUL 结尾，n 前缀的以换行结尾；回复使用相同的结尾
+	first, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	delim := byte('\n')
+	switch first {
+	case 'z':
+		delim = 0
+	case 'n':
+	default:
+		r.UnreadByte()
+	}
+	cmd, err := r.ReadString(delim)
+	if err != nil {
+		return
+	}
+	reply := func(s string) { conn.Write(append([]byte(s), delim)) }
+	switch strings.TrimRight(cmd, "\x00\n") {
+	case "PING":
+		reply("PONG")
+	case "VERSION":
+		reply("ClamAV 0.0.0/fakeclamd")
+	case "INSTREAM":
+		data, err := readStream(r, maxStream)
+		if err != nil {
+			reply("INSTREAM size limit exceeded. ERROR")
+			return
+		}
+		if bytes.Contains(data, []byte(eicar)) {
+			reply("stream: Eicar-Test-Signature FOUND")
+			return
+		}
+		reply("stream: OK")
+	default:
+		reply("UNKNOWN COMMAND")
+	}
+}
+
+func readStream(r io.Reader, maxStream int64) ([]byte, error) {
+	var data []byte
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			return data, nil
+		}
+		if int64(len(data))+int64(n) > maxStream {
+			return nil, fmt.Errorf("stream exceeds %d bytes", maxStream)
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
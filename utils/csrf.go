@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+const csrfTokenBytes = 32
+
+// EnsureCSRFToken 返回当前的 CSRF 令牌，没有时生成并写入 cookie
+func EnsureCSRFToken(c *gin.Context) (string, error) {
+	if ck, err := c.Cookie(CSRFCookieName); err == nil && len(ck) >= csrfTokenBytes {
+		return ck, nil
+	}
+	return RotateCSRFToken(c)
+}
+
+// RotateCSRFToken 生成新的 CSRF 令牌，登录成功时调用，避免沿用登录前可能被植入的令牌
+func RotateCSRFToken(c *gin.Context) (string, error) {
+	token, err := NewOpaqueToken(csrfTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	SetCSRFCookie(c, token)
+	return token, nil
+}
+
+// CSRFTokenValid 双重提交校验：请求头中的令牌必须与 cookie 中的一致（第三方站点读不到本站 cookie）
+func CSRFTokenValid(c *gin.Context) bool {
+	ck, err := c.Cookie(CSRFCookieName)
+	header := c.GetHeader(CSRFHeaderName)
+	if err != nil || ck == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ck), []byte(header)) == 1
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"unicode/utf8"
 )
 
 func MaxInt(a, b int) int {
@@ -32,3 +33,14 @@ func Get_size(data int64) string {
 		return fmt.Sprintf("%.2fTB", float64(data)/float64(TB)) 
 	}
 }
+
+// TruncateUTF8 截断到最多 n 个字节，不会截断在多字节字符中间（utf8mb4 列写入半个字符会出错）
+func TruncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
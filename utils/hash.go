@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"io"
     "errors"
@@ -53,4 +55,19 @@ func CopyWithHash(dst io.Writer, src io.Reader, maxSize, expectedSize int64) (st
 func CheckByte(v interface{}) bool { //直接检验
     _, ok := v.(byte)
     return ok
-}
\ No newline at end of file
+}
+
+// NewOpaqueToken 生成不透明的随机令牌（base64url，无填充），用于刷新令牌等场景
+func NewOpaqueToken(nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random token failed: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken 令牌只以 SHA-256 摘要入库，数据库泄露时无法直接使用
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
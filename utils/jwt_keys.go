@@ -0,0 +1,181 @@
+package utils
+
+// JWT 签名密钥环：当前密钥负责签发，历史密钥只负责校验，直到其签发的令牌全部过期
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type JWTKey struct {
+	Kid       string
+	Secret    []byte
+	RetiredAt time.Time // 被轮换下来的时间，零值表示仍是当前密钥
+}
+
+type jwtKeyRing struct {
+	mu          sync.RWMutex
+	current     JWTKey
+	previous    []JWTKey // 按轮换时间从新到旧
+	maxPrevious int
+	unknown     map[string]time.Time // 回源也找不到的 kid 及其过期时间，避免伪造的 kid 反复查库
+}
+
+const (
+	unknownKidTTL = time.Minute
+	// 负缓存的上限；达到上限后在条目过期前不再回源，限制伪造 kid 能触发的查询次数
+	maxUnknownKids = 1024
+)
+
+var (
+	keyRing = &jwtKeyRing{unknown: map[string]time.Time{}}
+	// 本地找不到 kid 时的回源查询（例如其他实例刚刚轮换了密钥），由 config 注入
+	JWTKeyResolver func(kid string) (JWTKey, bool)
+
+	ErrNoSigningKey = errors.New("jwt signing key is not configured")
+)
+
+// SetJWTKeys 整体替换密钥环，启动时由 config 调用；maxPrevious 限制保留的历史密钥数量
+func SetJWTKeys(maxPrevious int, current JWTKey, previous ...JWTKey) {
+	keyRing.mu.Lock()
+	defer keyRing.mu.Unlock()
+	keyRing.current = current
+	keyRing.previous = append([]JWTKey(nil), previous...)
+	keyRing.maxPrevious = maxPrevious
+	keyRing.unknown = map[string]time.Time{}
+	keyRing.pruneLocked()
+}
+
+// RotateJWTKey 把当前密钥降级为历史密钥并启用 next；maxPrevious 限制保留的历史密钥数量
+func RotateJWTKey(next JWTKey, maxPrevious int) {
+	keyRing.mu.Lock()
+	defer keyRing.mu.Unlock()
+	if keyRing.current.Kid != "" {
+		old := keyRing.current
+		old.RetiredAt = time.Now()
+		keyRing.previous = append([]JWTKey{old}, keyRing.previous...)
+	}
+	keyRing.current = next
+	keyRing.maxPrevious = maxPrevious
+	delete(keyRing.unknown, next.Kid)
+	keyRing.pruneLocked()
+}
+
+// 历史密钥在退役超过令牌有效期后就不会再有合法令牌引用它，可以安全丢弃
+func (k JWTKey) expired() bool {
+	return !k.RetiredAt.IsZero() && time.Since(k.RetiredAt) > AccessTokenTTL
+}
+
+func (r *jwtKeyRing) pruneLocked() {
+	kept := r.previous[:0]
+	for _, k := range r.previous {
+		if k.expired() {
+			continue
+		}
+		if r.maxPrevious > 0 && len(kept) >= r.maxPrevious {
+			break
+		}
+		kept = append(kept, k)
+	}
+	r.previous = kept
+}
+
+func currentJWTKey() (JWTKey, error) {
+	keyRing.mu.RLock()
+	defer keyRing.mu.RUnlock()
+	if keyRing.current.Kid == "" || len(keyRing.current.Secret) == 0 {
+		return JWTKey{}, ErrNoSigningKey
+	}
+	return keyRing.current, nil
+}
+
+// 按 kid 查找校验密钥；kid 为空时兼容旧令牌，使用当前密钥。
+// kid 来自尚未校验的令牌头，本地与负缓存都找不到时才回源
+func lookupJWTKey(kid string) (JWTKey, bool) {
+	keyRing.mu.RLock()
+	if kid == "" || kid == keyRing.current.Kid {
+		k := keyRing.current
+		keyRing.mu.RUnlock()
+		return k, k.Kid != ""
+	}
+	for _, k := range keyRing.previous {
+		if k.Kid == kid {
+			keyRing.mu.RUnlock()
+			return k, !k.expired()
+		}
+	}
+	until, known := keyRing.unknown[kid]
+	full := len(keyRing.unknown) >= maxUnknownKids
+	keyRing.mu.RUnlock()
+
+	now := time.Now()
+	if JWTKeyResolver == nil || (known && now.Before(until)) {
+		return JWTKey{}, false
+	}
+	if full && !keyRing.evictUnknown(now) {
+		return JWTKey{}, false
+	}
+	k, ok := JWTKeyResolver(kid)
+	keyRing.mu.Lock()
+	defer keyRing.mu.Unlock()
+	if !ok || k.expired() {
+		if len(keyRing.unknown) < maxUnknownKids {
+			keyRing.unknown[kid] = now.Add(unknownKidTTL)
+		}
+		return JWTKey{}, false
+	}
+	// 回源成功后缓存为历史密钥，避免每次都查库；并发回源同一个 kid 时只保留一份
+	delete(keyRing.unknown, kid)
+	if k.Kid == keyRing.current.Kid {
+		return keyRing.current, true
+	}
+	for _, cached := range keyRing.previous {
+		if cached.Kid == kid {
+			return cached, true
+		}
+	}
+	// 回源得到的通常是其他实例刚轮换出的密钥，比本地的历史密钥新
+	keyRing.previous = append([]JWTKey{k}, keyRing.previous...)
+	keyRing.pruneLocked()
+	return k, true
+}
+
+// 清理已过期的负缓存条目，返回清理后是否还有空位
+func (r *jwtKeyRing) evictUnknown(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for kid, until := range r.unknown {
+		if !now.Before(until) {
+			delete(r.unknown, kid)
+		}
+	}
+	return len(r.unknown) < maxUnknownKids
+}
+
+// JWTKeyIDs 返回当前 kid 和仍在校验期内的历史 kid（不暴露密钥本身）
+func JWTKeyIDs() (string, []string) {
+	keyRing.mu.RLock()
+	defer keyRing.mu.RUnlock()
+	prev := make([]string, 0, len(keyRing.previous))
+	for _, k := range keyRing.previous {
+		prev = append(prev, k.Kid)
+	}
+	return keyRing.current.Kid, prev
+}
+
+// NewJWTKey 随机生成一把 HMAC 密钥，kid 由时间戳和随机后缀组成
+func NewJWTKey() (JWTKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return JWTKey{}, fmt.Errorf("generate jwt secret failed: %w", err)
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return JWTKey{}, fmt.Errorf("generate jwt kid failed: %w", err)
+	}
+	kid := fmt.Sprintf("k%s-%s", time.Now().Format("20060102150405"), hex.EncodeToString(suffix))
+	return JWTKey{Kid: kid, Secret: secret}, nil
+}
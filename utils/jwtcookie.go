@@ -8,17 +8,41 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-const CookieName = "Authorization" // token中对应的键
+const (
+	CookieName        = "Authorization" // token中对应的键
+	RefreshCookieName = "Refresh"       // 刷新令牌对应的键
+	RefreshCookiePath = "/api/auth"     // 刷新令牌只发送给认证接口，减少暴露面
+	CSRFCookieName    = "csrf_token"    // CSRF 令牌（双重提交），前端可读
+	CSRFHeaderName    = "X-CSRF-Token"  // 前端把 CSRF cookie 的值放在这个请求头里
+)
+
+// CookieSecure 是否只在 HTTPS 下发送 cookie，由配置 cookie.secure 设置；本地 http 开发时为 false
+var CookieSecure = false
 
 func SetAuthCookie(c *gin.Context, token string, ttl time.Duration) {
 	// 先设置 SameSite 策略（对后续 SetCookie 生效）
-	c.SetSameSite(http.SameSiteLaxMode) // 防大多数 CSRF，站内导航会带上
+	c.SetSameSite(http.SameSiteLaxMode) // 防大多数 CSRF，站内导航会带上；非 GET 请求另有 CSRF 令牌校验
 
-	// dev 下 secure=false；生产 https 请设为 true
-	c.SetCookie(CookieName, token, int(ttl.Seconds()), "/", "", false, true) // HttpOnly
+	c.SetCookie(CookieName, token, int(ttl.Seconds()), "/", "", CookieSecure, true) // HttpOnly
 }
 
 func ClearAuthCookie(c *gin.Context) { // 清楚cookie
 	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(CookieName, "", -1, "/", "", false, true) //手动设置为空
+	c.SetCookie(CookieName, "", -1, "/", "", CookieSecure, true) //手动设置为空
+}
+
+func SetRefreshCookie(c *gin.Context, token string, ttl time.Duration) {
+	c.SetSameSite(http.SameSiteStrictMode) // 刷新令牌只在站内请求时携带
+	c.SetCookie(RefreshCookieName, token, int(ttl.Seconds()), RefreshCookiePath, "", CookieSecure, true)
+}
+
+func ClearRefreshCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(RefreshCookieName, "", -1, RefreshCookiePath, "", CookieSecure, true)
+}
+
+// SetCSRFCookie 设置 CSRF 令牌（会话 cookie，非 HttpOnly，页面脚本需要读取后放进请求头）
+func SetCSRFCookie(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(CSRFCookieName, token, 0, "/", "", CookieSecure, false)
 }
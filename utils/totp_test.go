@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量，密钥为 ASCII "12345678901234567890"；
+// 原文为 8 位验证码，6 位验证码是其后 6 位
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfc6238Vectors {
+		if got := totpCode(key, v.unix/TOTPPeriod); got != v.code {
+			t.Errorf("T=%d: got %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now)
+		if !ok || step != v.unix/TOTPPeriod {
+			t.Errorf("T=%d: ValidateTOTP = (%d, %v), want (%d, true)", v.unix, step, ok, v.unix/TOTPPeriod)
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	cases := []struct {
+		name   string
+		secret string
+		at     time.Time
+		code   string
+		want   bool
+	}{
+		{"lowercase secret and spaces", " gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", now, " 050471 ", true},
+		{"previous step within skew", rfc6238Secret, now.Add(TOTPPeriod * time.Second), "050471", true},
+		{"next step within skew", rfc6238Secret, now.Add(-TOTPPeriod * time.Second), "050471", true},
+		{"outside skew", rfc6238Secret, now.Add(2 * TOTPPeriod * time.Second), "050471", false},
+		{"wrong code", rfc6238Secret, now, "050472", false},
+		{"eight digits", rfc6238Secret, now, "14050471", false},
+		{"empty code", rfc6238Secret, now, "", false},
+		{"invalid secret", "not base32!", now, "050471", false},
+	}
+	for _, tc := range cases {
+		if _, ok := ValidateTOTP(tc.secret, tc.code, tc.at); ok != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, ok, tc.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package utils
 // 辅助工具函数
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -12,69 +13,122 @@ import (
 
 const (
 	cipher_number = 12 //自动识别类型
-	Expire_hours  = 72
 	default_role  = "user"
 )
 
+// 令牌有效期，启动时由 config 依据配置覆盖
+var (
+	AccessTokenTTL  = 15 * time.Minute    // 短期访问令牌（JWT）
+	RefreshTokenTTL = 30 * 24 * time.Hour // 长期刷新令牌（不透明随机串）
+)
+
 func HashPassword(pwd string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), cipher_number)
 	return string(hash), err
 }
-func GenerateJWT(username string, role string) (string, error) {
+
+// TokenClaims 访问令牌中携带的信息
+type TokenClaims struct {
+	Username  string
+	Role      string
+	ExpiresAt int64  // 过期时间（unix 秒）
+	ID        string // jti，注销单个令牌时写入黑名单
+	SessionID string // sid，对应刷新令牌家族，注销会话时使用
+	Version   uint   // ver，用户的令牌版本，版本递增后旧令牌全部失效
+}
+
+func GenerateJWT(username string, role string, sessionID string, version uint) (string, error) {
+	jti, err := NewOpaqueToken(16) // 每个令牌唯一的ID
+	if err != nil {
+		return "", err
+	}
 	// 用 MapClaims 时，直接传入 jwt.MapClaims{...}
 	claims := jwt.MapClaims{
 		"username": username,
 		"role":     role,
-		"exp":      time.Now().Add(time.Duration(Expire_hours) * time.Hour).Unix(), // 过期时间（秒）
-		"iat":      time.Now().Unix(),                                              // 签发时间（可选）
-		"nbf":      time.Now().Unix(),                                              // 生效时间（可选）
+		"jti":      jti,
+		"sid":      sessionID,
+		"ver":      version,
+		"exp":      time.Now().Add(AccessTokenTTL).Unix(), // 过期时间（秒）
+		"iat":      time.Now().Unix(),                     // 签发时间（可选）
+		"nbf":      time.Now().Unix(),                     // 生效时间（可选）
+	}
+	key, err := currentJWTKey() // 密钥来自配置的密钥环
+	if err != nil {
+		return "", err
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// 生产环境：把 "secret" 放到配置/环境变量里
-	signedToken, err := token.SignedString([]byte("secret"))
+	token.Header["kid"] = key.Kid // 在头部标明签名密钥，校验时据此选择密钥
+	signedToken, err := token.SignedString(key.Secret)
 	return "Bearer " + signedToken, err // 注意 Bearer 后面要有空格
 }
 
 // 因为这里我们的token包含了username信息
 func ParseJWT(tk string) (string, string, int64, error) {
+	claims, err := ParseJWTClaims(tk)
+	if err != nil {
+		return "", default_role, 0, err
+	}
+	return claims.Username, claims.Role, claims.ExpiresAt, nil
+}
+
+// ParseJWTClaims 校验签名并取出全部声明
+func ParseJWTClaims(tk string) (*TokenClaims, error) {
 	tk = strings.TrimSpace(tk) // TrimSpace去除字符串两端的空白字符
 	low := strings.ToLower(tk) // 将字符串转换为小写
 	if strings.HasPrefix(low, "bearer ") {
 		tk = strings.TrimSpace(tk[7:]) //7-前缀长度
 	}
 	if tk == "" {
-		return "", default_role, 0, errors.New("empty token")
+		return nil, errors.New("empty token")
 	}
 	token, err := jwt.Parse(tk, func(token *jwt.Token) (interface{}, error) { // 这里依据其框架写入对应实现的函数操作
 		// 固定算法族
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok { //按照这个HMAC法解析
 			return nil, jwt.ErrTokenUnverifiable
 		}
-		return []byte("secret"), nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := lookupJWTKey(kid) // 依据 kid 选择对应的密钥（含已轮换的历史密钥）
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key.Secret, nil
 	})
 	if err != nil {
-		return "", default_role, 0, err
+		return nil, err
 	}
 	//  用ok和valid看是否解析成功且声明存在
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// 我们这里往JWT中传入的键值是username和role
-		username, ok1 := claims["username"].(string) //获得其键值
-		role, ok2 := claims["role"].(string)
-		// exp 字段在 JSON 解析时会被解析为 float64，需要先断言为 float64 再转换为 int64
-		var expireTime int64
-		var ok3 bool
-		// 这里多层判断
-		if expFloat, ok := claims["exp"].(float64); ok {
-			expireTime = int64(expFloat)
-			ok3 = true
-		} else if expInt, ok := claims["exp"].(int64); ok {
-			expireTime = expInt
-			ok3 = true
-		}
-		if !ok1 || !ok2 || !ok3 {
-			return "", default_role, 0, errors.New("user's claim is not a string")
-		}
-		return username, role, expireTime, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-	return "", default_role, 0, errors.New("invalid token")
+	// 我们这里往JWT中传入的键值是username和role
+	username, ok1 := claims["username"].(string) //获得其键值
+	role, ok2 := claims["role"].(string)
+	// exp 字段在 JSON 解析时会被解析为 float64，需要先断言为 float64 再转换为 int64
+	var expireTime int64
+	var ok3 bool
+	// 这里多层判断
+	if expFloat, ok := claims["exp"].(float64); ok {
+		expireTime = int64(expFloat)
+		ok3 = true
+	} else if expInt, ok := claims["exp"].(int64); ok {
+		expireTime = expInt
+		ok3 = true
+	}
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("user's claim is not a string")
+	}
+	out := &TokenClaims{Username: username, Role: role, ExpiresAt: expireTime}
+	out.ID, _ = claims["jti"].(string)
+	out.SessionID, _ = claims["sid"].(string)
+	if ver, ok := claims["ver"].(float64); ok {
+		out.Version = uint(ver)
+	}
+	return out, nil
+}
+
+// IsTokenExpired 判断解析错误是否仅仅是访问令牌过期（可以用刷新令牌续期）
+func IsTokenExpired(err error) bool {
+	return errors.Is(err, jwt.ErrTokenExpired)
 }